@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/funcs"
+)
+
+// appVolumeInterval is how often the list of playing applications is
+// refreshed.
+const appVolumeInterval = 2 * time.Second
+
+// paVolumeNorm is PulseAudio's 100% volume.
+const paVolumeNorm = 65536
+
+var (
+	sinkInputHeader = regexp.MustCompile(`^Sink Input #(\d+)$`)
+	sinkInputVolume = regexp.MustCompile(`(\d+) /`)
+	sinkInputName   = regexp.MustCompile(`^application\.name = "(.*)"$`)
+)
+
+// appVolume is a PulseAudio sink input, i.e. one application's stream.
+type appVolume struct {
+	Index int
+	Name  string
+	Vol   int64
+	Mute  bool
+	// refresh is called after the volume or mute state has been changed.
+	refresh func()
+}
+
+// Pct returns the volume as a percentage of 100% (not of the maximum,
+// since PulseAudio allows amplifying beyond 100%).
+func (a appVolume) Pct() int {
+	return int(a.Vol * 100 / paVolumeNorm)
+}
+
+func (a appVolume) SetVolume(vol int64) {
+	a.pactl("set-sink-input-volume", strconv.FormatInt(vol, 10))
+}
+
+func (a appVolume) SetMute(muted bool) {
+	mute := "0"
+	if muted {
+		mute = "1"
+	}
+	a.pactl("set-sink-input-mute", mute)
+}
+
+func (a appVolume) pactl(cmd, arg string) {
+	if err := quickRun("pactl", cmd, strconv.Itoa(a.Index), arg); err != nil {
+		logWarnf("Could not set volume of %s: %v", a.Name, err)
+	}
+	if a.refresh != nil {
+		a.refresh()
+	}
+}
+
+// parseSinkInputs parses `pactl list sink-inputs` output. The volume is that
+// of the first channel.
+func parseSinkInputs(out string) []appVolume {
+	var apps []appVolume
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if m := sinkInputHeader.FindStringSubmatch(line); m != nil {
+			idx, _ := strconv.Atoi(m[1])
+			apps = append(apps, appVolume{Index: idx})
+			continue
+		}
+		if len(apps) == 0 {
+			continue
+		}
+		a := &apps[len(apps)-1]
+		switch {
+		case strings.HasPrefix(line, "Mute:"):
+			a.Mute = strings.TrimSpace(strings.TrimPrefix(line, "Mute:")) == "yes"
+		case strings.HasPrefix(line, "Volume:"):
+			if m := sinkInputVolume.FindStringSubmatch(line); m != nil {
+				a.Vol, _ = strconv.ParseInt(m[1], 10, 64)
+			}
+		default:
+			if m := sinkInputName.FindStringSubmatch(line); m != nil {
+				a.Name = m[1]
+			}
+		}
+	}
+	return apps
+}
+
+// appVolumes lists the applications playing through PulseAudio. ok is false
+// if PulseAudio isn't the sound server.
+func appVolumes() (apps []appVolume, ok bool) {
+	cmd, done := quickCommand("pactl", "list", "sink-inputs")
+	// Field names are translated otherwise.
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.Output()
+	err = done(err)
+	if err != nil {
+		return nil, false
+	}
+	return parseSinkInputs(string(out)), true
+}
+
+// newAppVolumeModule lists each application's volume, which can be changed
+// by scrolling on it like the main volume.
+func newAppVolumeModule() *funcs.RepeatingModule {
+	var m *funcs.RepeatingModule
+	m = pollEvery(appVolumeInterval, func(s bar.Sink) {
+		apps, ok := appVolumes()
+		if !ok {
+			s.Output(nil)
+			return
+		}
+		for i := range apps {
+			apps[i].refresh = m.Refresh
+		}
+		s.Output(appVolumeOutput(apps))
+	})
+	return m
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"sync"
+	"time"
+
+	"barista.run/colors"
+)
+
+type aqiInfo struct {
+	// Index is OpenWeatherMap's air quality index, from 1 (good) to 5
+	// (very poor).
+	Index    int
+	Dominant string
+}
+
+// aqiColors are the dracula colours for each index, from green to purple.
+var aqiColors = []string{"#50FA7B", "#F1FA8C", "#FFB86C", "#FF5555", "#BD93F9"}
+
+func (a aqiInfo) Color() color.Color {
+	if a.Index < 1 || a.Index > len(aqiColors) {
+		return nil
+	}
+	return colors.Hex(aqiColors[a.Index-1])
+}
+
+// aqiGoodLimits are the upper bounds (in μg/m³) of the "good" band for each
+// pollutant OpenWeatherMap's index is based on. The dominant pollutant is
+// the one furthest above its limit.
+var aqiGoodLimits = map[string]float64{
+	"so2":   20,
+	"no2":   40,
+	"pm10":  20,
+	"pm2_5": 10,
+	"o3":    60,
+	"co":    4400,
+}
+
+var aqiNames = map[string]string{
+	"so2":   "SO₂",
+	"no2":   "NO₂",
+	"pm10":  "PM10",
+	"pm2_5": "PM2.5",
+	"o3":    "O₃",
+	"co":    "CO",
+}
+
+type owmAirPollutionResponse struct {
+	List []struct {
+		Main struct {
+			AQI int `json:"aqi"`
+		} `json:"main"`
+		Components map[string]float64 `json:"components"`
+	} `json:"list"`
+}
+
+func owmAirQuality(ctx context.Context, apiKey string, lat, lng float64) (aqiInfo, error) {
+	var res owmAirPollutionResponse
+	err := owmGet(ctx, fmt.Sprintf("%s/air_pollution?lat=%f&lon=%f&appid=%s",
+		owmURL, lat, lng, apiKey), &res)
+	if err != nil {
+		return aqiInfo{}, err
+	}
+	if len(res.List) == 0 {
+		return aqiInfo{}, errors.New("no air quality data returned")
+	}
+	info := aqiInfo{Index: res.List[0].Main.AQI}
+	worst := 0.0
+	for k, v := range res.List[0].Components {
+		limit, ok := aqiGoodLimits[k]
+		if !ok {
+			continue
+		}
+		if ratio := v / limit; ratio > worst {
+			worst = ratio
+			info.Dominant = aqiNames[k]
+		}
+	}
+	return info, nil
+}
+
+// aqiCache remembers the last air quality reading for ttl, to stay well
+// within the API rate limits.
+type aqiCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	info      aqiInfo
+	fetchedAt time.Time
+}
+
+func (c *aqiCache) Get(fetch func() (aqiInfo, error)) (aqiInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.fetchedAt.IsZero() && time.Since(c.fetchedAt) < c.ttl {
+		return c.info, nil
+	}
+	info, err := fetch()
+	if err != nil {
+		return aqiInfo{}, err
+	}
+	c.info, c.fetchedAt = info, time.Now()
+	return info, nil
+}
@@ -0,0 +1,205 @@
+// Package baristatest provides assertions for bar output functions, so that
+// they can be tested as plain functions of their input without running the
+// module they belong to.
+package baristatest
+
+import (
+	"fmt"
+	"html"
+	"image/color"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/pango"
+)
+
+// OutputMatcher checks one aspect of an output's segments, returning a
+// description of the mismatch, or "" if it matches.
+type OutputMatcher func(segments []*bar.Segment) string
+
+// AssertOutput calls outputFn, which must be a func(T) bar.Output (or a
+// func returning any bar.Output implementation), with input and checks the
+// result against all matchers.
+func AssertOutput(t *testing.T, outputFn interface{}, input interface{}, matchers ...OutputMatcher) {
+	t.Helper()
+	fn := reflect.ValueOf(outputFn)
+	if fn.Kind() != reflect.Func || fn.Type().NumIn() != 1 || fn.Type().NumOut() != 1 {
+		t.Fatalf("outputFn must be a func(T) bar.Output, got %T", outputFn)
+	}
+	res := fn.Call([]reflect.Value{reflect.ValueOf(input)})[0]
+	var segments []*bar.Segment
+	if out, ok := res.Interface().(bar.Output); ok && !isNil(res) {
+		segments = out.Segments()
+	}
+	for _, m := range matchers {
+		if msg := m(segments); msg != "" {
+			t.Error(msg)
+		}
+	}
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
+
+// SegmentCount checks the number of segments in the output.
+func SegmentCount(want int) OutputMatcher {
+	return func(segments []*bar.Segment) string {
+		if len(segments) != want {
+			return fmt.Sprintf("got %d segments, want %d", len(segments), want)
+		}
+		return ""
+	}
+}
+
+// Empty checks that there is no output.
+func Empty() OutputMatcher {
+	return SegmentCount(0)
+}
+
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+// Text returns the visible text of a segment, without any pango markup.
+func Text(s *bar.Segment) string {
+	text, isPango := s.Content()
+	if !isPango {
+		return text
+	}
+	return html.UnescapeString(tags.ReplaceAllString(text, ""))
+}
+
+func segmentAt(segments []*bar.Segment, index int) (*bar.Segment, string) {
+	if index >= len(segments) {
+		return nil, fmt.Sprintf("no segment %d, output has %d segments", index, len(segments))
+	}
+	return segments[index], ""
+}
+
+// SegmentText checks the visible text of the segment at index.
+func SegmentText(index int, want string) OutputMatcher {
+	return func(segments []*bar.Segment) string {
+		s, msg := segmentAt(segments, index)
+		if s == nil {
+			return msg
+		}
+		if got := Text(s); got != want {
+			return fmt.Sprintf("segment %d: got text %q, want %q", index, got, want)
+		}
+		return ""
+	}
+}
+
+// SegmentContains checks that the visible text of the segment at index
+// contains want.
+func SegmentContains(index int, want string) OutputMatcher {
+	return func(segments []*bar.Segment) string {
+		s, msg := segmentAt(segments, index)
+		if s == nil {
+			return msg
+		}
+		if got := Text(s); !strings.Contains(got, want) {
+			return fmt.Sprintf("segment %d: text %q does not contain %q", index, got, want)
+		}
+		return ""
+	}
+}
+
+// IsUrgent checks that the segment at index is urgent.
+func IsUrgent(index int) OutputMatcher {
+	return func(segments []*bar.Segment) string {
+		s, msg := segmentAt(segments, index)
+		if s == nil {
+			return msg
+		}
+		if urgent, _ := s.IsUrgent(); !urgent {
+			return fmt.Sprintf("segment %d: not urgent", index)
+		}
+		return ""
+	}
+}
+
+// Color checks the colour of the segment at index. A nil colour checks that
+// no colour is set.
+func Color(index int, want color.Color) OutputMatcher {
+	return func(segments []*bar.Segment) string {
+		s, msg := segmentAt(segments, index)
+		if s == nil {
+			return msg
+		}
+		got, _ := s.GetColor()
+		if !sameColor(got, want) {
+			return fmt.Sprintf("segment %d: got color %v, want %v", index, got, want)
+		}
+		return ""
+	}
+}
+
+func sameColor(a, b color.Color) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+// fakeIcons renders every icon as its full name in brackets, so that tests
+// can check which icon an output used without loading an icon font.
+type fakeIcons string
+
+func (f fakeIcons) Icon(name string) (*pango.Node, bool) {
+	return pango.Textf("[%s-%s]", string(f), name), true
+}
+
+// FakeIcons registers an icon provider for each prefix (e.g. "mdi") that
+// renders icons as "[mdi-battery]" instead of a font glyph. Call it before
+// using the Icon matcher.
+func FakeIcons(prefixes ...string) {
+	for _, p := range prefixes {
+		pango.AddIconProvider(p, fakeIcons(p))
+	}
+}
+
+// Icon checks that the segment at index shows the named icon (e.g.
+// "mdi-battery-50"). It needs FakeIcons for the icon's prefix.
+func Icon(index int, name string) OutputMatcher {
+	return func(segments []*bar.Segment) string {
+		s, msg := segmentAt(segments, index)
+		if s == nil {
+			return msg
+		}
+		if got := Text(s); !strings.Contains(got, "["+name+"]") {
+			return fmt.Sprintf("segment %d: text %q does not show icon %q", index, got, name)
+		}
+		return ""
+	}
+}
+
+// Dump renders an output as plain text, one line per segment, with the
+// visible text followed by the colour and urgency where they are set. It is
+// meant for comparing against golden files.
+func Dump(out bar.Output) string {
+	if out == nil {
+		return "<nil>\n"
+	}
+	var b strings.Builder
+	for _, s := range out.Segments() {
+		b.WriteString(Text(s))
+		if c, ok := s.GetColor(); ok && c != nil {
+			r, g, bl, _ := c.RGBA()
+			fmt.Fprintf(&b, " color=#%02x%02x%02x", r>>8, g>>8, bl>>8)
+		}
+		if urgent, ok := s.IsUrgent(); ok && urgent {
+			b.WriteString(" urgent")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
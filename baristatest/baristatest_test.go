@@ -0,0 +1,58 @@
+package baristatest
+
+import (
+	"errors"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/outputs"
+	"barista.run/pango"
+)
+
+func TestIcon(t *testing.T) {
+	FakeIcons("mdi")
+	out := outputs.Pango(pango.Icon("mdi-battery"), "42%")
+	AssertOutput(t, func(bar.Output) bar.Output { return out }, out,
+		Icon(0, "mdi-battery"), SegmentText(0, "[mdi-battery]42%"))
+	if msg := Icon(0, "mdi-wifi")(out.Segments()); msg == "" {
+		t.Error("Icon matched an icon the segment doesn't show")
+	}
+	if msg := Icon(1, "mdi-battery")(out.Segments()); msg == "" {
+		t.Error("Icon matched a missing segment")
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	red := colors.Hex("#ff0000")
+	out := outputs.Group(
+		outputs.Text("a").Color(red),
+		outputs.Errorf("b"),
+	)
+	AssertOutput(t, func(o bar.Output) bar.Output { return o }, bar.Output(out),
+		SegmentCount(2),
+		SegmentText(0, "a"),
+		Color(0, red),
+		Color(1, nil),
+		IsUrgent(1),
+		SegmentContains(1, "b"))
+	if msg := IsUrgent(0)(out.Segments()); msg == "" {
+		t.Error("IsUrgent matched a segment that isn't urgent")
+	}
+}
+
+func TestDump(t *testing.T) {
+	FakeIcons("mdi")
+	out := outputs.Group(
+		outputs.Pango(pango.Icon("mdi-wifi"), pango.Text("home & away").Bold()).
+			Color(colors.Hex("#50fa7b")),
+		outputs.Error(errors.New("down")),
+	)
+	want := "[mdi-wifi]home & away color=#50fa7b\ndown urgent\n"
+	if got := Dump(out); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := Dump(nil); got != "<nil>\n" {
+		t.Errorf("Dump(nil) = %q", got)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"testing"
+
+	"barista.run/modules/battery"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+// dischargingAt returns a discharging battery with pct percent left.
+func dischargingAt(pct int) battery.Info {
+	return battery.Info{
+		Status:     battery.Discharging,
+		EnergyNow:  float64(pct) / 2,
+		EnergyFull: 50,
+		Power:      10,
+	}
+}
+
+// schemeColor returns the named scheme colour, or nil for "".
+func schemeColor(name string) color.Color {
+	if name == "" {
+		return nil
+	}
+	return themeColor(name)
+}
+
+func TestBatteryThresholds(t *testing.T) {
+	out := batteryOutput(batteryThresholds{Urgent: 10, Bad: 30, Degraded: 60, Good: 90})
+	for _, tc := range []struct {
+		pct    int
+		urgent bool
+		color  string
+	}{
+		{pct: 5, urgent: true},
+		{pct: 10, urgent: true},
+		{pct: 11, color: "bad"},
+		{pct: 30, color: "bad"},
+		{pct: 31, color: "degraded"},
+		{pct: 60, color: "degraded"},
+		{pct: 61, color: "good"},
+		{pct: 90, color: "good"},
+		{pct: 91},
+	} {
+		matchers := []baristatest.OutputMatcher{baristatest.Color(0, schemeColor(tc.color))}
+		if tc.urgent {
+			matchers = append(matchers, baristatest.IsUrgent(0))
+		}
+		t.Run(fmt.Sprintf("%d%%", tc.pct), func(t *testing.T) {
+			baristatest.AssertOutput(t, out, dischargingAt(tc.pct), matchers...)
+		})
+	}
+}
+
+func TestBatteryThresholdsConfig(t *testing.T) {
+	defer func(f string) { thresholdsFile, thresholds = f, defaultThresholds }(thresholdsFile)
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		config string
+		want   batteryThresholds
+	}{
+		{`{"battery": {"urgent": 10, "bad": 30, "degraded": 60, "good": 90}}`,
+			batteryThresholds{10, 30, 60, 90}},
+		{`{"battery": {"urgent": 30, "bad": 10, "degraded": 60, "good": 90}}`,
+			defaultThresholds.Battery},
+		{`{"temp": {"urgent": 95, "bad": 85, "degraded": 75}}`,
+			defaultThresholds.Battery},
+	} {
+		thresholdsFile = writeTemp(t, dir, "thresholds.json", tc.config)
+		loadThresholdsConfig()
+		if thresholds.Battery != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.config, thresholds.Battery, tc.want)
+		}
+	}
+}
+
+func TestBatteryOutputGolden(t *testing.T) {
+	out := batteryOutput(defaultThresholds.Battery)
+	for _, tc := range []struct {
+		name string
+		info battery.Info
+	}{
+		{"discharging", battery.Info{
+			Status: battery.Discharging, EnergyNow: 21, EnergyFull: 50, Power: 8.4,
+		}},
+		{"charging", battery.Info{
+			Status: battery.Charging, EnergyNow: 40, EnergyFull: 50, Power: 25,
+		}},
+		{"empty", battery.Info{
+			Status: battery.Discharging, EnergyNow: 1, EnergyFull: 50, Power: 6,
+		}},
+		{"full", battery.Info{
+			Status: battery.Full, EnergyNow: 50, EnergyFull: 50,
+		}},
+		{"worn", battery.Info{
+			Status: battery.Discharging, EnergyNow: 30, EnergyFull: 37.5,
+			EnergyMax: 50, Power: 10,
+		}},
+		{"disconnected", battery.Info{Status: battery.Disconnected}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assertGolden(t, "battery-"+tc.name, baristatest.Dump(out(tc.info)))
+		})
+	}
+}
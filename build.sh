@@ -27,6 +27,7 @@ CONFIG_DIR="${XDG_CONFIG_HOME:-"$HOME/.config"}"
 # of $OWM_API_KEY.
 KEYS=(
 	'GITHUB_CLIENT_ID' 'GITHUB_CLIENT_SECRET' 'OWM_API_KEY'
+	'PIRATEWEATHER_API_KEY'
 )
 
 TARGET_FILE="$(pwd)/crystal_barista.go"
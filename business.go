@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type businessInfo struct {
+	// Phase is one of "before", "working", or "after".
+	Phase     string
+	Remaining time.Duration
+	Elapsed   time.Duration
+	Overtime  bool
+}
+
+// businessHours describes a working day from start to end (as offsets from
+// midnight) in loc.
+type businessHours struct {
+	start, end   time.Duration
+	loc          *time.Location
+	skipWeekends bool
+	holidays     map[string]bool
+}
+
+// business returns working hours from start to end each day, using only the
+// clock time of each. Weekends are days off by default.
+func business(start, end time.Time, tz *time.Location) *businessHours {
+	sinceMidnight := func(t time.Time) time.Duration {
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return &businessHours{
+		start:        sinceMidnight(start),
+		end:          sinceMidnight(end),
+		loc:          tz,
+		skipWeekends: true,
+		holidays:     map[string]bool{},
+	}
+}
+
+// WithWeekends sets whether Saturday and Sunday are days off.
+func (b *businessHours) WithWeekends(skip bool) *businessHours {
+	b.skipWeekends = skip
+	return b
+}
+
+// WithHolidays marks the given dates as days off.
+func (b *businessHours) WithHolidays(dates []time.Time) *businessHours {
+	for _, d := range dates {
+		b.holidays[d.Format("2006-01-02")] = true
+	}
+	return b
+}
+
+func (b *businessHours) workday(day time.Time) bool {
+	if b.skipWeekends && (day.Weekday() == time.Saturday || day.Weekday() == time.Sunday) {
+		return false
+	}
+	return !b.holidays[day.Format("2006-01-02")]
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// nextStart returns the start of the first working day after now.
+func (b *businessHours) nextStart(now time.Time) time.Time {
+	day := midnight(now)
+	for i := 0; i < 366; i++ {
+		if start := day.Add(b.start); start.After(now) && b.workday(day) {
+			return start
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// At returns the state of the working day at the given time.
+func (b *businessHours) At(now time.Time) businessInfo {
+	now = now.In(b.loc)
+	today := midnight(now)
+	start, end := today.Add(b.start), today.Add(b.end)
+	switch {
+	case b.workday(today) && !now.Before(start) && now.Before(end):
+		return businessInfo{
+			Phase:     "working",
+			Remaining: end.Sub(now),
+			Elapsed:   now.Sub(start),
+		}
+	case b.workday(today) && !now.Before(end):
+		return businessInfo{
+			Phase:     "after",
+			Remaining: b.nextStart(now).Sub(now),
+			Elapsed:   now.Sub(end),
+			Overtime:  true,
+		}
+	}
+	return businessInfo{Phase: "before", Remaining: b.nextStart(now).Sub(now)}
+}
+
+// formatHoursMinutes formats d as h:mm, with a day count if it's over 24h.
+func formatHoursMinutes(d time.Duration) string {
+	h, m, _ := hms(d)
+	if h >= 24 {
+		return fmt.Sprintf("%dd%d:%02d", h/24, h%24, m)
+	}
+	return fmt.Sprintf("%d:%02d", h, m)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/martinlindhe/unit"
+)
+
+// ibytesizeUnits are the binary units used by ibytesize, in order.
+var ibytesizeUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+type bytesizeOptions struct {
+	sigFigs int
+}
+
+// bytesizeOption customises ibytesize.
+type bytesizeOption func(*bytesizeOptions)
+
+// sigFigs sets the number of significant figures shown, e.g. 2 for
+// "1.2 GiB" instead of "1.23 GiB". Values that need more digits before the
+// decimal point, like "999 MiB", are still shown in full.
+func sigFigs(n int) bytesizeOption {
+	return func(o *bytesizeOptions) { o.sigFigs = n }
+}
+
+// ibytesize is like format.IBytesize, which always uses 3 significant
+// figures, but with options. Fewer figures keep the width of the bar
+// steadier as values change.
+func ibytesize(size unit.Datasize, opts ...bytesizeOption) string {
+	o := bytesizeOptions{sigFigs: 3}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	v := size.Bytes()
+	u := 0
+	for math.Abs(v) >= 1024 && u < len(ibytesizeUnits)-1 {
+		v /= 1024
+		u++
+	}
+	s := formatSigFigs(v, o.sigFigs, u > 0)
+	// Rounding can carry into the next unit, e.g. 1023.9 MiB to "1024".
+	if r, _ := strconv.ParseFloat(s, 64); math.Abs(r) >= 1024 && u < len(ibytesizeUnits)-1 {
+		u++
+		s = formatSigFigs(r/1024, o.sigFigs, true)
+	}
+	return s + " " + ibytesizeUnits[u]
+}
+
+// formatSigFigs formats v with n significant figures, but never drops
+// digits before the decimal point. Bytes are whole, so only get decimals
+// if fractional is set.
+func formatSigFigs(v float64, n int, fractional bool) string {
+	decimals := sigFigDecimals(v, n, fractional)
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	// Rounding can add a digit, e.g. 9.96 to "10.0" with 2 figures.
+	if r, _ := strconv.ParseFloat(s, 64); sigFigDecimals(r, n, fractional) < decimals {
+		s = strconv.FormatFloat(r, 'f', sigFigDecimals(r, n, fractional), 64)
+	}
+	return s
+}
+
+// sigFigDecimals returns how many decimals give v n significant figures.
+func sigFigDecimals(v float64, n int, fractional bool) int {
+	digits := 1
+	if a := math.Abs(v); a >= 1 {
+		digits = int(math.Log10(a)) + 1
+	}
+	decimals := n - digits
+	if decimals < 0 || !fractional {
+		decimals = 0
+	}
+	return decimals
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/martinlindhe/unit"
+)
+
+func TestIBytesize(t *testing.T) {
+	for _, tc := range []struct {
+		bytes      float64
+		two, three string
+	}{
+		{0, "0 B", "0 B"},
+		{512, "512 B", "512 B"},
+		{1023, "1023 B", "1023 B"},
+		{1024, "1.0 KiB", "1.00 KiB"},
+		{1.234 * (1 << 30), "1.2 GiB", "1.23 GiB"},
+		{12.34 * (1 << 30), "12 GiB", "12.3 GiB"},
+		{999 * (1 << 20), "999 MiB", "999 MiB"},
+		// Rounding adds a digit, which is dropped from the decimals.
+		{9.96 * (1 << 30), "10 GiB", "9.96 GiB"},
+		{99.96 * (1 << 30), "100 GiB", "100 GiB"},
+		// Rounding carries into the next unit.
+		{1023.9 * (1 << 20), "1.0 GiB", "1.00 GiB"},
+		{1.5 * (1 << 40), "1.5 TiB", "1.50 TiB"},
+	} {
+		size := unit.Datasize(tc.bytes) * unit.Byte
+		if got := ibytesize(size, sigFigs(2)); got != tc.two {
+			t.Errorf("ibytesize(%v B, sigFigs(2)) = %q, want %q", tc.bytes, got, tc.two)
+		}
+		if got := ibytesize(size); got != tc.three {
+			t.Errorf("ibytesize(%v B) = %q, want %q", tc.bytes, got, tc.three)
+		}
+	}
+}
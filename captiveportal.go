@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/netlink"
+	"barista.run/modules/static"
+)
+
+// captivePortalURL returns 204 No Content when there is a direct internet
+// connection. A captive portal answers it with a redirect or its own page.
+var captivePortalURL = "http://connectivitycheck.gstatic.com/generate_204"
+
+// captivePortalInterval is how long a check is trusted for, unless the
+// network changes first.
+var captivePortalInterval = 5 * time.Minute
+
+type captivePortalInfo struct {
+	Detected bool
+	// URL is the page to log in to the portal.
+	URL string
+}
+
+// checkCaptivePortal fetches captivePortalURL without following
+// redirects. ok is false if the check couldn't be made, e.g. offline.
+func checkCaptivePortal() (info captivePortalInfo, ok bool) {
+	client := httpClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Get(captivePortalURL)
+	if err != nil {
+		logDebugf("Captive portal check failed: %v", err)
+		return info, false
+	}
+	defer resp.Body.Close()
+	n, _ := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1))
+	if resp.StatusCode == http.StatusNoContent && n == 0 {
+		return info, true
+	}
+	info = captivePortalInfo{Detected: true, URL: captivePortalURL}
+	if loc, err := resp.Location(); err == nil {
+		info.URL = loc.String()
+	}
+	return info, true
+}
+
+// captivePortal warns when the network is behind a captive portal, and
+// checks again whenever the primary network link changes.
+type captivePortal struct {
+	out   *static.Module
+	check chan struct{}
+}
+
+func newCaptivePortal() *captivePortal {
+	return &captivePortal{out: static.New(nil), check: make(chan struct{}, 1)}
+}
+
+// Stream shows the warning while there's a portal.
+func (c *captivePortal) Stream(s bar.Sink) {
+	go c.watchLink()
+	go c.watch()
+	c.out.Stream(s)
+}
+
+func (c *captivePortal) watch() {
+	t := time.NewTicker(captivePortalInterval)
+	defer t.Stop()
+	for {
+		info, ok := checkCaptivePortal()
+		if ok {
+			c.out.Set(captivePortalOutput(info, c.Recheck))
+		}
+		select {
+		case <-c.check:
+		case <-t.C:
+		}
+	}
+}
+
+func (c *captivePortal) watchLink() {
+	sub := netlink.Any()
+	defer sub.Unsubscribe()
+	for {
+		<-sub.Next()
+		// Give DHCP and DNS a moment to settle on the new network.
+		time.Sleep(2 * time.Second)
+		c.Recheck()
+	}
+}
+
+// Recheck checks for a portal straight away, e.g. after logging in.
+func (c *captivePortal) Recheck() {
+	select {
+	case c.check <- struct{}{}:
+	default:
+	}
+}
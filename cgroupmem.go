@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"golang.org/x/sys/unix"
+)
+
+// cgroupMemPath is the cgroup whose memory pressure is shown in the
+// sysinfo detail, e.g. to watch a slice that workloads run in rather than
+// the whole system.
+var cgroupMemPath = "/sys/fs/cgroup/user.slice"
+
+// cgroupMemInterval is how often the pressure is read while the averages
+// shown are decaying, or all the time if a PSI trigger can't be set up.
+var cgroupMemInterval = 5 * time.Second
+
+// psiTrigger asks the kernel for a notification when tasks are stalled on
+// memory for 150ms within 2s. Unprivileged triggers need a window that is
+// a multiple of 2s.
+const psiTrigger = "some 150000 2000000"
+
+// psiLine is one line of a pressure stall information file: the
+// percentage of time that tasks were stalled, averaged over 10s, 60s and
+// 300s, and the total time stalled.
+type psiLine struct {
+	Avg10, Avg60, Avg300 float64
+	Total                time.Duration
+}
+
+type psiInfo struct {
+	// Some is the time at least one task was stalled on memory, and Full
+	// the time all non-idle tasks were.
+	Some, Full psiLine
+	// Path is the cgroup the pressure is for.
+	Path string
+}
+
+// parsePSI parses the contents of a pressure file, e.g.
+//
+//	some avg10=1.53 avg60=0.87 avg300=0.22 total=1234567
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePSI(data string) (psiInfo, bool) {
+	var info psiInfo
+	found := false
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var l psiLine
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "avg10":
+				l.Avg10, _ = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				l.Avg60, _ = strconv.ParseFloat(kv[1], 64)
+			case "avg300":
+				l.Avg300, _ = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				// In microseconds.
+				us, _ := strconv.ParseInt(kv[1], 10, 64)
+				l.Total = time.Duration(us) * time.Microsecond
+			}
+		}
+		switch fields[0] {
+		case "some":
+			info.Some, found = l, true
+		case "full":
+			info.Full = l
+		}
+	}
+	return info, found
+}
+
+// psiWaiter waits for a PSI trigger to fire.
+type psiWaiter interface {
+	// Wait returns when the trigger fires, after timeout unless it is
+	// negative, or once Wake is called.
+	Wait(timeout time.Duration) error
+	Wake()
+	Close()
+}
+
+// psiTriggerFile is a PSI trigger set up on a pressure file, with a pipe
+// to wake it for a refresh.
+type psiTriggerFile struct {
+	fd           int
+	wakeR, wakeW *os.File
+}
+
+// watchPSI sets up a PSI trigger on a pressure file, and is replaced in
+// tests.
+var watchPSI = func(path string) (psiWaiter, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	// Writing the trigger to any other file would just overwrite it.
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(fd, &st); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	if st.Type != unix.CGROUP2_SUPER_MAGIC && st.Type != unix.PROC_SUPER_MAGIC {
+		unix.Close(fd)
+		return nil, errors.New("not a PSI file")
+	}
+	if _, err := unix.Write(fd, []byte(psiTrigger+"\x00")); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return &psiTriggerFile{fd, r, w}, nil
+}
+
+func (p *psiTriggerFile) Wait(timeout time.Duration) error {
+	fds := []unix.PollFd{
+		{Fd: int32(p.fd), Events: unix.POLLPRI},
+		{Fd: int32(p.wakeR.Fd()), Events: unix.POLLIN},
+	}
+	ms := -1
+	if timeout >= 0 {
+		ms = int(timeout / time.Millisecond)
+	}
+	for {
+		_, err := unix.Poll(fds, ms)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+	if fds[0].Revents&unix.POLLERR != 0 {
+		// The cgroup has been removed.
+		return errors.New("PSI trigger removed")
+	}
+	if fds[1].Revents&unix.POLLIN != 0 {
+		var buf [64]byte
+		p.wakeR.Read(buf[:])
+	}
+	return nil
+}
+
+func (p *psiTriggerFile) Wake() {
+	p.wakeW.Write([]byte{0})
+}
+
+func (p *psiTriggerFile) Close() {
+	unix.Close(p.fd)
+	p.wakeR.Close()
+	p.wakeW.Close()
+}
+
+// cgroupMemPressure shows the memory pressure of a cgroup, from its
+// memory.pressure file (Linux 5.2+ with cgroup v2).
+type cgroupMemPressure struct {
+	path string
+}
+
+func newCgroupMemPressure() *cgroupMemPressure {
+	return &cgroupMemPressure{path: cgroupMemPath}
+}
+
+// WithCgroupPath sets the cgroup directory to read, e.g.
+// /sys/fs/cgroup/system.slice/docker.service.
+func (c *cgroupMemPressure) WithCgroupPath(path string) *cgroupMemPressure {
+	c.path = path
+	return c
+}
+
+// read reads and parses the cgroup's memory.pressure file.
+func (c *cgroupMemPressure) read() (psiInfo, bool) {
+	data, err := ioutil.ReadFile(filepath.Join(c.path, "memory.pressure"))
+	if err != nil {
+		return psiInfo{}, false
+	}
+	info, ok := parsePSI(string(data))
+	info.Path = c.path
+	return info, ok
+}
+
+func (c *cgroupMemPressure) output() bar.Output {
+	info, ok := c.read()
+	if !ok {
+		return nil
+	}
+	return cgroupMemOutput(info)
+}
+
+// Stream shows the pressure, or nothing if the kernel doesn't support
+// PSI or the cgroup doesn't exist. It's read again when a PSI trigger
+// fires, and every cgroupMemInterval only while the averages shown are
+// decaying back to zero. Without a trigger, e.g. if the pressure file
+// isn't writable, it's read every cgroupMemInterval.
+func (c *cgroupMemPressure) Stream(s bar.Sink) {
+	w, err := watchPSI(filepath.Join(c.path, "memory.pressure"))
+	if err != nil {
+		logDebugf("No PSI trigger for %s, reading it every %v: %v", c.path, cgroupMemInterval, err)
+		pollEvery(cgroupMemInterval, func(s bar.Sink) {
+			s.Output(c.output())
+		}).Stream(s)
+		return
+	}
+	defer w.Close()
+	onRefresh(w.Wake)
+	for {
+		info, ok := c.read()
+		timeout := time.Duration(-1)
+		if !ok {
+			s.Output(nil)
+		} else {
+			s.Output(cgroupMemOutput(info))
+			if info.Some.Avg10 > 0 || info.Some.Avg60 > 0 || info.Full.Avg10 > 0 {
+				timeout = cgroupMemInterval
+			}
+		}
+		if err := w.Wait(timeout); err != nil {
+			logWarnf("Stopped watching the memory pressure of %s: %v", c.path, err)
+			s.Output(nil)
+			return
+		}
+	}
+}
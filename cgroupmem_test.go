@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/meminfo"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+func TestParsePSI(t *testing.T) {
+	info, ok := parsePSI("some avg10=1.53 avg60=0.87 avg300=0.22 total=1234567\n" +
+		"full avg10=0.50 avg60=0.25 avg300=0.10 total=89\n")
+	want := psiInfo{
+		Some: psiLine{1.53, 0.87, 0.22, 1234567 * time.Microsecond},
+		Full: psiLine{0.5, 0.25, 0.1, 89 * time.Microsecond},
+	}
+	if !ok || info != want {
+		t.Errorf("got %+v, %v, want %+v", info, ok, want)
+	}
+
+	// Older kernels have no full line for some resources.
+	info, ok = parsePSI("some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+	if !ok || info != (psiInfo{}) {
+		t.Errorf("some only: got %+v, %v", info, ok)
+	}
+
+	for _, data := range []string{"", "\n", "full avg10=1.00 avg60=1.00 avg300=1.00 total=1\n"} {
+		if _, ok := parsePSI(data); ok {
+			t.Errorf("parsePSI(%q) found a some line", data)
+		}
+	}
+}
+
+// assertPressure checks that o shows the some avg10 pressure want.
+func assertPressure(t *testing.T, o bar.Output, want string) {
+	t.Helper()
+	if o == nil {
+		t.Errorf("nothing shown, want %s", want)
+		return
+	}
+	baristatest.AssertOutput(t, func(o bar.Output) bar.Output { return o }, o,
+		baristatest.SegmentContains(0, want))
+}
+
+// fakePSIWaiter fires when sent to, and records the timeouts waited with.
+type fakePSIWaiter struct {
+	fire     chan error
+	timeouts chan time.Duration
+}
+
+func (f *fakePSIWaiter) Wait(timeout time.Duration) error {
+	f.timeouts <- timeout
+	return <-f.fire
+}
+func (f *fakePSIWaiter) Wake()  {}
+func (f *fakePSIWaiter) Close() {}
+
+func TestCgroupMemTrigger(t *testing.T) {
+	dir := t.TempDir()
+	writeTemp(t, dir, "memory.pressure", "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+	w := &fakePSIWaiter{fire: make(chan error), timeouts: make(chan time.Duration)}
+	defer func(f func(string) (psiWaiter, error)) { watchPSI = f }(watchPSI)
+	var watched string
+	watchPSI = func(path string) (psiWaiter, error) {
+		watched = path
+		return w, nil
+	}
+
+	outs := make(chan bar.Output, 10)
+	go newCgroupMemPressure().WithCgroupPath(dir).Stream(func(o bar.Output) { outs <- o })
+	next := func() bar.Output {
+		t.Helper()
+		select {
+		case o := <-outs:
+			return o
+		case <-time.After(time.Second):
+			t.Fatal("no output")
+			return nil
+		}
+	}
+	assertPressure(t, next(), "0%")
+	if watched != filepath.Join(dir, "memory.pressure") {
+		t.Errorf("watched %s", watched)
+	}
+	// Without pressure there's nothing to read again until the trigger fires.
+	if got := <-w.timeouts; got >= 0 {
+		t.Errorf("waiting %v without pressure, want no timeout", got)
+	}
+
+	writeTemp(t, dir, "memory.pressure", "some avg10=42.00 avg60=10.00 avg300=2.00 total=100\n")
+	w.fire <- nil
+	assertPressure(t, next(), "42%")
+	// The averages decay without the trigger firing again.
+	if got := <-w.timeouts; got != cgroupMemInterval {
+		t.Errorf("waiting %v under pressure, want %v", got, cgroupMemInterval)
+	}
+
+	// The cgroup going away stops the module.
+	w.fire <- errors.New("PSI trigger removed")
+	if o := next(); o != nil {
+		t.Errorf("still showing %v after the trigger was removed", o)
+	}
+}
+
+func TestCgroupMemFallback(t *testing.T) {
+	defer func(d time.Duration) { cgroupMemInterval = d }(cgroupMemInterval)
+	cgroupMemInterval = 10 * time.Millisecond
+
+	// A regular file isn't a PSI file, so it can't take a trigger and is
+	// read on a timer instead, without being overwritten.
+	dir := t.TempDir()
+	pressure := "some avg10=7.00 avg60=3.00 avg300=1.00 total=100\n"
+	path := writeTemp(t, dir, "memory.pressure", pressure)
+	if _, err := watchPSI(path); err == nil {
+		t.Fatal("set a PSI trigger on a regular file")
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != pressure {
+		t.Fatalf("overwrote the file with %q", data)
+	}
+	outs := make(chan bar.Output, 10)
+	go newCgroupMemPressure().WithCgroupPath(dir).Stream(func(o bar.Output) { outs <- o })
+	for i := 0; i < 2; i++ {
+		select {
+		case o := <-outs:
+			assertPressure(t, o, "7%")
+		case <-time.After(time.Second):
+			t.Fatal("not read on a timer")
+		}
+	}
+
+	// Without PSI or the cgroup, nothing is shown.
+	missing := make(chan bar.Output, 10)
+	go newCgroupMemPressure().WithCgroupPath(filepath.Join(dir, "gone")).
+		Stream(func(o bar.Output) { missing <- o })
+	select {
+	case o := <-missing:
+		if o != nil {
+			t.Errorf("showing %v for a missing cgroup", o)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no output for a missing cgroup")
+	}
+}
+
+func TestCgroupMemIcon(t *testing.T) {
+	// The system memory segment uses mdi-memory, so the cgroup one needs
+	// its own icon to tell them apart.
+	baristatest.AssertOutput(t, cgroupMemOutput, psiInfo{Path: "/sys/fs/cgroup/user.slice"},
+		baristatest.Icon(0, "mdi-package-variant"))
+	baristatest.AssertOutput(t, freeMemOutput, meminfo.Info{},
+		baristatest.Icon(0, "mdi-memory"))
+}
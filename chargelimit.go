@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// batteryChargeLimitAware shows a battery that's stopped charging at its
+// charge limit as full, rather than as partly charged. It's off by default
+// since it reads sysfs on every battery update.
+var batteryChargeLimitAware = false
+
+// chargeLimitGlob matches the charge limits set for each battery, e.g. by
+// TLP or the vendor's tools.
+var chargeLimitGlob = "/sys/class/power_supply/*/charge_control_end_threshold"
+
+// batteryChargeLimit returns the lowest charge limit of any battery as a
+// percentage, and false if none is set.
+func batteryChargeLimit() (int, bool) {
+	paths, _ := filepath.Glob(chargeLimitGlob)
+	limit, ok := 100, false
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || v <= 0 || v >= 100 {
+			continue
+		}
+		if v < limit {
+			limit, ok = v, true
+		}
+	}
+	return limit, ok
+}
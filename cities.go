@@ -0,0 +1,76 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed cities.csv
+var citiesCSV string
+
+type city struct {
+	Name     string
+	Lat, Lng float64
+}
+
+var parsedCities struct {
+	once sync.Once
+	list []city
+}
+
+// cities returns the embedded city list, with names of the form
+// "Copenhagen, Denmark". It's parsed on first use.
+func cities() []city {
+	parsedCities.once.Do(func() {
+		rows, err := csv.NewReader(strings.NewReader(citiesCSV)).ReadAll()
+		if err != nil {
+			logFatalf("Bad embedded cities.csv: %v", err)
+		}
+		for _, row := range rows[1:] {
+			lat, _ := strconv.ParseFloat(row[2], 64)
+			lng, _ := strconv.ParseFloat(row[3], 64)
+			parsedCities.list = append(parsedCities.list,
+				city{Name: row[0] + ", " + row[1], Lat: lat, Lng: lng})
+		}
+	})
+	return parsedCities.list
+}
+
+// cityCoords looks up the coordinates of a well-known city. The name is
+// matched case-insensitively against "City, Country" or just "City", and
+// may be partial as long as only one city matches. Names shared by cities
+// in different countries, like Newcastle, need the country.
+func cityCoords(name string) (lat, lng float64, err error) {
+	query := strings.ToLower(strings.TrimSpace(name))
+	if query == "" {
+		return 0, 0, fmt.Errorf("no city given")
+	}
+	var exact, matches []city
+	for _, c := range cities() {
+		full := strings.ToLower(c.Name)
+		if full == query || strings.HasPrefix(full, query+",") {
+			exact = append(exact, c)
+		}
+		if strings.Contains(full, query) {
+			matches = append(matches, c)
+		}
+	}
+	if len(exact) > 0 {
+		matches = exact
+	}
+	switch len(matches) {
+	case 0:
+		return 0, 0, fmt.Errorf("unknown city %q", name)
+	case 1:
+		return matches[0].Lat, matches[0].Lng, nil
+	}
+	var names []string
+	for _, c := range matches {
+		names = append(names, c.Name)
+	}
+	return 0, 0, fmt.Errorf("city %q is ambiguous: %s", name, strings.Join(names, "; "))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCities(t *testing.T) {
+	all := cities()
+	if len(all) < 500 {
+		t.Errorf("only %d cities", len(all))
+	}
+	seen := map[string]bool{}
+	for _, c := range all {
+		if seen[c.Name] {
+			t.Errorf("%s listed twice", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Lat < -90 || c.Lat > 90 || c.Lng < -180 || c.Lng > 180 || (c.Lat == 0 && c.Lng == 0) {
+			t.Errorf("%s: bad coordinates %v, %v", c.Name, c.Lat, c.Lng)
+		}
+	}
+}
+
+func TestCityCoords(t *testing.T) {
+	for _, tc := range []struct {
+		query    string
+		lat, lng float64
+		err      string
+	}{
+		{query: "Tokyo, Japan", lat: 35.6895, lng: 139.6917},
+		{query: "tokyo", lat: 35.6895, lng: 139.6917},
+		{query: "  Tromsø ", lat: 69.6492, lng: 18.9553},
+		{query: "Victoria, Seychelles", lat: -4.6191, lng: 55.4513},
+		{query: "Queenstown", lat: -45.0312, lng: 168.6626},
+		{query: "Atlantis", err: `unknown city "Atlantis"`},
+		{query: "", err: "no city given"},
+		{query: "Newcastle", err: "ambiguous"},
+		{query: "newcastle", err: "Newcastle, United Kingdom; Newcastle, Australia"},
+		{query: "Newcastle, Australia", lat: -32.9283, lng: 151.7817},
+		{query: "Valencia", err: "ambiguous"},
+		{query: "Valencia, Spain", lat: 39.4699, lng: -0.3763},
+		{query: "Victoria", err: "ambiguous"},
+	} {
+		lat, lng, err := cityCoords(tc.query)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("cityCoords(%q): got %v, want error %q", tc.query, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || lat != tc.lat || lng != tc.lng {
+			t.Errorf("cityCoords(%q) = %v, %v, %v, want %v, %v", tc.query, lat, lng, err, tc.lat, tc.lng)
+		}
+	}
+}
+
+func TestWhereamiUnknownCity(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"latitude": 55.6759, "longitude": 12.5655}`)
+	}))
+	defer srv.Close()
+	defer func(u string) { geoipURL = u }(geoipURL)
+	geoipURL = srv.URL
+
+	defer os.Unsetenv("BARISTA_CITY")
+	os.Setenv("BARISTA_CITY", "Lisbon")
+	if lat, lng, err := whereami(); err != nil || lat != 38.7223 || lng != -9.1393 {
+		t.Errorf("known city: got %v, %v, %v", lat, lng, err)
+	}
+	os.Setenv("BARISTA_CITY", "Atlantis")
+	if lat, lng, err := whereami(); err != nil || lat != 55.6759 || lng != 12.5655 {
+		t.Errorf("unknown city: got %v, %v, %v, want the geolocated position", lat, lng, err)
+	}
+}
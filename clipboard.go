@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/funcs"
+)
+
+// clipboardInterval is how often the clipboard history is counted. It only
+// changes when something is copied, so there's no need to be quick.
+var clipboardInterval = 30 * time.Second
+
+// clipboardManager is a clipboard history daemon that can be counted and
+// opened from the bar.
+type clipboardManager struct {
+	Name string
+	// Count returns the number of entries in the history. ok is false if
+	// the manager isn't in use.
+	Count func() (n int, ok bool)
+	// Picker opens the history to pick an entry from.
+	Picker []string
+}
+
+// clipboardManagers are tried in order, and the first one in use is shown.
+var clipboardManagers = []clipboardManager{
+	{
+		Name: "greenclip",
+		Count: func() (int, bool) {
+			if quickRun("pgrep", "-x", "greenclip") != nil {
+				return 0, false
+			}
+			out, err := quickOutput("greenclip", "print")
+			if err != nil {
+				return 0, false
+			}
+			return countLines(string(out)), true
+		},
+		Picker: []string{"rofi", "-modi", "clipboard:greenclip print", "-show", "clipboard"},
+	},
+	{
+		Name: "clipman",
+		Count: func() (int, bool) {
+			if _, err := exec.LookPath("clipman"); err != nil {
+				return 0, false
+			}
+			data, err := ioutil.ReadFile(home(".local/share/clipman.json"))
+			if err != nil {
+				return 0, false
+			}
+			var history []string
+			if json.Unmarshal(data, &history) != nil {
+				return 0, false
+			}
+			return len(history), true
+		},
+		Picker: []string{"clipman", "pick", "--tool", "rofi"},
+	},
+}
+
+func countLines(s string) int {
+	n := 0
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// openPicker starts the manager's history picker.
+func (c clipboardManager) openPicker() {
+	cmd := exec.Command(c.Picker[0], c.Picker[1:]...)
+	if err := cmd.Start(); err != nil {
+		logWarnf("Could not open %s history: %v", c.Name, err)
+		return
+	}
+	go cmd.Wait()
+}
+
+// newClipboardModule shows the number of entries in the clipboard history,
+// opening the picker on click.
+func newClipboardModule() *funcs.RepeatingModule {
+	return pollEvery(clipboardInterval, func(s bar.Sink) {
+		for _, c := range clipboardManagers {
+			if n, ok := c.Count(); ok {
+				s.Output(clipboardOutput(c, n))
+				return
+			}
+		}
+		s.Output(nil)
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/modules/static"
+	"barista.run/outputs"
+	"barista.run/pango"
+)
+
+// colorPickCmds print the hex colour of a point picked on screen, for X11
+// and Wayland respectively.
+var colorPickCmds = struct{ X11, Wayland []string }{
+	X11: []string{"sh", "-c",
+		`maim --select --tolerance=0 | convert - -resize '1x1!' -format '%[hex:p{0,0}]' info:-`},
+	Wayland: []string{"sh", "-c",
+		`grim -g "$(slurp -p)" -t ppm - | convert - -format '%[hex:p{0,0}]' info:-`},
+}
+
+// colorPickerDisplayTime is how long a picked colour stays in the bar.
+var colorPickerDisplayTime = 30 * time.Second
+
+// colorHistoryFile stores the most recently picked colours.
+var colorHistoryFile = home(".cache/barista/colors.json")
+
+const colorHistorySize = 10
+
+var hexColorRe = regexp.MustCompile(`[0-9A-Fa-f]{6}`)
+
+// colorPicker picks a colour from the screen on left click, copies it to
+// the clipboard, and shows it for a while. Scrolling cycles through
+// recently picked colours. It shows only an icon while idle, since there'd
+// be nothing to click otherwise.
+type colorPicker struct {
+	out       *static.Module
+	wayland   bool
+	clipboard []string
+	mu        sync.Mutex
+	history   []string
+	selected  int
+	idleAt    *time.Timer
+}
+
+func newColorPicker() *colorPicker {
+	p := &colorPicker{
+		out:     static.New(nil),
+		wayland: os.Getenv("WAYLAND_DISPLAY") != "",
+	}
+	if _, err := exec.LookPath("wl-copy"); err == nil && p.wayland {
+		p.clipboard = []string{"wl-copy"}
+	} else if _, err := exec.LookPath("xclip"); err == nil {
+		p.clipboard = []string{"xclip", "-selection", "clipboard"}
+	}
+	if data, err := ioutil.ReadFile(colorHistoryFile); err == nil {
+		json.Unmarshal(data, &p.history)
+	}
+	p.idle()
+	return p
+}
+
+// Stream shows the picker.
+func (p *colorPicker) Stream(s bar.Sink) {
+	p.out.Stream(s)
+}
+
+func (p *colorPicker) idle() {
+	p.out.Set(outputs.Pango(pango.Icon("mdi-eyedropper")).OnClick(p.Click))
+}
+
+// Click picks a new colour on left click, and cycles through the history
+// on scroll.
+func (p *colorPicker) Click(e bar.Event) {
+	switch e.Button {
+	case bar.ButtonLeft:
+		go p.pick()
+	case bar.ScrollUp, bar.ScrollDown:
+		p.mu.Lock()
+		if len(p.history) > 0 {
+			delta := 1
+			if e.Button == bar.ScrollDown {
+				delta = len(p.history) - 1
+			}
+			p.selected = (p.selected + delta) % len(p.history)
+		}
+		p.mu.Unlock()
+		p.show()
+	}
+}
+
+func (p *colorPicker) pick() {
+	cmd := colorPickCmds.X11
+	if p.wayland {
+		cmd = colorPickCmds.Wayland
+	}
+	out, err := exec.Command(cmd[0], cmd[1:]...).Output()
+	if err != nil {
+		// Most likely the selection was cancelled.
+		return
+	}
+	hex := hexColorRe.FindString(string(out))
+	if hex == "" {
+		return
+	}
+	hex = "#" + strings.ToUpper(hex)
+	p.copy(hex)
+	p.mu.Lock()
+	p.history = append([]string{hex}, p.history...)
+	if len(p.history) > colorHistorySize {
+		p.history = p.history[:colorHistorySize]
+	}
+	p.selected = 0
+	p.saveHistory()
+	p.mu.Unlock()
+	p.show()
+}
+
+func (p *colorPicker) copy(hex string) {
+	if len(p.clipboard) == 0 {
+		return
+	}
+	cmd := exec.Command(p.clipboard[0], p.clipboard[1:]...)
+	cmd.Stdin = strings.NewReader(hex)
+	if cmd.Start() == nil {
+		go cmd.Wait()
+	}
+}
+
+// saveHistory writes the history to disk. mu must be held.
+func (p *colorPicker) saveHistory() {
+	data, err := json.Marshal(p.history)
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(colorHistoryFile), 0755) == nil {
+		ioutil.WriteFile(colorHistoryFile, data, 0644)
+	}
+}
+
+// show displays the selected colour until colorPickerDisplayTime passes
+// without any further clicks.
+func (p *colorPicker) show() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.history) == 0 {
+		return
+	}
+	hex := p.history[p.selected]
+	p.out.Set(outputs.Pango(
+		pango.Text("██").Color(colors.Hex(hex)).Background(colors.Hex(hex)),
+		spacer, pango.Text(hex),
+	).OnClick(p.Click))
+	if p.idleAt != nil {
+		p.idleAt.Stop()
+	}
+	p.idleAt = time.AfterFunc(colorPickerDisplayTime, p.idle)
+}
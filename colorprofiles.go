@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/colors"
+	"barista.run/modules/static"
+	"barista.run/outputs"
+	"barista.run/pango"
+)
+
+// colorProfilesDir holds colour profiles, each a JSON object of scheme
+// names to hex colours, e.g. {"good": "#50FA7B", "bad": "#FF5555"}.
+var colorProfilesDir = configDir("colors")
+
+var colorProfileMu sync.Mutex
+var currentColorProfile string
+
+// theme is a snapshot of the scheme colours. The current one is replaced
+// as a whole, so that an output never mixes colours from two profiles, and
+// is never read while the scheme is half way through being changed.
+type theme map[string]colors.ColorfulColor
+
+var (
+	themeMu      sync.Mutex
+	themeNames   = map[string]bool{"background": true, "statusline": true, "bad": true, "degraded": true, "good": true}
+	currentTheme atomic.Value // theme
+)
+
+// themeColor returns the named colour from the current theme.
+func themeColor(name string) colors.ColorfulColor {
+	t, _ := currentTheme.Load().(theme)
+	return t[name]
+}
+
+// setThemeColor sets a scheme colour. It must only be called from the
+// function passed to updateTheme.
+func setThemeColor(name string, c colors.ColorfulColor) {
+	themeNames[name] = true
+	colors.Set(name, c)
+}
+
+// updateTheme calls change to set the scheme colours, then publishes the
+// new theme and refreshes every module with it.
+func updateTheme(change func()) {
+	themeMu.Lock()
+	change()
+	t := theme{}
+	for name := range themeNames {
+		if c := colors.Scheme(name); c != nil {
+			t[name] = c
+		}
+	}
+	currentTheme.Store(t)
+	themeChanged()
+	themeMu.Unlock()
+	refreshModules()
+}
+
+// loadColorProfile reads the named profile from colorProfilesDir.
+func loadColorProfile(name string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(colorProfilesDir, name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var scheme map[string]string
+	if err := json.Unmarshal(data, &scheme); err != nil {
+		return nil, err
+	}
+	return scheme, nil
+}
+
+// switchColorProfile applies the named profile on top of the current
+// colours.
+func switchColorProfile(name string) error {
+	scheme, err := loadColorProfile(name)
+	if err != nil {
+		return err
+	}
+	updateTheme(func() {
+		applyColorProfile(scheme)
+		colorProfileMu.Lock()
+		currentColorProfile = name
+		colorProfileMu.Unlock()
+	})
+	return nil
+}
+
+func applyColorProfile(scheme map[string]string) {
+	for k, v := range scheme {
+		setThemeColor(k, colors.Hex(v))
+	}
+}
+
+// reapplyColorProfile applies the current profile again, e.g. after the
+// bar config colours have been reloaded. Like setThemeColor, it must only
+// be called from the function passed to updateTheme.
+func reapplyColorProfile() {
+	colorProfileMu.Lock()
+	name := currentColorProfile
+	colorProfileMu.Unlock()
+	if name == "" {
+		return
+	}
+	scheme, err := loadColorProfile(name)
+	if err != nil {
+		logWarnf("Could not reapply colour profile %s: %v", name, err)
+		return
+	}
+	applyColorProfile(scheme)
+}
+
+// colorProfileNames lists the profiles in colorProfilesDir.
+func colorProfileNames() []string {
+	files, _ := filepath.Glob(filepath.Join(colorProfilesDir, "*.json"))
+	var names []string
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(f), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// colorProfileSwitcher lists the available profiles, switching to one when
+// it's clicked.
+type colorProfileSwitcher struct {
+	out *static.Module
+}
+
+func newColorProfileSwitcher() *colorProfileSwitcher {
+	s := &colorProfileSwitcher{out: static.New(nil)}
+	s.update()
+	return s
+}
+
+func (s *colorProfileSwitcher) update() {
+	names := colorProfileNames()
+	if len(names) == 0 {
+		s.out.Set(nil)
+		return
+	}
+	colorProfileMu.Lock()
+	current := currentColorProfile
+	colorProfileMu.Unlock()
+	out := outputs.Group()
+	for _, name := range names {
+		name := name
+		icon := "mdi-palette-outline"
+		if name == current {
+			icon = "mdi-palette"
+		}
+		out.Append(outputs.Pango(pango.Icon(icon), spacer, pango.Text(name)).
+			OnClick(click.Left(func() {
+				if err := switchColorProfile(name); err != nil {
+					s.out.Set(outputs.Errorf("%s: %v", name, err))
+					return
+				}
+				s.update()
+			})))
+	}
+	s.out.Set(out)
+}
+
+// Stream shows the profiles.
+func (s *colorProfileSwitcher) Stream(sink bar.Sink) {
+	s.out.Stream(sink)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"barista.run/colors"
+)
+
+func TestSwitchColorProfileRace(t *testing.T) {
+	dir := t.TempDir()
+	writeTemp(t, dir, "day.json", `{"good": "#111111", "bad": "#222222"}`)
+	writeTemp(t, dir, "night.json", `{"good": "#333333", "bad": "#444444"}`)
+	defer func(d string) { colorProfilesDir = d }(colorProfilesDir)
+	colorProfilesDir = dir
+	defer func() {
+		colorProfileMu.Lock()
+		currentColorProfile = ""
+		colorProfileMu.Unlock()
+		updateTheme(func() { colors.LoadFromMap(testColors) })
+	}()
+
+	restoreRefreshers(t)
+	var refreshes int32
+	onRefresh(func() { atomic.AddInt32(&refreshes, 1) })
+	generation := atomic.LoadInt32(&themeGeneration)
+
+	pairs := map[string]string{"#111111": "#222222", "#333333": "#444444"}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				th, _ := currentTheme.Load().(theme)
+				good, bad := th["good"].Colorful().Hex(), th["bad"].Colorful().Hex()
+				if want, ok := pairs[good]; ok && bad != want {
+					t.Errorf("mixed profiles: good %s with bad %s", good, bad)
+					return
+				}
+				themeColor("degraded")
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		name := "day"
+		if i%2 == 1 {
+			name = "night"
+		}
+		if err := switchColorProfile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if got := themeColor("good").Colorful().Hex(); got != "#333333" {
+		t.Errorf("good is %s after switching to night", got)
+	}
+	if got := themeColor("degraded").Colorful().Hex(); got != testColors["degraded"] {
+		t.Errorf("degraded is %s, want it kept from before", got)
+	}
+	if got := atomic.LoadInt32(&refreshes); got != 100 {
+		t.Errorf("%d refreshes, want one per switch", got)
+	}
+	if atomic.LoadInt32(&themeGeneration) == generation {
+		t.Error("theme generation unchanged")
+	}
+	if err := switchColorProfile("missing"); err == nil {
+		t.Error("no error for a missing profile")
+	}
+}
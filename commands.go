@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+)
+
+// commandsFile defines custom status segments built from the output of
+// shell commands, e.g.
+//
+//	[{"name": "backlog", "command": "todo count", "interval": "5m",
+//	  "icon": "mdi-format-list-checks", "regex": "(\\d+) open",
+//	  "thresholds": {"degraded": "> 20", "bad": "> 50"}}]
+//
+// Each is added to the top-level modules under its name, so it must also
+// be listed in the layout file to be shown. Commands that take longer than
+// execTimeout are killed.
+var commandsFile = configDir("commands.json")
+
+// defaultCommandInterval is used for commands without an interval.
+const defaultCommandInterval = time.Minute
+
+type commandConfig struct {
+	Name     string `json:"name"`
+	Command  string `json:"command"`
+	Interval string `json:"interval"`
+	Icon     string `json:"icon"`
+	// Regex extracts the text to show from the output: the first capture
+	// group if there is one, otherwise the whole match. Without it, the
+	// first line of output is shown.
+	Regex string `json:"regex"`
+	// Thresholds colour the segment when the extracted text is a number
+	// matching a rule like "> 90" or "<= 10".
+	Thresholds map[string]string `json:"thresholds"`
+}
+
+var thresholdRuleRe = regexp.MustCompile(`^\s*(<=|>=|<|>|==)\s*(-?[0-9.]+)\s*$`)
+
+// thresholdRule checks a number against a rule like "> 90".
+type thresholdRule func(float64) bool
+
+func parseThresholdRule(rule string) (thresholdRule, error) {
+	m := thresholdRuleRe.FindStringSubmatch(rule)
+	if m == nil {
+		return nil, fmt.Errorf("bad threshold %q", rule)
+	}
+	limit, err := strconv.ParseFloat(m[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad threshold %q: %v", rule, err)
+	}
+	switch m[1] {
+	case "<":
+		return func(v float64) bool { return v < limit }, nil
+	case "<=":
+		return func(v float64) bool { return v <= limit }, nil
+	case ">":
+		return func(v float64) bool { return v > limit }, nil
+	case ">=":
+		return func(v float64) bool { return v >= limit }, nil
+	}
+	return func(v float64) bool { return v == limit }, nil
+}
+
+// commandSegment is a parsed commandConfig.
+type commandSegment struct {
+	icon     string
+	interval time.Duration
+	regex    *regexp.Regexp
+	rules    map[string]thresholdRule
+}
+
+func parseCommandConfig(c commandConfig) (commandSegment, error) {
+	seg := commandSegment{icon: c.Icon, interval: defaultCommandInterval}
+	if c.Name == "" || c.Command == "" {
+		return seg, fmt.Errorf("commands need a name and a command")
+	}
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return seg, fmt.Errorf("%s: %v", c.Name, err)
+		}
+		seg.interval = d
+	}
+	if c.Regex != "" {
+		re, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return seg, fmt.Errorf("%s: %v", c.Name, err)
+		}
+		seg.regex = re
+	}
+	seg.rules = map[string]thresholdRule{}
+	for level, rule := range c.Thresholds {
+		switch level {
+		case "urgent", "bad", "degraded", "good":
+		default:
+			return seg, fmt.Errorf("%s: unknown threshold %q", c.Name, level)
+		}
+		r, err := parseThresholdRule(rule)
+		if err != nil {
+			return seg, fmt.Errorf("%s: %v", c.Name, err)
+		}
+		seg.rules[level] = r
+	}
+	return seg, nil
+}
+
+// extract picks the text to show from the command's output. ok is false if
+// the regex doesn't match.
+func (c commandSegment) extract(stdout string) (text string, ok bool) {
+	if c.regex == nil {
+		return strings.SplitN(stdout, "\n", 2)[0], true
+	}
+	m := c.regex.FindStringSubmatch(stdout)
+	switch {
+	case m == nil:
+		return "", false
+	case len(m) > 1:
+		return m[1], true
+	}
+	return m[0], true
+}
+
+// thresholds applies the rules to text, if it's a number.
+func (c commandSegment) thresholds(text string) thresholdConfig {
+	v, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return thresholdConfig{}
+	}
+	check := func(level string) bool {
+		r, ok := c.rules[level]
+		return ok && r(v)
+	}
+	return thresholdConfig{
+		Urgent:   check("urgent"),
+		Bad:      check("bad"),
+		Degraded: check("degraded"),
+		Good:     check("good"),
+	}
+}
+
+// loadCommandModules builds a module for each command in commandsFile,
+// keyed by name. Commands are run with sh, so they can use pipes.
+func loadCommandModules() map[string]bar.Module {
+	data, err := ioutil.ReadFile(commandsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	var configs []commandConfig
+	if err == nil {
+		err = json.Unmarshal(data, &configs)
+	}
+	if err != nil {
+		logWarnf("Ignoring %s: %v", commandsFile, err)
+		return nil
+	}
+	modules := map[string]bar.Module{}
+	for _, c := range configs {
+		seg, err := parseCommandConfig(c)
+		if err != nil {
+			logWarnf("Skipping command in %s: %v", commandsFile, err)
+			continue
+		}
+		modules[c.Name] = newShellWithStderr("sh", "-c", c.Command).
+			Every(seg.interval).
+			Output(func(stdout, stderr string) bar.Output {
+				return commandOutput(seg, stdout, stderr)
+			})
+	}
+	return modules
+}
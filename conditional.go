@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"barista.run/bar"
+)
+
+// conditionalModule passes on the outputs of a module only while a
+// predicate holds.
+type conditionalModule struct {
+	module    bar.Module
+	predicate func() bool
+	mu        sync.Mutex
+}
+
+// conditional wraps m so that it's hidden whenever predicate returns false.
+// The predicate is checked each time m produces output, one call at a time,
+// so it may read state without further locking.
+func conditional(m bar.Module, predicate func() bool) bar.Module {
+	return &conditionalModule{module: m, predicate: predicate}
+}
+
+// Stream streams the wrapped module, replacing its output with nil while
+// the predicate is false.
+func (c *conditionalModule) Stream(s bar.Sink) {
+	c.module.Stream(func(o bar.Output) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.predicate() {
+			o = nil
+		}
+		s.Output(o)
+	})
+}
+
+// showDuring hides m outside the daily window from start until end. Only
+// the time of day is used, and the window wraps past midnight if end is
+// earlier than start.
+func showDuring(m bar.Module, start, end time.Time) bar.Module {
+	return conditional(m, func() bool {
+		return inDailyWindow(time.Now(), start, end)
+	})
+}
+
+func inDailyWindow(now, start, end time.Time) bool {
+	tod := clockOffset(now)
+	from, until := clockOffset(start), clockOffset(end)
+	if from <= until {
+		return tod >= from && tod < until
+	}
+	return tod >= from || tod < until
+}
+
+// clockOffset returns how far into its day t is.
+func clockOffset(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+func TestConditional(t *testing.T) {
+	var show, calls int32
+	sends := []bar.Output{outputs.Text("a"), outputs.Text("b"), outputs.Text("c"), outputs.Text("d")}
+	m := conditional(moduleFunc(func(s bar.Sink) {
+		for i, o := range sends {
+			// The predicate changes between the second and third outputs.
+			if i == 2 {
+				atomic.StoreInt32(&show, 1)
+			}
+			s.Output(o)
+		}
+	}), func() bool {
+		atomic.AddInt32(&calls, 1)
+		return atomic.LoadInt32(&show) == 1
+	})
+
+	var got []bar.Output
+	m.Stream(func(o bar.Output) { got = append(got, o) })
+	if len(got) != len(sends) {
+		t.Fatalf("got %d outputs, want %d", len(got), len(sends))
+	}
+	for i := 0; i < 2; i++ {
+		if got[i] != nil {
+			t.Errorf("output %d shown while the predicate is false", i)
+		}
+	}
+	for i := 2; i < 4; i++ {
+		if got[i] == nil {
+			t.Fatalf("output %d hidden while the predicate is true", i)
+		}
+		baristatest.AssertOutput(t, func(o bar.Output) bar.Output { return o }, got[i],
+			baristatest.SegmentText(0, string(rune('a'+i))))
+	}
+	if n := atomic.LoadInt32(&calls); n != int32(len(sends)) {
+		t.Errorf("predicate called %d times for %d outputs", n, len(sends))
+	}
+}
+
+func TestConditionalOneAtATime(t *testing.T) {
+	// Outputs sent concurrently still check the predicate one at a time.
+	var inside, overlaps int32
+	m := conditional(moduleFunc(func(s bar.Sink) {
+		done := make(chan struct{})
+		for i := 0; i < 8; i++ {
+			go func() {
+				for j := 0; j < 50; j++ {
+					s.Output(outputs.Text("x"))
+				}
+				done <- struct{}{}
+			}()
+		}
+		for i := 0; i < 8; i++ {
+			<-done
+		}
+	}), func() bool {
+		if atomic.AddInt32(&inside, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(10 * time.Microsecond)
+		atomic.AddInt32(&inside, -1)
+		return true
+	})
+	m.Stream(func(bar.Output) {})
+	if n := atomic.LoadInt32(&overlaps); n > 0 {
+		t.Errorf("predicate called concurrently %d times", n)
+	}
+}
+
+func TestInDailyWindow(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2026, 10, 17, h, m, 0, 0, time.UTC) }
+	for _, tc := range []struct {
+		start, end, now time.Time
+		want            bool
+	}{
+		{at(9, 0), at(17, 0), at(8, 59), false},
+		{at(9, 0), at(17, 0), at(9, 0), true},
+		{at(9, 0), at(17, 0), at(16, 59), true},
+		{at(9, 0), at(17, 0), at(17, 0), false},
+		// Past midnight.
+		{at(22, 0), at(6, 0), at(23, 30), true},
+		{at(22, 0), at(6, 0), at(0, 0), true},
+		{at(22, 0), at(6, 0), at(5, 59), true},
+		{at(22, 0), at(6, 0), at(6, 0), false},
+		{at(22, 0), at(6, 0), at(12, 0), false},
+		// Only the time of day matters.
+		{at(9, 0).AddDate(-1, 0, 0), at(17, 0).AddDate(0, 2, 0), at(12, 0), true},
+	} {
+		if got := inDailyWindow(tc.now, tc.start, tc.end); got != tc.want {
+			t.Errorf("%s in %s-%s: got %v", tc.now.Format("15:04"), tc.start.Format("15:04"), tc.end.Format("15:04"), got)
+		}
+	}
+}
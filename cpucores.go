@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// showCoreHeatmap adds a row to the sysinfo detail with a block per core,
+// coloured by how busy it is. It's off by default, since it samples
+// /proc/stat on every refresh.
+var showCoreHeatmap = false
+
+type cpuTimes struct {
+	busy, total uint64
+}
+
+// readCoreTimes returns the cumulative busy and total jiffies of each core
+// from /proc/stat, in core order.
+func readCoreTimes() ([]cpuTimes, bool) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	var cores []cpuTimes
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		// The aggregate "cpu" line is skipped, only "cpuN" lines are cores.
+		if len(fields) < 5 || fields[0] == "cpu" || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		var t cpuTimes
+		for i, field := range fields[1:] {
+			v, _ := strconv.ParseUint(field, 10, 64)
+			// Guest time is already counted in user and nice.
+			if i >= 8 {
+				break
+			}
+			t.total += v
+			// idle and iowait.
+			if i != 3 && i != 4 {
+				t.busy += v
+			}
+		}
+		cores = append(cores, t)
+	}
+	return cores, len(cores) > 0
+}
+
+// coreSampler computes the usage of each core since the previous sample.
+type coreSampler struct {
+	mu   sync.Mutex
+	last []cpuTimes
+}
+
+// Sample returns the fraction of time each core was busy since the last
+// call. The first call has nothing to compare with, and returns false.
+func (c *coreSampler) Sample() ([]float64, bool) {
+	cur, ok := readCoreTimes()
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := c.last
+	c.last = cur
+	if len(last) != len(cur) {
+		// First sample, or a core went on or offline.
+		return nil, false
+	}
+	usage := make([]float64, len(cur))
+	for i := range cur {
+		total := cur[i].total - last[i].total
+		if total > 0 {
+			usage[i] = float64(cur[i].busy-last[i].busy) / float64(total)
+		}
+	}
+	return usage, true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/martinlindhe/unit"
+)
+
+type cpuFreqInfo struct {
+	Current  unit.Frequency
+	Max      unit.Frequency
+	Governor string
+}
+
+func readSysfsInt(path string) (int64, bool) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	val, err := strconv.ParseInt(strings.TrimSpace(string(contents)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return val, true
+}
+
+func readSysfsString(path string) string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(contents))
+}
+
+// cpuFreq returns the average current frequency across all cores, using
+// cpufreq from sysfs if available and /proc/cpuinfo otherwise. Max and
+// Governor are only known when cpufreq is exposed.
+func cpuFreq() (info cpuFreqInfo, ok bool) {
+	dirs, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/cpufreq")
+	var total, count int64
+	for _, dir := range dirs {
+		if cur, ok := readSysfsInt(filepath.Join(dir, "scaling_cur_freq")); ok {
+			total += cur
+			count++
+		}
+		if max, ok := readSysfsInt(filepath.Join(dir, "cpuinfo_max_freq")); ok {
+			if f := unit.Frequency(max) * unit.Kilohertz; f > info.Max {
+				info.Max = f
+			}
+		}
+		if info.Governor == "" {
+			info.Governor = readSysfsString(filepath.Join(dir, "scaling_governor"))
+		}
+	}
+	if count > 0 {
+		info.Current = unit.Frequency(total/count) * unit.Kilohertz
+		return info, true
+	}
+	mhz, ok := cpuinfoMHz()
+	if !ok {
+		return cpuFreqInfo{}, false
+	}
+	info.Current = unit.Frequency(mhz) * unit.Megahertz
+	return info, true
+}
+
+func cpuinfoMHz() (float64, bool) {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	var total float64
+	var count int
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if !strings.HasPrefix(line, "cpu MHz") {
+			continue
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		mhz, err := strconv.ParseFloat(strings.TrimSpace(line[colon+1:]), 64)
+		if err != nil {
+			continue
+		}
+		total += mhz
+		count++
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return total / float64(count), true
+}
@@ -1,25 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
-	"barista.run"
 	"barista.run/bar"
 	"barista.run/base/click"
-	"barista.run/base/watchers/netlink"
 	"barista.run/colors"
-	"barista.run/format"
 	"barista.run/group/modal"
 	"barista.run/modules/battery"
 	"barista.run/modules/clock"
@@ -30,19 +34,17 @@ import (
 	"barista.run/modules/meminfo"
 	"barista.run/modules/meta/split"
 	"barista.run/modules/netinfo"
-	"barista.run/modules/netspeed"
-	"barista.run/modules/shell"
+	"barista.run/modules/static"
 	"barista.run/modules/sysinfo"
 	"barista.run/modules/volume"
-	"barista.run/modules/volume/alsa"
 	"barista.run/modules/weather"
-	"barista.run/modules/weather/openweathermap"
 	"barista.run/modules/wlan"
 	"barista.run/oauth"
 	"barista.run/outputs"
 	"barista.run/pango"
 	"barista.run/pango/icons/mdi"
 
+	"github.com/chris-vest/crystal_barista/i3ipc"
 	"github.com/martinlindhe/unit"
 	keyring "github.com/zalando/go-keyring"
 )
@@ -50,6 +52,23 @@ import (
 var spacer = pango.Text(" ").XSmall()
 var mainModalController modal.Controller
 
+// tempHistory is the number of CPU temperature samples shown in the sparkline.
+var tempHistory = 30
+
+// extraMounts are additional mount points to show disk space for, alongside
+// / and the home directory.
+var extraMounts = []struct{ Path, Icon string }{
+	// {"/boot", "mdi-cog-outline"},
+	// {"/mnt/data", "mdi-database"},
+}
+
+// diskioHours is when disk I/O is shown; overnight it's only backups and
+// indexing.
+var diskioHours = struct{ From, Until time.Time }{
+	From:  time.Date(0, 1, 1, 6, 0, 0, 0, time.Local),
+	Until: time.Date(0, 1, 1, 0, 0, 0, 0, time.Local),
+}
+
 func truncate(in string, l int) string {
 	fromStart := false
 	if l < 0 {
@@ -66,6 +85,21 @@ func truncate(in string, l int) string {
 	return string([]rune(in)[:l-1]) + "⋯"
 }
 
+// truncateMiddle shortens in to at most l runes by replacing its middle
+// with an ellipsis, keeping both ends, e.g. for paths and device names.
+func truncateMiddle(in string, l int) string {
+	runes := []rune(in)
+	if len(runes) <= l {
+		return in
+	}
+	if l < 3 {
+		return "⋯"
+	}
+	start := (l - 1) / 2
+	end := l - 1 - start
+	return string(runes[:start]) + "⋯" + string(runes[len(runes)-end:])
+}
+
 func hms(d time.Duration) (h int, m int, s int) {
 	h = int(d.Hours())
 	m = int(d.Minutes()) % 60
@@ -81,7 +115,7 @@ func formatMediaTime(d time.Duration) string {
 	return fmt.Sprintf("%d:%02d", m, s)
 }
 
-func makeMediaIconAndPosition(m media.Info) *pango.Node {
+func makeMediaIconAndPosition(m mprisInfo) *pango.Node {
 	iconAndPosition := pango.Icon("mdi-music")
 	if m.PlaybackStatus == media.Playing {
 		iconAndPosition.Append(spacer,
@@ -94,7 +128,7 @@ func makeMediaIconAndPosition(m media.Info) *pango.Node {
 	return iconAndPosition
 }
 
-func mediaFormatFunc(m media.Info) bar.Output {
+func mediaFormatFunc(m mprisInfo) bar.Output {
 	if m.PlaybackStatus == media.Stopped || m.PlaybackStatus == media.Disconnected {
 		return nil
 	}
@@ -114,21 +148,38 @@ func mediaFormatFunc(m media.Info) bar.Output {
 	return outputs.Group(iconAndPosition, outputs.Pango(artist, " - ", title))
 }
 
+// launch starts a shell command through i3 or sway so that they track its
+// window, e.g. to open it on the workspace it was launched from, falling
+// back to starting it directly.
+func launch(cmdline string) {
+	err := i3ipc.RunCommand("exec " + cmdline)
+	if err == nil {
+		return
+	}
+	if err != i3ipc.ErrNotRunning {
+		logWarnf("Could not launch %q through i3: %v", cmdline, err)
+	}
+	cmd := exec.Command("sh", "-c", cmdline)
+	if cmd.Start() == nil {
+		go cmd.Wait()
+	}
+}
+
 func home(path ...string) string {
 	usr, err := user.Current()
 	if err != nil {
-		panic(err)
+		logFatalf("Could not find home directory: %v", err)
 	}
 	args := append([]string{usr.HomeDir}, path...)
 	return filepath.Join(args...)
 }
 
 func deviceForMountPath(path string) string {
-	mnt, _ := exec.Command("df", "-P", path).Output()
+	mnt, _ := quickOutput("df", "-P", path)
 	lines := strings.Split(string(mnt), "\n")
 	if len(lines) > 1 {
 		devAlias := strings.Split(lines[1], " ")[0]
-		dev, _ := exec.Command("realpath", devAlias).Output()
+		dev, _ := quickOutput("realpath", devAlias)
 		devStr := strings.TrimSpace(string(dev))
 		if devStr != "" {
 			return devStr
@@ -138,153 +189,303 @@ func deviceForMountPath(path string) string {
 	return ""
 }
 
+// geoipURL is used to find the bar's location from its IP address.
+var geoipURL = "https://freegeoip.app/json/"
+
 type freegeoipResponse struct {
 	Lat float64 `json:"latitude"`
 	Lng float64 `json:"longitude"`
 }
 
+var lastLocation struct {
+	sync.Mutex
+	lat, lng float64
+	ok       bool
+}
+
+// whereami returns the coordinates of the city in $BARISTA_CITY if it's
+// set and known, and otherwise geolocates by IP address, falling back to
+// the last known location if that fails.
 func whereami() (lat float64, lng float64, err error) {
-	resp, err := http.Get("https://freegeoip.app/json/")
-	if err != nil {
-		return 0, 0, err
+	if city := os.Getenv("BARISTA_CITY"); city != "" {
+		lat, lng, err := cityCoords(city)
+		if err == nil {
+			return lat, lng, nil
+		}
+		logWarnf("Ignoring BARISTA_CITY, geolocating instead: %v", err)
 	}
 	var res freegeoipResponse
-	err = json.NewDecoder(resp.Body).Decode(&res)
+	err = retry("Geolocation", func(ctx context.Context) error {
+		resp, err := httpGet(ctx, geoipURL)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("geolocation: %s", resp.Status)
+		}
+		return json.NewDecoder(resp.Body).Decode(&res)
+	})
+	lastLocation.Lock()
+	defer lastLocation.Unlock()
 	if err != nil {
+		if lastLocation.ok {
+			logWarnf("Geolocation failed, using the last known location: %v", err)
+			return lastLocation.lat, lastLocation.lng, nil
+		}
 		return 0, 0, err
 	}
+	lastLocation.lat, lastLocation.lng, lastLocation.ok = res.Lat, res.Lng, true
 	return res.Lat, res.Lng, nil
 }
 
+// oauthKeyringService is the keyring service that the oauth encryption key
+// is stored under.
+var oauthKeyringService = "barista-cv"
+
+// oauthKeyFile is where the oauth encryption key is stored if no secret
+// provider is available.
+var oauthKeyFile = configDir("oauth-key")
+
+func configDir(path ...string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = home(".config")
+	}
+	return filepath.Join(append([]string{dir, "barista"}, path...)...)
+}
+
 func setupOauthEncryption() error {
-	const service = "barista-cv"
 	var username string
 	if u, err := user.Current(); err == nil {
 		username = u.Username
 	} else {
 		username = fmt.Sprintf("user-%d", os.Getuid())
 	}
-	var secretBytes []byte
+	secretBytes, err := oauthEncryptionKey(oauthKeyringService, username)
+	if err != nil {
+		return err
+	}
+	oauth.SetEncryptionKey(secretBytes)
+	return nil
+}
+
+// oauthEncryptionKey returns the key used to encrypt oauth tokens,
+// generating and storing one if needed.
+func oauthEncryptionKey(service, username string) ([]byte, error) {
 	// IMPORTANT: The oauth tokens used by some modules are very sensitive, so
 	// we encrypt them with a random key and store that random key using
 	// libsecret (gnome-keyring or equivalent). If no secret provider is
-	// available, there is no way to store tokens (since the version of
-	// sample-bar used for setup-oauth will have a different key from the one
-	// running in i3bar). See also https://github.com/zalando/go-keyring#linux.
+	// available, the key is stored in a file instead, which is only as safe
+	// as that file's permissions. See also
+	// https://github.com/zalando/go-keyring#linux.
 	secret, err := keyring.Get(service, username)
 	if err == nil {
-		secretBytes, err = base64.RawURLEncoding.DecodeString(secret)
+		if secretBytes, err := base64.RawURLEncoding.DecodeString(secret); err == nil {
+			return secretBytes, nil
+		}
 	}
+	if err != nil && err != keyring.ErrNotFound {
+		logWarnf("Keyring unavailable (%v), falling back to %s", err, oauthKeyFile)
+		return fileEncryptionKey(oauthKeyFile)
+	}
+	// A key stored in the file while the keyring was unavailable is moved
+	// into it, so the tokens encrypted with it can still be read.
+	secretBytes, err := readEncryptionKey(oauthKeyFile)
+	switch {
+	case err == nil:
+		secret = base64.RawURLEncoding.EncodeToString(secretBytes)
+		if err := keyring.Set(service, username, secret); err != nil {
+			logWarnf("Could not move the key in %s to the keyring: %v", oauthKeyFile, err)
+			return secretBytes, nil
+		}
+		if err := os.Remove(oauthKeyFile); err != nil {
+			logWarnf("Moved the oauth encryption key to the keyring, but could not remove %s: %v",
+				oauthKeyFile, err)
+		} else {
+			logInfof("Moved the oauth encryption key from %s to the keyring", oauthKeyFile)
+		}
+		return secretBytes, nil
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	secretBytes, err = newEncryptionKey()
 	if err != nil {
-		secretBytes = make([]byte, 64)
-		_, err := rand.Read(secretBytes)
-		if err != nil {
-			return err
+		return nil, err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(secretBytes)
+	if err := keyring.Set(service, username, secret); err != nil {
+		// A key that isn't stored anywhere is replaced on the next run,
+		// after which none of the tokens encrypted with it can be read.
+		logWarnf("Could not store key in keyring (%v), falling back to %s", err, oauthKeyFile)
+		key, fileErr := fileEncryptionKey(oauthKeyFile)
+		if fileErr != nil {
+			logErrorf("Could not store oauth encryption key; "+
+				"existing oauth tokens will be lost: %v", fileErr)
+			return nil, fmt.Errorf("storing oauth encryption key: %v (keyring: %v)", fileErr, err)
 		}
-		secret = base64.RawURLEncoding.EncodeToString(secretBytes)
-		keyring.Set(service, username, secret)
+		return key, nil
 	}
-	oauth.SetEncryptionKey(secretBytes)
-	return nil
+	return secretBytes, nil
 }
 
-func makeIconOutput(key string) *bar.Segment {
-	return outputs.Pango(spacer, pango.Icon(key), spacer)
+func newEncryptionKey() ([]byte, error) {
+	key := make([]byte, 64)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
 }
 
-func threshold(out *bar.Segment, urgent bool, color ...bool) *bar.Segment {
-	if urgent {
-		return out.Urgent(true)
-	}
-	colorKeys := []string{"bad", "degraded", "good"}
-	for i, c := range colorKeys {
-		if len(color) > i && color[i] {
-			return out.Color(colors.Scheme(c))
-		}
+// readEncryptionKey reads a key written by fileEncryptionKey.
+func readEncryptionKey(path string) ([]byte, error) {
+	secret, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
-	return out
+	return base64.RawURLEncoding.DecodeString(strings.TrimSpace(string(secret)))
 }
 
-func k8sCtx() []string {
-	// Get kubectl contexts
-	cmd := exec.Command("bash", "-c", "kubectl config get-contexts | awk {'print $2'} | sed 1d")
-	out, err := cmd.CombinedOutput()
+// fileEncryptionKey reads the key from path, or generates and writes a new
+// key there if it doesn't exist yet.
+func fileEncryptionKey(path string) ([]byte, error) {
+	logWarnf("The oauth encryption key is stored unencrypted in %s. "+
+		"Anyone who can read it can decrypt your oauth tokens.", path)
+	if key, err := readEncryptionKey(path); !os.IsNotExist(err) {
+		return key, err
+	}
+	key, err := newEncryptionKey()
 	if err != nil {
-		log.Fatalf("cmd.Run() failed with %s\n", err)
+		return nil, err
 	}
-	results := string(out)
-	fmt.Printf("combined out:\n%s\n", results)
-
-	contexts := strings.SplitAfter(results, "\n")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(key)
+	if err := ioutil.WriteFile(path, []byte(secret), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
 
-	return contexts
+func makeIconOutput(key string) *bar.Segment {
+	return outputs.Pango(spacer, pango.Icon(key), spacer)
 }
 
-type autoWeatherProvider struct{}
+// thresholdConfig holds the result of each threshold check for a value. The
+// first of Urgent, Bad, Degraded, Good that is true decides the styling.
+type thresholdConfig struct {
+	Urgent   bool
+	Bad      bool
+	Degraded bool
+	Good     bool
+}
 
-func (a autoWeatherProvider) GetWeather() (weather.Weather, error) {
-	lat, lng, err := whereami()
-	if err != nil {
-		return weather.Weather{}, err
+func threshold(out *bar.Segment, c thresholdConfig) *bar.Segment {
+	switch {
+	case c.Urgent:
+		return out.Urgent(true)
+	case c.Bad:
+		return out.Color(themeColor("bad"))
+	case c.Degraded:
+		return out.Color(themeColor("degraded"))
+	case c.Good:
+		return out.Color(themeColor("good"))
 	}
-	return openweathermap.
-		New("%%OWM_API_KEY%%").
-		Coords(lat, lng).
-		GetWeather()
+	return out
 }
 
-func main() {
-	// material.Load(home("projects/material-design-icons"))
-	mdi.Load(home("projects/MaterialDesign-Webfont"))
-	// typicons.Load(home("projects/typicons.font"))
-	// ionicons.LoadMd(home("projects/ionicons"))
-	// fontawesome.Load(home("projects/Font-Awesome"))
+// band is a range of values up to and including upper, shown with level:
+// "urgent", "bad", "degraded", "good", or "" for no styling.
+type band struct {
+	upper float64
+	level string
+}
 
-	colors.LoadBarConfig()
-	bg := colors.Scheme("background")
-	fg := colors.Scheme("statusline")
-	if fg != nil && bg != nil {
-		_, _, v := fg.Colorful().Hsv()
-		if v < 0.3 {
-			v = 0.3
+// above is the upper bound of the last band, which has no limit.
+var above = math.Inf(1)
+
+// bandThreshold returns the thresholdConfig for the first of bands, which
+// are in ascending order, that value falls in. Values above the last band
+// aren't styled.
+func bandThreshold(value float64, bands ...band) thresholdConfig {
+	for _, b := range bands {
+		if value > b.upper {
+			continue
+		}
+		switch b.level {
+		case "urgent":
+			return thresholdConfig{Urgent: true}
+		case "bad":
+			return thresholdConfig{Bad: true}
+		case "degraded":
+			return thresholdConfig{Degraded: true}
+		case "good":
+			return thresholdConfig{Good: true}
 		}
-		colors.Set("bad", colors.Hex("#FF5555"))
-		colors.Set("degraded", colors.Hex("#FFB86C"))
-		colors.Set("good", colors.Hex("#50FA7B"))
+		return thresholdConfig{}
 	}
+	return thresholdConfig{}
+}
 
-	if err := setupOauthEncryption(); err != nil {
-		panic(fmt.Sprintf("Could not setup oauth token encryption: %v", err))
+// worstOf combines the results of several threshold checks, so that the
+// worst of them decides the styling.
+func worstOf(cs ...thresholdConfig) thresholdConfig {
+	var w thresholdConfig
+	for _, c := range cs {
+		w.Urgent = w.Urgent || c.Urgent
+		w.Bad = w.Bad || c.Bad
+		w.Degraded = w.Degraded || c.Degraded
+		w.Good = w.Good || c.Good
 	}
+	return w
+}
 
-	localdate := clock.Local().
-		Output(time.Second, func(now time.Time) bar.Output {
-			return outputs.Pango(
-				pango.Icon("mdi-calendar-today"),
-				spacer,
-				now.Format("Mon Jan 2"),
-			).OnClick(click.RunLeft("gsimplecal"))
-		})
+func tempThreshold(out *bar.Segment, temp unit.Temperature) *bar.Segment {
+	t := thresholds.Temp
+	return threshold(out, bandThreshold(temp.Celsius(),
+		band{t.Degraded, ""},
+		band{t.Bad, "degraded"},
+		band{t.Urgent, "bad"},
+		band{above, "urgent"},
+	))
+}
 
-	localtime := clock.Local().
-		Output(time.Second, func(now time.Time) bar.Output {
-			return outputs.Text(now.Format("15:04:05")).
-				OnClick(click.Left(func() {
-					mainModalController.Toggle("timezones")
-				}))
-		})
+func k8sCtx() ([]string, error) {
+	// Get kubectl contexts
+	out, err := kubectl("config", "get-contexts", "-o", "name")
+	if err != nil {
+		return nil, err
+	}
+	logDebugf("kubectl contexts:\n%s", out)
+	return strings.Split(out, "\n"), nil
+}
 
-	makeTzClock := func(lbl, tzName string) bar.Module {
-		c, err := clock.ZoneByName(tzName)
-		if err != nil {
-			panic(err)
+// kubectl runs kubectl with args, returning its trimmed output, or the
+// first line of its stderr as the error if it fails.
+func kubectl(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd, done := quickCommand("kubectl", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	err = done(err)
+	if err != nil {
+		if msg := strings.SplitN(strings.TrimSpace(stderr.String()), "\n", 2)[0]; msg != "" {
+			return "", errors.New(msg)
 		}
-		return c.Output(time.Minute, func(now time.Time) bar.Output {
-			return outputs.Pango(pango.Text(lbl).Smaller(), spacer, now.Format("15:04"))
-		})
+		return "", err
 	}
+	return strings.TrimSpace(string(out)), nil
+}
 
-	battSummary, battDetail := split.New(battery.All().Output(func(i battery.Info) bar.Output {
+// batteryHealthWarning is the fraction of its design capacity below which
+// the battery is shown as worn out.
+var batteryHealthWarning = 0.8
+
+// batteryOutput returns the fully themed battery output, coloured using the
+// given thresholds. The first segment is the summary, the rest are details.
+func batteryOutput(t batteryThresholds) func(battery.Info) bar.Output {
+	return func(i battery.Info) bar.Output {
 		if i.Status == battery.Disconnected || i.Status == battery.Unknown {
 			return nil
 		}
@@ -299,6 +500,14 @@ func main() {
 		case tenth < 10:
 			iconName += fmt.Sprintf("-%d0", tenth)
 		}
+		// A battery held at its charge limit is as full as it will get.
+		limit, limited := 0, false
+		if batteryChargeLimitAware && !i.Discharging() {
+			if l, ok := batteryChargeLimit(); ok && i.RemainingPct() >= l-1 {
+				limit, limited = l, true
+				iconName = "battery"
+			}
+		}
 		mainModalController.SetOutput("battery", makeIconOutput("mdi-"+iconName))
 		rem := i.RemainingTime()
 		out := outputs.Group()
@@ -311,9 +520,13 @@ func main() {
 			mainModalController.Toggle("battery")
 		})))
 		// Others in detail mode.
+		charge := pango.Textf("%d%%", i.RemainingPct())
+		if limited {
+			charge = pango.Textf("full (limited to %d%%)", limit)
+		}
 		out.Append(outputs.Pango(
 			pango.Icon("mdi-"+iconName),
-			pango.Textf("%d%%", i.RemainingPct()),
+			charge,
 			spacer,
 			pango.Textf("(%d:%02d)", int(rem.Hours()), int(rem.Minutes())%60),
 		).OnClick(click.Left(func() {
@@ -327,345 +540,679 @@ func main() {
 			pango.Textf("% +6.2f", i.SignedPower()),
 			pango.Text("W").Smaller(),
 		))
-		switch {
-		case i.RemainingPct() <= 5:
+		switch pct := i.RemainingPct(); {
+		case limited:
+			// As full as it will get, so not coloured as low.
+		case pct <= t.Urgent:
 			out.Urgent(true)
-		case i.RemainingPct() <= 25:
-			out.Color(colors.Hex("#FF5555"))
-		case i.RemainingPct() <= 50:
-			out.Color(colors.Hex("#FFB86C"))
-		case i.RemainingPct() <= 100:
-			out.Color(colors.Hex("#50FA7B"))
+		case pct <= t.Bad:
+			out.Color(themeColor("bad"))
+		case pct <= t.Degraded:
+			out.Color(themeColor("degraded"))
+		case pct <= t.Good:
+			out.Color(themeColor("good"))
+		}
+		// EnergyMax is the design capacity, which not all batteries report.
+		if i.EnergyMax > 0 {
+			health := i.EnergyFull / i.EnergyMax
+			out.Append(threshold(outputs.Pango(
+				pango.Icon("mdi-battery-heart-variant"), spacer,
+				pango.Textf("%.0f%%", health*100),
+			), thresholdConfig{Degraded: health < batteryHealthWarning}))
 		}
 		return out
-	}), 1)
+	}
+}
+
+// The weather API keys are filled in by build.sh. Pirate Weather is used
+// when OpenWeatherMap fails, before falling back to Met.no. They're vars
+// so that tests can set them.
+var (
+	owmAPIKey           = "%%OWM_API_KEY%%"
+	pirateWeatherAPIKey = "%%PIRATEWEATHER_API_KEY%%"
+)
+
+type autoWeatherProvider struct {
+	mu       sync.Mutex
+	lat, lng float64
+	resolved bool
+	// Chance of precipitation, if OpenWeatherMap's forecast provided it.
+	precipChance    float64
+	hasPrecipChance bool
+	// last is shown again if both providers fail.
+	last    weather.Weather
+	hasLast bool
+}
 
-	wifiName, wifiDetails := split.New(wlan.Any().Output(func(i wlan.Info) bar.Output {
+// coords returns the coordinates used for the most recent weather lookup.
+func (a *autoWeatherProvider) coords() (lat, lng float64, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lat, a.lng, a.resolved
+}
+
+func (a *autoWeatherProvider) GetWeather() (weather.Weather, error) {
+	lat, lng, err := whereami()
+	if err != nil {
+		return weather.Weather{}, err
+	}
+	a.mu.Lock()
+	a.lat, a.lng, a.resolved = lat, lng, true
+	a.hasPrecipChance = false
+	a.mu.Unlock()
+	var w weather.Weather
+	var pop float64
+	err = errors.New("no API keys set")
+	if apiKeySet(owmAPIKey) {
+		popErr := retry("OpenWeatherMap forecast", func(ctx context.Context) (err error) {
+			pop, err = owmPrecipChance(ctx, owmAPIKey, lat, lng)
+			return err
+		})
+		a.mu.Lock()
+		a.precipChance, a.hasPrecipChance = pop, popErr == nil
+		a.mu.Unlock()
+		err = retry("OpenWeatherMap", func(ctx context.Context) (err error) {
+			w, err = owmGetWeather(ctx, owmAPIKey, lat, lng)
+			return err
+		})
+	}
+	if err != nil && apiKeySet(pirateWeatherAPIKey) {
+		logWarnf("OpenWeatherMap unavailable, using Pirate Weather: %v", err)
+		err = retry("Pirate Weather", func(ctx context.Context) (err error) {
+			w, pop, err = pirateWeatherGet(ctx, pirateWeatherAPIKey, lat, lng)
+			return err
+		})
+		if err == nil {
+			a.mu.Lock()
+			a.precipChance, a.hasPrecipChance = pop, true
+			a.mu.Unlock()
+		}
+	}
+	if err != nil {
+		// Met.no is free, so it makes a good fallback when the
+		// OpenWeatherMap key is missing or over its rate limit.
+		logWarnf("Weather lookup failed, using Met.no: %v", err)
+		err = retry("Met.no", func(ctx context.Context) (err error) {
+			w, err = metnoGetWeather(ctx, lat, lng)
+			return err
+		})
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		if a.hasLast {
+			logWarnf("Weather unavailable, showing the last conditions: %v", err)
+			return a.last, nil
+		}
+		return weather.Weather{}, err
+	}
+	a.last, a.hasLast = w, true
+	return w, nil
+}
+
+// precipitation returns the chance of precipitation from the most recent
+// weather lookup, if known.
+func (a *autoWeatherProvider) precipitation() (chance float64, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.precipChance, a.hasPrecipChance
+}
+
+// loadTheme reads the colours from the i3bar config, and overrides the
+// status colours to match the rest of the theme.
+func loadTheme() {
+	updateTheme(func() {
+		colors.LoadBarConfig()
+		bg := colors.Scheme("background")
+		fg := colors.Scheme("statusline")
+		if fg != nil && bg != nil {
+			_, _, v := fg.Colorful().Hsv()
+			if v < 0.3 {
+				v = 0.3
+			}
+			setThemeColor("bad", colors.Hex("#FF5555"))
+			setThemeColor("degraded", colors.Hex("#FFB86C"))
+			setThemeColor("good", colors.Hex("#50FA7B"))
+		}
+		if themeFromXResources {
+			loadXResourcesTheme()
+		}
+		reapplyColorProfile()
+	})
+}
+
+// setupOauth runs the oauth consent flow for every module that needs it,
+// then exits instead of starting the bar.
+var setupOauth = flag.Bool("setup-oauth", false,
+	"authorise modules that use oauth, then exit")
+
+// iconFontDir is a checkout of the Material Design Icons webfont.
+var iconFontDir = home("projects/MaterialDesign-Webfont")
+
+func main() {
+	flag.Parse()
+	if *checkEnv {
+		if !runEnvChecks() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// material.Load(home("projects/material-design-icons"))
+	mdi.Load(iconFontDir)
+	// typicons.Load(home("projects/typicons.font"))
+	// ionicons.LoadMd(home("projects/ionicons"))
+	// fontawesome.Load(home("projects/Font-Awesome"))
+
+	loadTheme()
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go handleSignals(stop)
+	go watchResume()
+	loadDisplayProfile()
+	loadTimeFormats()
+	loadThresholdsConfig()
+	loadDatePreset()
+
+	onStart(func() error {
+		if err := setupOauthEncryption(); err != nil {
+			return fmt.Errorf("could not set up oauth token encryption: %w", err)
+		}
+		return nil
+	})
+
+	localdate := clockEvery(clock.Local(), time.Second, localdateOutput)
+	localtime := clockEvery(clock.Local(), time.Second, localtimeOutput)
+
+	makeTzClock := func(lbl, tzName string) bar.Module {
+		c, err := clock.ZoneByName(tzName)
+		if err != nil {
+			logFatalf("Unknown timezone %s: %v", tzName, err)
+		}
+		return clockEvery(c, time.Minute, func(now time.Time) bar.Output {
+			return tzClockOutput(lbl, now)
+		})
+	}
+
+	workHours := business(
+		time.Date(0, 1, 1, 9, 0, 0, 0, time.Local),
+		time.Date(0, 1, 1, 17, 30, 0, 0, time.Local),
+		time.Local,
+	)
+	stopwatchModule := newStopwatch(stopwatchStateFile)
+
+	workDay := clockEvery(clock.Local(), time.Minute, func(now time.Time) bar.Output {
+		return workDayOutput(workHours.At(now))
+	})
+
+	power := newPowerModule()
+	battSummary, battDetail := split.New(battery.All().Output(batteryOutput(thresholds.Battery)), 1)
+
+	wifiModuleOutput := func(i wlan.Info) bar.Output {
 		if !i.Connecting() && !i.Connected() {
 			mainModalController.SetOutput("network", makeIconOutput("mdi-ethernet"))
-			return nil
-		}
-		mainModalController.SetOutput("network", makeIconOutput("mdi-wifi"))
-		if i.Connecting() {
-			return outputs.Pango(pango.Icon("mdi-wifi"), "...").
-				Color(colors.Scheme("degraded"))
+		} else {
+			mainModalController.SetOutput("network", makeIconOutput("mdi-wifi"))
 		}
-		out := outputs.Group()
-		// First segment shown in summary mode only.
-		out.Append(outputs.Pango(
-			pango.Icon("mdi-wifi"),
-			// pango.Text(truncate(i.SSID, -9)),
-			spacer,
-			pango.Text(i.SSID),
-		).OnClick(click.Left(func() {
-			mainModalController.Toggle("network")
-		})))
-		// Full name, frequency, bssid in detail mode
-		out.Append(outputs.Pango(
-			pango.Icon("mdi-wifi"),
-			spacer,
-			pango.Text(i.SSID),
-		))
-		out.Append(outputs.Textf(" %2.1f Ghz", i.Frequency.Gigahertz()))
-		out.Append(outputs.Pango(
-			pango.Icon("mdi-access-point"),
-			spacer,
-			pango.Text(i.AccessPointMAC),
-		))
-		return out
-	}), 1)
+		return wifiOutput(i)
+	}
+	wifi := newWifiModule().Output(wifiModuleOutput)
+	// Setting the output function again redraws the last state, e.g. in a
+	// new display profile, since wifi only updates when the link changes.
+	onRefresh(func() { wifi.Output(wifiModuleOutput) })
+	wifiName, wifiDetails := split.New(wifi, 1)
 
-	vol := volume.New(alsa.DefaultMixer()).Output(func(v volume.Volume) bar.Output {
-		if v.Mute {
-			return outputs.
-				Pango(pango.Icon("mdi-volume-off")).
-				Color(colors.Scheme("degraded"))
-		}
-		iconName := "mute"
-		pct := v.Pct()
-		if pct > 66 {
-			iconName = "high"
-		} else if pct > 33 {
-			iconName = "low"
-		}
-		return outputs.Pango(
-			pango.Icon("mdi-volume-"+iconName),
-			spacer,
-			pango.Textf("%2d%%", pct),
-		)
+	vol := newDefaultVolume(func(v volume.Volume, _ string) bar.Output {
+		return volumeOutput(v)
+	}).OnDeviceChange(func(device string) {
+		logInfof("Default audio device is now %s", device)
 	})
+	mic := newMicModule()
+	appVol := newAppVolumeModule()
+	eq := newEqualizer(easyEffectsProvider)
 
 	// WEATHER
 
-	// Weather information comes from OpenWeatherMap.
-	// https://openweathermap.org/api.
-	wthr := weather.New(autoWeatherProvider{}).Output(func(w weather.Weather) bar.Output {
-		iconName := ""
-		switch w.Condition {
-		case weather.Thunderstorm,
-			weather.TropicalStorm,
-			weather.Hurricane:
-			iconName = "stormy"
-		case weather.Drizzle,
-			weather.Hail:
-			iconName = "shower"
-		case weather.Rain:
-			iconName = "downpour"
-		case weather.Snow,
-			weather.Sleet:
-			iconName = "snow"
-		case weather.Mist,
-			weather.Smoke,
-			weather.Whirls,
-			weather.Haze,
-			weather.Fog:
-			iconName = "windy-cloudy"
-		case weather.Clear:
-			if !w.Sunset.IsZero() && time.Now().After(w.Sunset) {
-				iconName = "night"
-			} else if !w.Sunrise.IsZero() && time.Now().Before(w.Sunrise) {
-				iconName = "night"
-			} else {
-				iconName = "sunny"
+	// Weather information comes from OpenWeatherMap, falling back to
+	// Pirate Weather and then Met.no. https://openweathermap.org/api.
+	weatherProvider := &autoWeatherProvider{}
+	weatherLinker := newWeatherLinker(weatherProvider)
+	var wthrCache outputCache
+	// Polled rather than barista's weather module, so that it's fetched
+	// again straight after a resume from suspend.
+	wthr := pollEvery(weatherInterval, func(s bar.Sink) {
+		w, err := weatherProvider.GetWeather()
+		if s.Error(err) {
+			return
+		}
+		pop, popOK := weatherProvider.precipitation()
+		view := newWeatherView(w, pop, popOK, time.Now())
+		mainModalController.SetOutput("weather", makeIconOutput(view.Icon))
+		out, _ := wthrCache.Get(view, func() bar.Output {
+			return view.output().OnClick(weatherLinker.Click)
+		})
+		s.Output(out)
+	})
+	// Just the temperature until the weather mode is opened.
+	wthrSummary, wthrDetail := split.New(wthr, 1)
+
+	airQualityCache := &aqiCache{ttl: 30 * time.Minute}
+	airQuality := pollEvery(5*time.Minute, func(s bar.Sink) {
+		if !apiKeySet(owmAPIKey) {
+			s.Output(nil)
+			return
+		}
+		aqi, err := airQualityCache.Get(func() (aqiInfo, error) {
+			lat, lng, ok := weatherProvider.coords()
+			if !ok {
+				var err error
+				if lat, lng, err = whereami(); err != nil {
+					return aqiInfo{}, err
+				}
 			}
-		case weather.PartlyCloudy:
-			iconName = "partly-sunny"
-		case weather.Cloudy, weather.Overcast:
-			iconName = "cloudy"
-		case weather.Tornado,
-			weather.Windy:
-			iconName = "windy"
-		}
-		if iconName == "" {
-			iconName = "warning-outline"
-		} else {
-			iconName = "weather-" + iconName
+			return owmAirQuality(context.Background(), owmAPIKey, lat, lng)
+		})
+		if err != nil {
+			s.Output(nil)
+			return
 		}
-		mainModalController.SetOutput("weather", makeIconOutput("mdi-"+iconName))
-		out := outputs.Group()
-		out.Append(outputs.Pango(
-			pango.Icon("mdi-"+iconName), spacer,
-			pango.Textf("%.1f℃", w.Temperature.Celsius()),
-		))
-		out.Append(outputs.Text(w.Description))
-		out.Append(outputs.Pango(
-			pango.Icon("mdi-flag-variant-outline").Alpha(0.8), spacer,
-			pango.Textf("%0.fmph %s", w.Wind.Speed.MilesPerHour(), w.Wind.Direction.Cardinal()),
-		))
-		out.Append(outputs.Pango(
-			pango.Icon("fa-tint").Alpha(0.6).Small(), spacer,
-			pango.Textf("%0.f%%", w.Humidity*100),
-		))
-		out.Append(outputs.Pango(
-			pango.Icon("mdi-weather-sunset-up").Alpha(0.8), spacer,
-			w.Sunrise.Format("15:04"), spacer,
-			pango.Icon("mdi-weather-sunset-down").Alpha(0.8), spacer,
-			w.Sunset.Format("15:04"),
-		))
-		out.Append(pango.Textf("provided by %s", w.Attribution).XSmall())
-		return out
+		s.Output(aqiOutput(aqi))
 	})
 
 	// KUBERNETES CONTEXTS
-	kubeContext := shell.New("kubectl", "config", "current-context").
-		Every(time.Second).
-		Output(func(context string) bar.Output {
-			out := outputs.Pango(
-				pango.Icon("mdi-ship-wheel"),
-				spacer,
-				pango.Textf(context),
-			)
-			out.OnClick(click.Left(func() {
-				mainModalController.Toggle("kubeContext")
-			}))
-			return out
-		})
+	// Without kubectl the modules stay empty, but the mode is still
+	// registered so the rest of the modal is unaffected.
+	_, kubectlErr := exec.LookPath("kubectl")
+	// kubectl explains on stderr when there's no kubeconfig or context.
+	var kubeContext bar.Module = static.New(nil)
+	if kubectlErr == nil {
+		kubeContext = newShellWithStderr("kubectl", "config", "current-context").
+			Every(time.Second).
+			Output(func(stdout, stderr string) bar.Output {
+				if stdout == "" && stderr != "" {
+					return kubeErrorOutput(errors.New(strings.SplitN(stderr, "\n", 2)[0]))
+				}
+				return kubeContextOutput(stdout)
+			})
+	}
 
-	kubeNs := shell.New("bash", "-c", "kubectl config view -o=jsonpath=\"{.contexts[?(@.name=='$(kubectl config current-context)')].context.namespace}\"").
-		Every(time.Second).
-		Output(func(context string) bar.Output {
-			out := outputs.Pango(
-				pango.Textf("Namespace: %s", context),
-			)
-			return out
-		})
+	// The namespace is only shown when the mode is expanded, so it's
+	// paused while it's collapsed.
+	var kubeNs bar.Module = static.New(nil)
+	if kubectlErr == nil {
+		kubeNs = newShellWithStderr("kubectl", "config", "view", "--minify",
+			"-o", "jsonpath={..namespace}").
+			Every(time.Second).
+			Output(func(stdout, stderr string) bar.Output {
+				if stdout == "" && stderr != "" {
+					return kubeErrorOutput(errors.New(strings.SplitN(stderr, "\n", 2)[0]))
+				}
+				return kubeNsOutput(stdout)
+			})
+	}
 
 	loadAvg := sysinfo.New().Output(func(s sysinfo.Info) bar.Output {
-		out := outputs.Pango(
-			pango.Icon("mdi-desktop-tower"),
-			spacer,
-			pango.Textf("%0.2f", s.Loads[0]),
-		)
-		// Load averages are unusually high for a few minutes after boot.
-		if s.Uptime < 10*time.Minute {
-			// so don't add colours until 10 minutes after system start.
-			return out
-		}
-		threshold(out,
-			s.Loads[0] > 128 || s.Loads[2] > 64,
-			s.Loads[0] > 64 || s.Loads[2] > 32,
-			s.Loads[0] > 32 || s.Loads[2] > 16,
-		)
-		out.OnClick(click.Left(func() {
-			mainModalController.Toggle("sysinfo")
-		}))
-		return out
+		procs, _ := readLoadavg()
+		return loadAvgOutput(s, procs, runtime.NumCPU())
 	})
-
 	loadAvgDetail := sysinfo.New().Output(func(s sysinfo.Info) bar.Output {
-		return pango.Textf("%0.2f %0.2f", s.Loads[1], s.Loads[2]).Smaller()
+		procs, ok := readLoadavg()
+		return loadAvgDetailOutput(s, procs, ok)
 	})
-
-	uptime := sysinfo.New().Output(func(s sysinfo.Info) bar.Output {
-		u := s.Uptime
-		var uptimeOut *pango.Node
-		if u.Hours() < 24 {
-			uptimeOut = pango.Textf("%d:%02d",
-				int(u.Hours()), int(u.Minutes())%60)
-		} else {
-			uptimeOut = pango.Textf("%dd%02dh",
-				int(u.Hours()/24), int(u.Hours())%24)
+	uptime := sysinfo.New().Output(uptimeOutput)
+	session := pollEvery(time.Minute, func(s bar.Sink) {
+		info, ok := loginSession(time.Now())
+		if !ok {
+			s.Output(nil)
+			return
 		}
-		return pango.Icon("mdi-weather-sunset-up").Concat(spacer, uptimeOut)
+		s.Output(sessionOutput(info))
 	})
 
-	freeMem := meminfo.New().Output(func(m meminfo.Info) bar.Output {
-		out := outputs.Pango(
-			pango.Icon("mdi-memory"),
-			spacer,
-			format.IBytesize(m.Available()),
-		)
-		freeGigs := m.Available().Gigabytes()
-		threshold(out,
-			freeGigs < 0.5,
-			freeGigs < 1,
-			freeGigs < 2,
-			freeGigs > 12)
-		out.OnClick(click.Left(func() {
-			mainModalController.Toggle("sysinfo")
-		}))
-		return out
-	})
+	freeMem := meminfo.New().Output(freeMemOutput)
+	swapMem := meminfo.New().Output(swapMemOutput)
 
-	swapMem := meminfo.New().Output(func(m meminfo.Info) bar.Output {
-		return outputs.Pango(
-			pango.Icon("mdi-swap-horizontal"),
-			spacer,
-			format.IBytesize(m["SwapTotal"]-m["SwapFree"]),
-			pango.Textf("(%2.0f%%)", (1-m.FreeFrac("Swap"))*100.0).Small(),
-		)
-	})
+	tempSamples := newRingBuffer(tempHistory)
+	throttle := &throttleDetector{}
+	var temp, tempSensors bar.Module
+	if len(hwmonChips) == 0 {
+		cpuTemp := cputemp.New()
+		if zone, ok := cpuThermalZone(); ok {
+			cpuTemp = cputemp.Zone(zone)
+		}
+		temp = cpuTemp.
+			RefreshInterval(2 * time.Second).
+			Output(func(temp unit.Temperature) bar.Output {
+				tempSamples.Add(temp.Celsius())
+				throttling, _ := throttle.Throttling()
+				return tempOutput(temp, tempSamples.Values(), throttling)
+			})
+	} else {
+		// Hottest sensor in place of cputemp, with the per-sensor breakdown
+		// on its own detail line.
+		temp, tempSensors = split.New(pollEvery(2*time.Second, func(s bar.Sink) {
+			readings := hwmonTemps(hwmonChips)
+			if len(readings) > 0 {
+				tempSamples.Add(hottest(readings).Temp.Celsius())
+			}
+			throttling, _ := throttle.Throttling()
+			s.Output(hwmonOutput(readings, tempSamples.Values(), throttling))
+		}), 1)
+	}
 
-	temp := cputemp.New().
-		RefreshInterval(2 * time.Second).
-		Output(func(temp unit.Temperature) bar.Output {
-			out := outputs.Pango(
-				pango.Icon("mdi-fan"), spacer,
-				pango.Textf("%2d℃", int(temp.Celsius())),
-			)
-			threshold(out,
-				temp.Celsius() > 90,
-				temp.Celsius() > 70,
-				temp.Celsius() > 60,
-			)
-			return out
-		})
+	cgroupMem := newCgroupMemPressure()
 
-	sub := netlink.Any()
-	iface := sub.Get().Name
-	sub.Unsubscribe()
-	netsp := netspeed.New(iface).
-		RefreshInterval(2 * time.Second).
-		Output(func(s netspeed.Speeds) bar.Output {
-			return outputs.Pango(
-				pango.Icon("mdi-upload"), pango.Textf("%7s", format.Byterate(s.Tx)),
-				pango.Text(" ").Small(),
-				pango.Icon("mdi-download"), pango.Textf("%7s", format.Byterate(s.Rx)),
-			)
+	var coreHeatmap bar.Module = static.New(nil)
+	if showCoreHeatmap {
+		var cores coreSampler
+		coreHeatmap = pollEvery(2*time.Second, func(s bar.Sink) {
+			if usage, ok := cores.Sample(); ok {
+				s.Output(coreHeatmapOutput(usage))
+			}
 		})
+	}
 
-	net := netinfo.New().Output(func(i netinfo.State) bar.Output {
-		if !i.Enabled() {
-			return nil
+	cpuFrequency := pollEvery(2*time.Second, func(s bar.Sink) {
+		f, ok := cpuFreq()
+		if !ok {
+			// cpufreq not exposed and no MHz in /proc/cpuinfo (e.g. some VMs).
+			s.Output(nil)
+			return
 		}
-		if i.Connecting() || len(i.IPs) < 1 {
-			return outputs.Text(i.Name).Color(colors.Scheme("degraded"))
+		s.Output(cpuFreqOutput(f))
+	})
+
+	// SI units, to match the speeds advertised by ISPs.
+	netspUnit := rateSI
+	linkMon := newLinkMonitor()
+	// Follows the primary interface, e.g. when a VPN comes up or wifi
+	// takes over from ethernet.
+	netsp := newIfaceFollower(linkMon, func(iface string) bar.Module {
+		// Each interface keeps its own history, since the speeds of a VPN
+		// and the link under it don't belong on one graph.
+		netspPeak := &peakRate{resetInterval: time.Hour}
+		// One sample per refresh, so 30 samples is the last minute.
+		txSamples, rxSamples := newRingBuffer(30), newRingBuffer(30)
+		// Totals for this month, to track against a data cap.
+		netspTotals := newNetCumulative(iface).WithCumulativeReset(monthStart)
+		// Polled rather than barista's netspeed module, so that it's
+		// measured again straight after a resume from suspend.
+		meter := newNetSpeedMeter(iface)
+		return pollEvery(2*time.Second, func(sink bar.Sink) {
+			s, ok := meter.Update(time.Now())
+			if !ok {
+				sink.Output(nil)
+				return
+			}
+			info := netspeedInfo{Speeds: s, Peak: netspPeak.Update(s.Rx)}
+			if s.Tx > info.Peak {
+				info.Peak = netspPeak.Update(s.Tx)
+			}
+			txSamples.Add(s.Tx.BytesPerSecond())
+			rxSamples.Add(s.Rx.BytesPerSecond())
+			info.TxSamples, info.RxSamples = txSamples.Values(), rxSamples.Values()
+			info.TotalRx, info.TotalTx = netspTotals.Update()
+			sink.Output(netspeedOutput(info, netspUnit))
+		})
+	})
+
+	dhcpExpiry := pollEvery(30*time.Second, func(s bar.Sink) {
+		lease, ok := dhcpLease(primaryInterface())
+		if !ok {
+			s.Output(nil)
+			return
 		}
-		return outputs.Group(outputs.Text(i.Name), outputs.Textf("%s", i.IPs[0]))
+		s.Output(dhcpOutput(lease, time.Now()))
 	})
 
-	formatDiskSpace := func(i diskspace.Info, icon string) bar.Output {
-		out := outputs.Pango(
-			pango.Icon(icon), spacer, format.IBytesize(i.Available))
-		return threshold(out,
-			i.Available.Gigabytes() < 1,
-			i.AvailFrac() < 0.05,
-			i.AvailFrac() < 0.1,
-		)
+	net := netinfo.New().Output(netinfoOutput)
+	mtu := newMTUModule(linkMon)
+	var pings pingStats
+	pingSummary, pingDetail := split.New(pollEvery(pingInterval, func(s bar.Sink) {
+		s.Output(pingOutput(pings.ping()))
+	}), 1)
+	portal := newCaptivePortal()
+	dnsSummary, dnsDetail := split.New(pollEvery(dnsCheckInterval, func(s bar.Sink) {
+		s.Output(dnsOutput(checkDNS()))
+	}), 1)
+
+	diskspaceFor := func(path, icon string) (summary, detail bar.Module) {
+		return split.New(diskspace.New(path).Output(func(i diskspace.Info) bar.Output {
+			inodesFree, hasInodes := inodeFreeFrac(path)
+			return diskSpaceOutput(i, inodesFree, hasInodes, icon)
+		}), 1)
 	}
 
 	rootDev := deviceForMountPath("/")
-	var homeDiskspace bar.Module
+	var homeDiskspace, homeInodes bar.Module
 	if deviceForMountPath(home()) != rootDev {
-		homeDiskspace = diskspace.New(home()).Output(func(i diskspace.Info) bar.Output {
-			return formatDiskSpace(i, "mdi-home-outline")
-		})
+		homeDiskspace, homeInodes = diskspaceFor(home(), "mdi-home-outline")
+	}
+	rootDiskspace, rootInodes := diskspaceFor("/", "mdi-harddisk")
+	var extraDiskspace, extraInodes []bar.Module
+	for _, m := range extraMounts {
+		if mounted, err := isMountPoint(m.Path); err != nil || !mounted {
+			if err == nil {
+				err = errors.New("nothing mounted there")
+			}
+			logWarnf("Skipping diskspace for %s: %v", m.Path, err)
+			continue
+		}
+		space, inodes := diskspaceFor(m.Path, m.Icon)
+		extraDiskspace = append(extraDiskspace, space)
+		extraInodes = append(extraInodes, inodes)
 	}
-	rootDiskspace := diskspace.New("/").Output(func(i diskspace.Info) bar.Output {
-		return formatDiskSpace(i, "mdi-harddisk")
-	})
 
-	mainDiskio := diskio.New(strings.TrimPrefix(rootDev, "/dev/")).
+	rootDevName := strings.TrimPrefix(rootDev, "/dev/")
+	rootUtil := newDiskUtilization(rootDevName)
+	mainDiskio := showDuring(diskio.New(rootDevName).
 		Output(func(r diskio.IO) bar.Output {
-			return pango.Icon("mdi-swap-vertical").
-				Concat(spacer).
-				ConcatText(format.IByterate(r.Total()))
-		})
+			util, ok := rootUtil.Update()
+			return diskioOutput(rootDevName, r, util, ok)
+		}), diskioHours.From, diskioHours.Until)
+
+	mediaSrc := newMediaSource(mediaFormatFunc)
+	mediaSummary, mediaDetail := split.New(mediaSrc, 1)
+	mediaSelect := newMediaSelector(mediaSrc)
+
+	mediaUpNext := pollEvery(5*time.Second, func(s bar.Sink) {
+		q, ok := mediaQueue(2)
+		if !ok {
+			s.Output(nil)
+			return
+		}
+		s.Output(mediaUpNextOutput(q))
+	})
+
+	calendar := newICalendar(icalendarPath, calendarOutput)
+	onRefresh(calendar.update)
+	calendarSummary, calendarDetail := split.New(calendar, 1)
 
-	mediaSummary, mediaDetail := split.New(media.Auto().Output(mediaFormatFunc), 1)
+	usbEvents := newUsbWatcher()
+	colorPick := newColorPicker()
 
 	mainModal := modal.New()
-	mainModal.Mode("kubeContext").
-		SetOutput(makeIconOutput("mdi-ship-wheel")).
-		Add(kubeContext).
-		Detail(kubeNs)
-	mainModal.Mode("network").
-		SetOutput(makeIconOutput("mdi-ethernet")).
-		Summary(wifiName).
-		Detail(wifiDetails, netsp, net)
-	mainModal.Mode("media").
-		SetOutput(makeIconOutput("mdi-music")).
-		Add(vol, mediaSummary).
-		Detail(mediaDetail)
-	sysMode := mainModal.Mode("sysinfo").
-		SetOutput(makeIconOutput("mdi-chart-line-stacked")).
-		Detail(loadAvg).
-		Detail(loadAvgDetail, uptime).
-		Detail(freeMem).
-		Detail(swapMem, temp).
-		Detail(mainDiskio).
-		Add(rootDiskspace)
-	if homeDiskspace != nil {
-		sysMode.Add(homeDiskspace)
-	}
-	mainModal.Mode("battery").
-		// Filled in by the battery module if one is available.
-		SetOutput(nil).
-		Summary(battSummary).
-		Detail(battDetail)
-	mainModal.Mode("weather").
-		// Set to current conditions by the weather module.
-		SetOutput(makeIconOutput("mdi-alert-box-outline")).
-		Detail(wthr)
-	mainModal.Mode("timezones").
-		SetOutput(makeIconOutput("mdi-clock-outline")).
-		Detail(makeTzClock("Los Angeles", "America/Los_Angeles")).
-		Detail(makeTzClock("New York", "America/New_York")).
-		Detail(makeTzClock("UTC", "Etc/UTC")).
-		Detail(makeTzClock("Copenhagen", "Europe/Copenhagen")).
-		Detail(makeTzClock("Tokyo", "Asia/Tokyo"))
+	modes := map[string]func(){
+		"kubeContext": func() {
+			mainModal.Mode("kubeContext").
+				SetOutput(makeIconOutput("mdi-ship-wheel")).
+				Add(kubeContext).
+				Detail(pauseWhenCollapsed("kubeContext", kubeNs)...)
+		},
+		"network": func() {
+			mainModal.Mode("network").
+				SetOutput(makeIconOutput("mdi-ethernet")).
+				Summary(wifiName).
+				Add(portal, dhcpExpiry, pingSummary, dnsSummary).
+				Detail(wifiDetails, netsp, net, mtu, pingDetail, dnsDetail)
+		},
+		"media": func() {
+			mainModal.Mode("media").
+				SetOutput(makeIconOutput("mdi-music")).
+				Add(vol, eq, mic, mediaSummary).
+				Detail(mediaDetail, mediaUpNext, mediaSelect, appVol)
+		},
+		"sysinfo": func() {
+			sysMode := mainModal.Mode("sysinfo").
+				SetOutput(makeIconOutput("mdi-chart-line-stacked")).
+				Detail(loadAvg).
+				Detail(loadAvgDetail, uptime, session).
+				Detail(freeMem).
+				Detail(swapMem, temp).
+				Detail(cpuFrequency, coreHeatmap).
+				Detail(cgroupMem).
+				Detail(mainDiskio).
+				Add(rootDiskspace).
+				Detail(rootInodes)
+			if tempSensors != nil {
+				sysMode.Detail(tempSensors)
+			}
+			if homeDiskspace != nil {
+				sysMode.Add(homeDiskspace).Detail(homeInodes)
+			}
+			sysMode.Add(extraDiskspace...).Detail(extraInodes...)
+		},
+		"battery": func() {
+			mainModal.Mode("battery").
+				// Filled in by the battery module if one is available.
+				SetOutput(nil).
+				Summary(battSummary).
+				Detail(battDetail, power)
+		},
+		"weather": func() {
+			mainModal.Mode("weather").
+				// Set to current conditions by the weather module.
+				SetOutput(makeIconOutput("mdi-alert-box-outline")).
+				Summary(wthrSummary).
+				Detail(wthrDetail, airQuality, weatherLinker)
+		},
+		"timezones": func() {
+			mainModal.Mode("timezones").
+				SetOutput(makeIconOutput("mdi-clock-outline")).
+				Detail(makeTzClock("Los Angeles", "America/Los_Angeles")).
+				Detail(makeTzClock("New York", "America/New_York")).
+				Detail(makeTzClock("UTC", "Etc/UTC")).
+				Detail(makeTzClock("Copenhagen", "Europe/Copenhagen")).
+				Detail(makeTzClock("Tokyo", "Asia/Tokyo")).
+				Detail(workDay).
+				Detail(stopwatchModule)
+		},
+		"calendar": func() {
+			mainModal.Mode("calendar").
+				SetOutput(makeIconOutput("mdi-calendar")).
+				Summary(calendarSummary).
+				Detail(calendarDetail)
+		},
+		"profiles": func() {
+			mainModal.Mode("profiles").
+				SetOutput(makeIconOutput("mdi-palette")).
+				Detail(newColorProfileSwitcher())
+		},
+	}
+	layout := loadLayout()
+	for _, name := range layout.Modes {
+		if addMode, ok := modes[name]; ok {
+			addMode()
+		} else {
+			logWarnf("Skipping unknown mode %q", name)
+		}
+	}
 
 	var mm bar.Module
 	mm, mainModalController = mainModal.Build()
-	panic(barista.Run(mm, localdate, localtime))
+	if *setupOauth || *renderOnce {
+		// The bar runs the start hooks itself, but these don't start it.
+		if err := runStartHooks(); err != nil {
+			logFatalf("Startup failed: %v", err)
+		}
+	}
+	if *setupOauth {
+		// Modules register their oauth configs when they're created, so
+		// this has to wait until they all have been.
+		oauth.InteractiveSetup()
+		return
+	}
+	if *renderOnce {
+		resumePaused()
+		printOnce([]namedModule{
+			{Name: "localdate", Module: localdate},
+			{Name: "localtime", Module: localtime},
+			{Name: "workDay", Module: workDay},
+			{Name: "kubeContext", Module: kubeContext},
+			{Name: "kubeNs", Module: kubeNs},
+			{Name: "wifiName", Module: wifiName},
+			{Name: "wifiDetails", Module: wifiDetails},
+			{Name: "dhcpExpiry", Module: dhcpExpiry},
+			{Name: "ping", Module: pingSummary},
+			{Name: "dns", Module: dnsSummary},
+			{Name: "captivePortal", Module: portal},
+			{Name: "netsp", Module: netsp, Live: true},
+			{Name: "net", Module: net},
+			{Name: "mtu", Module: mtu},
+			{Name: "vol", Module: vol},
+			{Name: "mic", Module: mic},
+			{Name: "appVol", Module: appVol},
+			{Name: "eq", Module: eq},
+			{Name: "mediaSummary", Module: mediaSummary},
+			{Name: "mediaDetail", Module: mediaDetail},
+			{Name: "mediaUpNext", Module: mediaUpNext},
+			{Name: "mediaSelect", Module: mediaSelect},
+			{Name: "loadAvg", Module: loadAvg},
+			{Name: "loadAvgDetail", Module: loadAvgDetail},
+			{Name: "uptime", Module: uptime},
+			{Name: "session", Module: session},
+			{Name: "freeMem", Module: freeMem},
+			{Name: "swapMem", Module: swapMem},
+			{Name: "temp", Module: temp},
+			{Name: "tempSensors", Module: tempSensors},
+			{Name: "cpuFrequency", Module: cpuFrequency},
+			{Name: "coreHeatmap", Module: coreHeatmap},
+			{Name: "cgroupMem", Module: cgroupMem},
+			{Name: "mainDiskio", Module: mainDiskio, Live: true},
+			{Name: "rootDiskspace", Module: rootDiskspace},
+			{Name: "homeDiskspace", Module: homeDiskspace},
+			{Name: "battSummary", Module: battSummary},
+			{Name: "battDetail", Module: battDetail},
+			{Name: "power", Module: power},
+			{Name: "weather", Module: wthr},
+			{Name: "airQuality", Module: airQuality},
+		})
+		return
+	}
+	topLevel := map[string]bar.Module{
+		"workspaces":  newWorkspaces(),
+		"window":      newFocusedWindow(),
+		"display":     newDisplayToggle(),
+		"usb":         usbEvents,
+		"colorpicker": colorPick,
+		"clipboard":   newClipboardModule(),
+		"pomodoro":    newPomodoro(),
+		"ticker":      newTickerModule(),
+		"webcam":      newWebcamModule(),
+		"idle":        newIdleModule(),
+		"recording":   newRecordingModule(),
+		"gpg":         newGPGModule(),
+		"modes":       mm,
+		"localdate":   localdate,
+		"localtime":   localtime,
+	}
+	for name, m := range loadCommandModules() {
+		if _, ok := topLevel[name]; ok {
+			logWarnf("Command %q has the same name as a module, skipping it", name)
+			continue
+		}
+		topLevel[name] = m
+	}
+	var barModules []bar.Module
+	for _, name := range layout.Modules {
+		if m, ok := topLevel[name]; ok {
+			barModules = append(barModules, m)
+		} else {
+			logWarnf("Skipping unknown module %q", name)
+		}
+	}
+	go watchModes(ctx.Done())
+	if err := runUntil(ctx, barModules...); err != nil {
+		logFatalf("Bar exited: %v", err)
+	}
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	keyring "github.com/zalando/go-keyring"
+)
+
+func TestBandThreshold(t *testing.T) {
+	bands := []band{
+		{10, "good"},
+		{20, "degraded"},
+		{30, "bad"},
+		{40, ""},
+		{above, "urgent"},
+	}
+	for _, tc := range []struct {
+		value float64
+		want  thresholdConfig
+	}{
+		{math.Inf(-1), thresholdConfig{Good: true}},
+		{-5, thresholdConfig{Good: true}},
+		{10, thresholdConfig{Good: true}},
+		{math.Nextafter(10, 11), thresholdConfig{Degraded: true}},
+		{20, thresholdConfig{Degraded: true}},
+		{20.5, thresholdConfig{Bad: true}},
+		{30, thresholdConfig{Bad: true}},
+		{35, thresholdConfig{}},
+		{40, thresholdConfig{}},
+		{40.01, thresholdConfig{Urgent: true}},
+		{math.Inf(1), thresholdConfig{Urgent: true}},
+	} {
+		if got := bandThreshold(tc.value, bands...); got != tc.want {
+			t.Errorf("bandThreshold(%v) = %+v, want %+v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestBandThresholdOpenEnded(t *testing.T) {
+	// Without an "above" band, values past the last band aren't styled.
+	bands := []band{{1, "urgent"}, {2, "bad"}}
+	for _, tc := range []struct {
+		value float64
+		want  thresholdConfig
+	}{
+		{1, thresholdConfig{Urgent: true}},
+		{2, thresholdConfig{Bad: true}},
+		{2.01, thresholdConfig{}},
+		{math.Inf(1), thresholdConfig{}},
+	} {
+		if got := bandThreshold(tc.value, bands...); got != tc.want {
+			t.Errorf("bandThreshold(%v) = %+v, want %+v", tc.value, got, tc.want)
+		}
+	}
+	if got := bandThreshold(5); got != (thresholdConfig{}) {
+		t.Errorf("bandThreshold with no bands = %+v", got)
+	}
+}
+
+func TestWorstOf(t *testing.T) {
+	got := worstOf(thresholdConfig{Good: true}, thresholdConfig{Bad: true}, thresholdConfig{})
+	if want := (thresholdConfig{Good: true, Bad: true}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := worstOf(); got != (thresholdConfig{}) {
+		t.Errorf("worstOf() = %+v", got)
+	}
+}
+
+func TestOauthEncryptionKeyMovesToKeyring(t *testing.T) {
+	defer func(f string) { oauthKeyFile = f }(oauthKeyFile)
+	oauthKeyFile = filepath.Join(t.TempDir(), "oauth-key")
+	defer keyring.MockInit()
+
+	// Without a keyring, the key is kept in the file.
+	keyring.MockInitWithError(errors.New("no secret service"))
+	first, err := oauthEncryptionKey("test", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(oauthKeyFile); err != nil {
+		t.Fatalf("key not written to the file: %v", err)
+	}
+	if again, _ := oauthEncryptionKey("test", "user"); !bytes.Equal(again, first) {
+		t.Error("file key changed between runs")
+	}
+
+	// Once the keyring is back, the same key moves into it.
+	keyring.MockInit()
+	moved, err := oauthEncryptionKey("test", "user")
+	if err != nil || !bytes.Equal(moved, first) {
+		t.Fatalf("got a different key once the keyring was available: %v", err)
+	}
+	if _, err := os.Stat(oauthKeyFile); !os.IsNotExist(err) {
+		t.Errorf("file key not removed after moving it: %v", err)
+	}
+	if stored, _ := oauthEncryptionKey("test", "user"); !bytes.Equal(stored, first) {
+		t.Error("key not read back from the keyring")
+	}
+}
+
+func TestOauthEncryptionKeyKeyringOnly(t *testing.T) {
+	defer func(f string) { oauthKeyFile = f }(oauthKeyFile)
+	oauthKeyFile = filepath.Join(t.TempDir(), "oauth-key")
+	keyring.MockInit()
+
+	key, err := oauthEncryptionKey("test", "user")
+	if err != nil || len(key) != 64 {
+		t.Fatalf("got %d byte key, %v", len(key), err)
+	}
+	if again, _ := oauthEncryptionKey("test", "user"); !bytes.Equal(again, key) {
+		t.Error("new key generated despite one in the keyring")
+	}
+	if _, err := os.Stat(oauthKeyFile); !os.IsNotExist(err) {
+		t.Errorf("key written to a file with a keyring available: %v", err)
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		l    int
+		want string
+	}{
+		{"/home/user/very/long/path.go", 15, "/home/u⋯path.go"},
+		// The extra rune goes to the end.
+		{"/home/user/very/long/path.go", 16, "/home/u⋯/path.go"},
+		{"nvme0n1p3", 9, "nvme0n1p3"},
+		{"nvme0n1p3", 10, "nvme0n1p3"},
+		{"nvme0n1p3", 7, "nvm⋯1p3"},
+		{"nvme0n1p3", 8, "nvm⋯n1p3"},
+		{"nvme0n1p3", 3, "n⋯3"},
+		{"nvme0n1p3", 2, "⋯"},
+		{"nvme0n1p3", 0, "⋯"},
+		{"", 0, ""},
+		// Runes, not bytes.
+		{"Ærøskøbing–Søby", 9, "Ærøs⋯Søby"},
+		{"日本語のファイル名", 5, "日本⋯ル名"},
+	} {
+		got := truncateMiddle(tc.in, tc.l)
+		if got != tc.want {
+			t.Errorf("truncateMiddle(%q, %d) = %q, want %q", tc.in, tc.l, got, tc.want)
+		}
+		if n := len([]rune(got)); n > tc.l && got != "⋯" {
+			t.Errorf("truncateMiddle(%q, %d) is %d runes long", tc.in, tc.l, n)
+		}
+	}
+}
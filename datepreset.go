@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// datePresetFile remembers the date format preset across restarts.
+var datePresetFile = home(".cache/barista/date-preset")
+
+// datePresets are the formats the date cycles through on scroll: the short
+// date, the short date with the ISO week number, and the full ISO date.
+var datePresets = []string{"short", "week", "iso"}
+
+var datePreset int32
+
+// formatDate formats now with the current preset.
+func formatDate(now time.Time, short string) string {
+	switch datePresets[atomic.LoadInt32(&datePreset)] {
+	case "week":
+		_, week := now.ISOWeek()
+		return fmt.Sprintf("%s W%02d", now.Format(short), week)
+	case "iso":
+		return now.Format("2006-01-02")
+	}
+	return now.Format(short)
+}
+
+// cycleDatePreset switches delta presets on, wrapping around, and saves
+// the choice.
+func cycleDatePreset(delta int) {
+	n := int32(len(datePresets))
+	i := ((atomic.LoadInt32(&datePreset)+int32(delta))%n + n) % n
+	atomic.StoreInt32(&datePreset, i)
+	if os.MkdirAll(filepath.Dir(datePresetFile), 0755) == nil {
+		ioutil.WriteFile(datePresetFile, []byte(datePresets[i]+"\n"), 0644)
+	}
+}
+
+// loadDatePreset restores the preset saved by cycleDatePreset.
+func loadDatePreset() {
+	data, err := ioutil.ReadFile(datePresetFile)
+	if err != nil {
+		return
+	}
+	name := strings.TrimSpace(string(data))
+	for i, p := range datePresets {
+		if p == name {
+			atomic.StoreInt32(&datePreset, int32(i))
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+)
+
+func TestDatePresetScroll(t *testing.T) {
+	defer func(f string) { datePresetFile = f }(datePresetFile)
+	datePresetFile = filepath.Join(t.TempDir(), "date-preset")
+	defer atomic.StoreInt32(&datePreset, 0)
+	atomic.StoreInt32(&datePreset, 0)
+
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	scroll := func(button bar.Button) string {
+		t.Helper()
+		localdateOutput(now).Segments()[0].Click(bar.Event{Button: button})
+		return formatDate(now, "Jan 2")
+	}
+	for _, tc := range []struct {
+		button bar.Button
+		want   string
+	}{
+		{bar.ScrollUp, "Oct 17 W42"},
+		{bar.ScrollUp, "2026-10-17"},
+		{bar.ScrollUp, "Oct 17"},
+		{bar.ScrollDown, "2026-10-17"},
+		{bar.ButtonMiddle, "2026-10-17"},
+	} {
+		if got := scroll(tc.button); got != tc.want {
+			t.Errorf("after %v: got %q, want %q", tc.button, got, tc.want)
+		}
+	}
+
+	if data, _ := ioutil.ReadFile(datePresetFile); string(data) != "iso\n" {
+		t.Errorf("saved %q", data)
+	}
+	atomic.StoreInt32(&datePreset, 0)
+	loadDatePreset()
+	if got := formatDate(now, "Jan 2"); got != "2026-10-17" {
+		t.Errorf("after loading: got %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"barista.run/bar"
+	"barista.run/outputs"
+	"barista.run/pango"
+)
+
+// prependSegment returns out with seg added before its segments. seg takes
+// the colour, urgency and click handler of out's first segment unless it
+// sets its own, so that decorating an output, e.g. with an icon, doesn't
+// lose its styling the way outputs.Group would.
+func prependSegment(out bar.Output, seg *bar.Segment) bar.Output {
+	segs := segmentsOf(out)
+	if len(segs) == 0 {
+		return bar.Segments{seg}
+	}
+	return append(bar.Segments{inherit(seg, segs[0])}, segs...)
+}
+
+// withIcon returns out with the icon key in front, joined to it without a
+// separator and styled like it, e.g. so that an error keeps the icon of the
+// module it came from.
+func withIcon(out bar.Output, key string) bar.Output {
+	return prependSegment(out, outputs.Pango(pango.Icon(key), spacer).Separator(false).Padding(0))
+}
+
+func segmentsOf(out bar.Output) bar.Segments {
+	if out == nil {
+		return nil
+	}
+	return append(bar.Segments(nil), out.Segments()...)
+}
+
+// inherit returns a copy of seg with any styling it doesn't set itself
+// taken from from.
+func inherit(seg, from *bar.Segment) *bar.Segment {
+	seg = seg.Clone()
+	if _, ok := seg.GetColor(); !ok {
+		if c, ok := from.GetColor(); ok {
+			seg.Color(c)
+		}
+	}
+	if _, ok := seg.IsUrgent(); !ok {
+		if u, ok := from.IsUrgent(); ok {
+			seg.Urgent(u)
+		}
+	}
+	if !seg.HasClick() && from.HasClick() {
+		seg.OnClick(from.Click)
+	}
+	return seg
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+func TestPrependSegmentInherits(t *testing.T) {
+	clicked := false
+	out := outputs.Group(
+		outputs.Text("inner").Color(schemeColor("bad")).Urgent(true).
+			OnClick(func(bar.Event) { clicked = true }),
+		outputs.Text("detail"),
+	)
+	icon := outputs.Text("icon")
+	got := prependSegment(out, icon)
+	baristatest.AssertOutput(t, func(o bar.Output) bar.Output { return o }, got,
+		baristatest.SegmentCount(3),
+		baristatest.SegmentText(0, "icon"),
+		baristatest.Color(0, schemeColor("bad")),
+		baristatest.IsUrgent(0),
+		baristatest.SegmentText(1, "inner"))
+	got.Segments()[0].Click(bar.Event{Button: bar.ButtonLeft})
+	if !clicked {
+		t.Error("click on the prepended segment not forwarded")
+	}
+	// The original output and segment are left alone.
+	if _, ok := icon.GetColor(); ok {
+		t.Error("prepended segment styled in place")
+	}
+	if n := len(out.Segments()); n != 2 {
+		t.Errorf("original output now has %d segments", n)
+	}
+}
+
+func TestPrependSegmentKeepsOwnStyle(t *testing.T) {
+	out := outputs.Text("inner").Color(schemeColor("bad")).Urgent(true)
+	seg := outputs.Text("icon").Color(schemeColor("good")).Urgent(false)
+	baristatest.AssertOutput(t, func(o bar.Output) bar.Output { return prependSegment(o, seg) }, out,
+		baristatest.Color(0, schemeColor("good")),
+		baristatest.Color(1, schemeColor("bad")),
+		baristatest.IsUrgent(1))
+	if u, _ := prependSegment(out, seg).Segments()[0].IsUrgent(); u {
+		t.Error("own urgency replaced")
+	}
+
+	if got := prependSegment(nil, outputs.Text("icon")); len(got.Segments()) != 1 {
+		t.Errorf("prepending to nil: %d segments", len(got.Segments()))
+	}
+}
+
+func TestCommandOutputIcon(t *testing.T) {
+	seg, err := parseCommandConfig(commandConfig{
+		Name: "queue", Command: "queue-depth", Icon: "mdi-tray-full",
+		Thresholds: map[string]string{"bad": "> 100", "good": "<= 10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := func(out [2]string) bar.Output { return commandOutput(seg, out[0], out[1]) }
+	baristatest.AssertOutput(t, output, [2]string{"250", ""},
+		baristatest.SegmentCount(2),
+		baristatest.Icon(0, "mdi-tray-full"),
+		baristatest.Color(0, schemeColor("bad")),
+		baristatest.SegmentText(1, "250"),
+		baristatest.Color(1, schemeColor("bad")))
+	// Errors keep the icon, so it's clear which command failed.
+	baristatest.AssertOutput(t, output, [2]string{"", "queue-depth: not found\nmore"},
+		baristatest.Icon(0, "mdi-tray-full"),
+		baristatest.IsUrgent(0),
+		baristatest.SegmentText(1, "queue-depth: not found"),
+		baristatest.IsUrgent(1))
+	baristatest.AssertOutput(t, output, [2]string{"", ""}, baristatest.Empty())
+
+	seg.icon = ""
+	baristatest.AssertOutput(t, output, [2]string{"5", ""},
+		baristatest.SegmentCount(1),
+		baristatest.SegmentText(0, "5"),
+		baristatest.Color(0, schemeColor("good")))
+}
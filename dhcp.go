@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type dhcpInfo struct {
+	Interface string
+	Expiry    time.Time
+	Renewing  bool
+}
+
+// dhcpLease looks up the current DHCP lease for iface, trying
+// NetworkManager, dhclient and dhcpcd in turn.
+func dhcpLease(iface string) (dhcpInfo, bool) {
+	if info, ok := networkManagerLease(iface); ok {
+		return info, true
+	}
+	dhclientFiles, _ := filepath.Glob("/var/lib/dhcp/dhclient*.leases")
+	moreFiles, _ := filepath.Glob("/var/lib/dhclient/*.lease*")
+	for _, f := range append(dhclientFiles, moreFiles...) {
+		file, err := os.Open(f)
+		if err != nil {
+			continue
+		}
+		info, ok := parseDhclientLeases(file, iface, time.Now())
+		file.Close()
+		if ok {
+			return info, true
+		}
+	}
+	for _, f := range []string{
+		"/var/lib/dhcpcd/" + iface + ".lease",
+		"/var/lib/dhcpcd/dhcpcd-" + iface + ".lease",
+	} {
+		if info, ok := dhcpcdLease(f, iface, time.Now()); ok {
+			return info, true
+		}
+	}
+	return dhcpInfo{}, false
+}
+
+// parseDhclientLeases returns the last lease for iface in a dhclient.leases
+// file, e.g.
+//
+//	lease {
+//	  interface "eth0";
+//	  renew 2 2021/07/06 10:00:00;
+//	  expire 2 2021/07/06 14:00:00;
+//	}
+//
+// Times in the file are UTC. Renewing is true once the renew time has
+// passed but the lease hasn't yet expired.
+func parseDhclientLeases(r io.Reader, iface string, now time.Time) (info dhcpInfo, found bool) {
+	const layout = "2006/01/02 15:04:05"
+	var cur dhcpInfo
+	var renew time.Time
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(s.Text()), ";"))
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "lease":
+			cur, renew = dhcpInfo{}, time.Time{}
+		case "interface":
+			if len(fields) > 1 {
+				cur.Interface = strings.Trim(fields[1], `"`)
+			}
+		case "renew", "expire":
+			// Format is "<weekday> <date> <time>", or "never".
+			if len(fields) < 4 {
+				continue
+			}
+			t, err := time.ParseInLocation(layout, fields[2]+" "+fields[3], time.UTC)
+			if err != nil {
+				continue
+			}
+			if fields[0] == "renew" {
+				renew = t
+			} else {
+				cur.Expiry = t
+			}
+		case "}":
+			if cur.Interface == iface && !cur.Expiry.IsZero() {
+				cur.Renewing = !renew.IsZero() && now.After(renew) && now.Before(cur.Expiry)
+				info, found = cur, true
+			}
+		}
+	}
+	return info, found
+}
+
+// dhcpcdLease reads a dhcpcd lease file, which holds the raw DHCP ACK. The
+// lease starts when the file was written and lasts for the lease time
+// option (51); renewal starts after the renewal time option (58), or half
+// the lease time if it's absent.
+func dhcpcdLease(path, iface string, now time.Time) (dhcpInfo, bool) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return dhcpInfo{}, false
+	}
+	msg, err := ioutil.ReadFile(path)
+	if err != nil {
+		return dhcpInfo{}, false
+	}
+	opts := dhcpOptions(msg)
+	lease, ok := opts[51]
+	if !ok || len(lease) != 4 {
+		return dhcpInfo{}, false
+	}
+	leaseTime := time.Duration(binary.BigEndian.Uint32(lease)) * time.Second
+	renewTime := leaseTime / 2
+	if t1, ok := opts[58]; ok && len(t1) == 4 {
+		renewTime = time.Duration(binary.BigEndian.Uint32(t1)) * time.Second
+	}
+	start := stat.ModTime()
+	return dhcpInfo{
+		Interface: iface,
+		Expiry:    start.Add(leaseTime),
+		Renewing:  now.After(start.Add(renewTime)),
+	}, true
+}
+
+// dhcpOptions parses the options section of a raw DHCP message.
+func dhcpOptions(msg []byte) map[byte][]byte {
+	// 236 bytes of fixed fields, followed by the 4 byte magic cookie.
+	const optionsStart = 240
+	opts := map[byte][]byte{}
+	if len(msg) < optionsStart ||
+		binary.BigEndian.Uint32(msg[236:240]) != 0x63825363 {
+		return opts
+	}
+	for i := optionsStart; i < len(msg); {
+		code := msg[i]
+		switch code {
+		case 0: // Pad.
+			i++
+			continue
+		case 255: // End.
+			return opts
+		}
+		if i+1 >= len(msg) {
+			break
+		}
+		length := int(msg[i+1])
+		if i+2+length > len(msg) {
+			break
+		}
+		opts[code] = msg[i+2 : i+2+length]
+		i += 2 + length
+	}
+	return opts
+}
+
+// networkManagerLease reads the DHCP4Config of the device for iface over
+// D-Bus. The device is considered to be renewing while it is (re)acquiring
+// its IP configuration.
+func networkManagerLease(iface string) (dhcpInfo, bool) {
+	const nmService = "org.freedesktop.NetworkManager"
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return dhcpInfo{}, false
+	}
+	var devicePath dbus.ObjectPath
+	err = conn.Object(nmService, "/org/freedesktop/NetworkManager").
+		Call(nmService+".GetDeviceByIpIface", 0, iface).
+		Store(&devicePath)
+	if err != nil {
+		return dhcpInfo{}, false
+	}
+	device := conn.Object(nmService, devicePath)
+	configVar, err := device.GetProperty(nmService + ".Device.Dhcp4Config")
+	if err != nil {
+		return dhcpInfo{}, false
+	}
+	configPath, _ := configVar.Value().(dbus.ObjectPath)
+	if configPath == "" || configPath == "/" {
+		return dhcpInfo{}, false
+	}
+	optsVar, err := conn.Object(nmService, configPath).
+		GetProperty(nmService + ".DHCP4Config.Options")
+	if err != nil {
+		return dhcpInfo{}, false
+	}
+	opts, _ := optsVar.Value().(map[string]dbus.Variant)
+	var state uint32
+	if stateVar, err := device.GetProperty(nmService + ".Device.State"); err == nil {
+		state, _ = stateVar.Value().(uint32)
+	}
+	return nmLease(iface, opts, state)
+}
+
+// nmDeviceStateIPConfig is NM_DEVICE_STATE_IP_CONFIG, the state of a
+// device that is (re)acquiring its IP configuration.
+const nmDeviceStateIPConfig = 70
+
+// nmLease builds the lease from NetworkManager's DHCP4Config options, which
+// hold the expiry as a Unix timestamp string, and the device state.
+func nmLease(iface string, opts map[string]dbus.Variant, state uint32) (dhcpInfo, bool) {
+	expiryStr, _ := opts["expiry"].Value().(string)
+	expiry, err := strconv.ParseInt(expiryStr, 10, 64)
+	if err != nil {
+		return dhcpInfo{}, false
+	}
+	return dhcpInfo{
+		Interface: iface,
+		Expiry:    time.Unix(expiry, 0),
+		Renewing:  state == nmDeviceStateIPConfig,
+	}, true
+}
+
+// dhcpRenewCmd renews the lease for the interface given as its final
+// argument. It runs from a click, without a terminal for sudo to prompt
+// in, so pkexec asks for the password through the polkit agent instead.
+var dhcpRenewCmd = []string{"pkexec", "sh", "-c", `dhclient -r "$1" && dhclient "$1"`, "dhcp-renew"}
+
+// renewDHCPLease runs dhcpRenewCmd for iface in the background, and
+// reports if it fails.
+func renewDHCPLease(iface string) {
+	args := append(append([]string(nil), dhcpRenewCmd[1:]...), iface)
+	cmd := exec.Command(dhcpRenewCmd[0], args...)
+	go func() {
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			logWarnf("Renewing the DHCP lease for %s failed: %v: %s", iface, err, out)
+			notify("DHCP renewal failed", fmt.Sprintf("%s: %v", iface, err), false)
+		}
+	}()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"github.com/godbus/dbus/v5"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+const dhclientLeases = `lease {
+  interface "wlan0";
+  fixed-address 192.168.1.20;
+  renew 2 2021/07/06 08:00:00;
+  expire 2 2021/07/06 12:00:00;
+}
+lease {
+  interface "eth0";
+  fixed-address 10.0.0.5;
+  renew 2 2021/07/06 10:00:00;
+  expire 2 2021/07/06 14:00:00;
+}
+lease {
+  interface "eth0";
+  fixed-address 10.0.0.5;
+  renew 2 2021/07/06 11:00:00;
+  expire never;
+}
+`
+
+func TestParseDhclientLeases(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2021, 7, 6, hour, 30, 0, 0, time.UTC) }
+	for _, tc := range []struct {
+		iface    string
+		now      time.Time
+		found    bool
+		expiry   time.Time
+		renewing bool
+	}{
+		{iface: "eth0", now: at(9), found: true, expiry: time.Date(2021, 7, 6, 14, 0, 0, 0, time.UTC)},
+		{iface: "eth0", now: at(10), found: true, expiry: time.Date(2021, 7, 6, 14, 0, 0, 0, time.UTC), renewing: true},
+		// Past the expiry it's no longer renewing, just expired.
+		{iface: "eth0", now: at(14), found: true, expiry: time.Date(2021, 7, 6, 14, 0, 0, 0, time.UTC)},
+		{iface: "wlan0", now: at(9), found: true, expiry: time.Date(2021, 7, 6, 12, 0, 0, 0, time.UTC), renewing: true},
+		{iface: "usb0", now: at(9)},
+	} {
+		info, found := parseDhclientLeases(strings.NewReader(dhclientLeases), tc.iface, tc.now)
+		if found != tc.found {
+			t.Errorf("%s at %v: found = %v", tc.iface, tc.now, found)
+			continue
+		}
+		if !found {
+			continue
+		}
+		if info.Interface != tc.iface || !info.Expiry.Equal(tc.expiry) || info.Renewing != tc.renewing {
+			t.Errorf("%s at %v: got %+v, want expiry %v, renewing %v",
+				tc.iface, tc.now, info, tc.expiry, tc.renewing)
+		}
+	}
+}
+
+// dhcpAck builds a raw DHCP ACK with the given options, as dhcpcd stores
+// it in its lease files.
+func dhcpAck(opts ...[]byte) []byte {
+	msg := make([]byte, 240)
+	msg[0] = 2 // BOOTREPLY
+	binary.BigEndian.PutUint32(msg[236:], 0x63825363)
+	for _, o := range opts {
+		msg = append(msg, o...)
+	}
+	return append(msg, 255)
+}
+
+// seconds returns a DHCP option holding a 32-bit duration in seconds.
+func seconds(code byte, d time.Duration) []byte {
+	o := []byte{code, 4, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(o[2:], uint32(d/time.Second))
+	return o
+}
+
+func TestDhcpcdLease(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2021, 7, 6, 10, 0, 0, 0, time.UTC)
+	write := func(name string, msg []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, msg, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, start, start); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	messageType := []byte{53, 1, 5}
+	pad := []byte{0, 0}
+
+	withT1 := write("eth0.lease", dhcpAck(messageType, pad, seconds(51, 4*time.Hour), seconds(58, time.Hour)))
+	for _, tc := range []struct {
+		now      time.Time
+		renewing bool
+	}{
+		{start.Add(30 * time.Minute), false},
+		{start.Add(90 * time.Minute), true},
+	} {
+		info, ok := dhcpcdLease(withT1, "eth0", tc.now)
+		if !ok {
+			t.Fatal("lease with options 51 and 58 not read")
+		}
+		if !info.Expiry.Equal(start.Add(4*time.Hour)) || info.Renewing != tc.renewing || info.Interface != "eth0" {
+			t.Errorf("at %v: got %+v", tc.now, info)
+		}
+	}
+
+	// Without option 58 renewal starts half way through the lease.
+	noT1 := write("wlan0.lease", dhcpAck(seconds(51, 4*time.Hour)))
+	if info, _ := dhcpcdLease(noT1, "wlan0", start.Add(90*time.Minute)); info.Renewing {
+		t.Error("renewing before half the lease time without option 58")
+	}
+	if info, _ := dhcpcdLease(noT1, "wlan0", start.Add(150*time.Minute)); !info.Renewing {
+		t.Error("not renewing after half the lease time without option 58")
+	}
+
+	for name, msg := range map[string][]byte{
+		"no-lease-time": dhcpAck(messageType),
+		"bad-cookie":    append(make([]byte, 240), seconds(51, time.Hour)...),
+		"truncated":     dhcpAck(seconds(51, time.Hour))[:243],
+	} {
+		if _, ok := dhcpcdLease(write(name, msg), "eth0", start); ok {
+			t.Errorf("%s: got a lease", name)
+		}
+	}
+	if _, ok := dhcpcdLease(filepath.Join(dir, "missing"), "eth0", start); ok {
+		t.Error("got a lease from a missing file")
+	}
+}
+
+func TestNMLease(t *testing.T) {
+	opts := map[string]dbus.Variant{
+		"expiry":     dbus.MakeVariant("1625580000"),
+		"ip_address": dbus.MakeVariant("192.168.1.20"),
+	}
+	info, ok := nmLease("wlan0", opts, 100) // NM_DEVICE_STATE_ACTIVATED
+	if !ok || !info.Expiry.Equal(time.Unix(1625580000, 0)) || info.Renewing {
+		t.Errorf("activated: got %+v, %v", info, ok)
+	}
+	if info, _ := nmLease("wlan0", opts, nmDeviceStateIPConfig); !info.Renewing {
+		t.Error("not renewing while acquiring the IP configuration")
+	}
+	if _, ok := nmLease("wlan0", map[string]dbus.Variant{}, 100); ok {
+		t.Error("got a lease without an expiry")
+	}
+}
+
+func TestDhcpOutput(t *testing.T) {
+	now := time.Date(2021, 7, 6, 10, 0, 0, 0, time.UTC)
+	lease := func(remaining time.Duration) dhcpInfo {
+		return dhcpInfo{Interface: "eth0", Expiry: now.Add(remaining)}
+	}
+	output := func(l dhcpInfo) bar.Output { return dhcpOutput(l, now) }
+	baristatest.AssertOutput(t, output, lease(2*time.Hour),
+		baristatest.Empty())
+	baristatest.AssertOutput(t, output, lease(45*time.Minute),
+		baristatest.SegmentContains(0, "DHCP 0:45"),
+		baristatest.Icon(0, "mdi-clock-alert-outline"),
+		baristatest.Color(0, schemeColor("degraded")))
+	baristatest.AssertOutput(t, output, lease(5*time.Minute),
+		baristatest.SegmentContains(0, "DHCP 0:05"),
+		baristatest.IsUrgent(0))
+	baristatest.AssertOutput(t, output, lease(-5*time.Minute),
+		baristatest.SegmentContains(0, "DHCP expired"),
+		baristatest.IsUrgent(0))
+
+	renewing := lease(30 * time.Minute)
+	renewing.Renewing = true
+	baristatest.AssertOutput(t, output, renewing,
+		baristatest.Icon(0, "mdi-autorenew"))
+}
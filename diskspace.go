@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// statfs is a variable so that inode checks can be stubbed out.
+var statfs = syscall.Statfs
+
+// inodeFreeFrac returns the fraction of inodes still free on the filesystem
+// containing path. ok is false for filesystems that don't have a fixed
+// number of inodes (e.g. btrfs), which report zero total.
+func inodeFreeFrac(path string) (free float64, ok bool) {
+	var st syscall.Statfs_t
+	if err := statfs(path, &st); err != nil || st.Files == 0 {
+		return 0, false
+	}
+	return float64(st.Ffree) / float64(st.Files), true
+}
+
+// mountInfoFile lists the mounts visible to the bar.
+var mountInfoFile = "/proc/self/mountinfo"
+
+// isMountPoint returns whether path is where a filesystem is mounted. A
+// mount point that exists but has nothing mounted on it would otherwise
+// show the space of the filesystem it's on.
+func isMountPoint(path string) (bool, error) {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.Open(mountInfoFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return mountPoints(f)[filepath.Clean(path)], nil
+}
+
+// mountPoints parses the mount points out of a mountinfo file, e.g.
+//
+//	36 35 98:0 / /mnt/data rw,noatime master:1 - ext3 /dev/sdb1 rw
+//
+// where the fifth field is the mount point, with spaces and other special
+// characters escaped in octal.
+func mountPoints(r io.Reader) map[string]bool {
+	mounts := map[string]bool{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mounts[unescapeMountPath(fields[4])] = true
+	}
+	return mounts
+}
+
+// unescapeMountPath undoes the \ooo escapes in a mountinfo path.
+func unescapeMountPath(p string) string {
+	if !strings.Contains(p, `\`) {
+		return p
+	}
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+4 <= len(p) {
+			if c, err := strconv.ParseUint(p[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestInodeFreeFrac(t *testing.T) {
+	defer func(f func(string, *syscall.Statfs_t) error) { statfs = f }(statfs)
+	for _, tc := range []struct {
+		name         string
+		files, ffree uint64
+		err          error
+		free         float64
+		ok           bool
+	}{
+		{name: "ext4", files: 1000, ffree: 250, free: 0.25, ok: true},
+		{name: "full", files: 1000, ffree: 0, free: 0, ok: true},
+		// btrfs allocates inodes dynamically and reports none.
+		{name: "btrfs", files: 0, ffree: 0},
+		{name: "unmounted", err: errors.New("no such file or directory")},
+	} {
+		statfs = func(path string, st *syscall.Statfs_t) error {
+			if path != "/mnt/data" {
+				t.Errorf("%s: statfs(%q)", tc.name, path)
+			}
+			st.Files, st.Ffree = tc.files, tc.ffree
+			return tc.err
+		}
+		free, ok := inodeFreeFrac("/mnt/data")
+		if free != tc.free || ok != tc.ok {
+			t.Errorf("%s: got %v, %v, want %v, %v", tc.name, free, ok, tc.free, tc.ok)
+		}
+	}
+}
+
+const testMountInfo = `22 1 259:2 / / rw,relatime shared:1 - ext4 /dev/nvme0n1p2 rw
+24 22 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw
+61 22 259:1 / /boot rw,relatime shared:29 - vfat /dev/nvme0n1p1 rw,fmask=0022
+88 22 8:17 / /mnt/backup\040disk rw,relatime shared:40 - ext4 /dev/sdb1 rw
+`
+
+func TestIsMountPoint(t *testing.T) {
+	dir := t.TempDir()
+	defer func(f string) { mountInfoFile = f }(mountInfoFile)
+	mounted := filepath.Join(dir, "backup disk")
+	empty := filepath.Join(dir, "data")
+	for _, d := range []string{mounted, empty} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(dir, "latest")
+	if err := os.Symlink(mounted, link); err != nil {
+		t.Fatal(err)
+	}
+	// dir may itself be behind a symlink, e.g. /tmp on macOS.
+	realMounted, _ := filepath.EvalSymlinks(mounted)
+	mountInfoFile = writeTemp(t, dir, "mountinfo",
+		testMountInfo+"90 22 8:18 / "+strings.ReplaceAll(realMounted, " ", `\040`)+" rw - ext4 /dev/sdc1 rw\n")
+
+	for path, want := range map[string]bool{
+		mounted:       true,
+		mounted + "/": true,
+		link:          true,
+		// The directory exists, but the disk isn't mounted on it.
+		empty: false,
+	} {
+		got, err := isMountPoint(path)
+		if err != nil || got != want {
+			t.Errorf("isMountPoint(%q) = %v, %v, want %v", path, got, err, want)
+		}
+	}
+	if _, err := isMountPoint(filepath.Join(dir, "missing")); err == nil {
+		t.Error("no error for a missing path")
+	}
+}
+
+func TestMountPoints(t *testing.T) {
+	got := mountPoints(strings.NewReader(testMountInfo))
+	for _, p := range []string{"/", "/proc", "/boot", "/mnt/backup disk"} {
+		if !got[p] {
+			t.Errorf("%q missing from %v", p, got)
+		}
+	}
+	if len(got) != 4 {
+		t.Errorf("got %d mount points, want 4: %v", len(got), got)
+	}
+}
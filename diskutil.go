@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskUtilization tracks the fraction of time a block device was busy, the
+// %util column of iostat.
+type diskUtilization struct {
+	statFile string
+	mu       sync.Mutex
+	lastBusy time.Duration
+	lastAt   time.Time
+}
+
+func newDiskUtilization(dev string) *diskUtilization {
+	return &diskUtilization{statFile: filepath.Join("/sys/class/block", dev, "stat")}
+}
+
+// ioTicks parses the time spent doing I/O from the contents of a block
+// device's stat file, which is the 10th field.
+func ioTicks(stat string) (time.Duration, bool) {
+	fields := strings.Fields(stat)
+	if len(fields) < 10 {
+		return 0, false
+	}
+	ms, err := strconv.ParseUint(fields[9], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// utilization returns the busy fraction over an interval, clamped to 1 to
+// smooth over rounding between the kernel's ticks and our clock.
+func utilization(busyDelta, elapsed time.Duration) float64 {
+	if elapsed <= 0 || busyDelta <= 0 {
+		return 0
+	}
+	u := float64(busyDelta) / float64(elapsed)
+	if u > 1 {
+		return 1
+	}
+	return u
+}
+
+// Update returns the utilization since the previous call. The first call
+// only records a sample, and returns false.
+func (d *diskUtilization) Update() (float64, bool) {
+	data, err := ioutil.ReadFile(d.statFile)
+	if err != nil {
+		return 0, false
+	}
+	busy, ok := ioTicks(string(data))
+	if !ok {
+		return 0, false
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lastBusy, lastAt := d.lastBusy, d.lastAt
+	d.lastBusy, d.lastAt = busy, now
+	if lastAt.IsZero() {
+		return 0, false
+	}
+	return utilization(busy-lastBusy, now.Sub(lastAt)), true
+}
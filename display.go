@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/modules/static"
+	"barista.run/outputs"
+	"barista.run/pango"
+)
+
+// displayStateFile remembers the display profile across restarts.
+var displayStateFile = home(".cache/barista/display")
+
+// compactDisplay is 1 when output functions should show only icons and
+// the bare minimum of text, e.g. on a small laptop screen.
+var compactDisplay int32
+
+func isCompact() bool {
+	return atomic.LoadInt32(&compactDisplay) == 1
+}
+
+// setCompact switches the display profile, and refreshes every module so
+// that none is left in the old layout until its next update.
+func setCompact(compact bool) {
+	var v int32
+	profile := "full"
+	if compact {
+		v, profile = 1, "compact"
+	}
+	if atomic.SwapInt32(&compactDisplay, v) != v {
+		refreshModules()
+	}
+	if os.MkdirAll(filepath.Dir(displayStateFile), 0755) == nil {
+		ioutil.WriteFile(displayStateFile, []byte(profile+"\n"), 0644)
+	}
+}
+
+// loadDisplayProfile restores the profile saved by setCompact.
+func loadDisplayProfile() {
+	data, err := ioutil.ReadFile(displayStateFile)
+	if err != nil {
+		return
+	}
+	if strings.TrimSpace(string(data)) == "compact" {
+		atomic.StoreInt32(&compactDisplay, 1)
+	}
+}
+
+// displayToggle switches between the compact and full profiles on click.
+type displayToggle struct {
+	out *static.Module
+}
+
+func newDisplayToggle() *displayToggle {
+	t := &displayToggle{out: static.New(nil)}
+	t.update()
+	return t
+}
+
+func (t *displayToggle) update() {
+	icon := "mdi-arrow-collapse-horizontal"
+	if isCompact() {
+		icon = "mdi-arrow-expand-horizontal"
+	}
+	t.out.Set(outputs.Pango(pango.Icon(icon).Alpha(0.6)).OnClick(click.Left(func() {
+		setCompact(!isCompact())
+		t.update()
+	})))
+}
+
+// Stream shows the toggle.
+func (t *displayToggle) Stream(s bar.Sink) {
+	t.out.Stream(s)
+}
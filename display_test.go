@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetCompactRefreshes(t *testing.T) {
+	defer func(f string) { displayStateFile = f }(displayStateFile)
+	displayStateFile = filepath.Join(t.TempDir(), "barista", "display")
+	defer setCompact(false)
+
+	restoreRefreshers(t)
+	var refreshes int32
+	onRefresh(func() { atomic.AddInt32(&refreshes, 1) })
+	for _, tc := range []struct {
+		compact   bool
+		refreshes int32
+		saved     string
+	}{
+		{true, 1, "compact\n"},
+		{true, 1, "compact\n"},
+		{false, 2, "full\n"},
+	} {
+		setCompact(tc.compact)
+		if isCompact() != tc.compact {
+			t.Errorf("isCompact() = %v after setCompact(%v)", isCompact(), tc.compact)
+		}
+		if got := atomic.LoadInt32(&refreshes); got != tc.refreshes {
+			t.Errorf("setCompact(%v): %d refreshes, want %d", tc.compact, got, tc.refreshes)
+		}
+		if data, err := ioutil.ReadFile(displayStateFile); err != nil || string(data) != tc.saved {
+			t.Errorf("setCompact(%v): saved %q, %v", tc.compact, data, err)
+		}
+	}
+}
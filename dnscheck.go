@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// dnsCheckHost is resolved periodically to check that DNS is working,
+// separately from whether the internet is reachable at all.
+var dnsCheckHost = "example.com"
+
+// dnsCheckInterval is how often dnsCheckHost is resolved, and
+// dnsCheckTimeout how long a lookup may take before DNS counts as broken.
+var dnsCheckInterval = 30 * time.Second
+var dnsCheckTimeout = 3 * time.Second
+
+type dnsInfo struct {
+	Host    string
+	OK      bool
+	Latency time.Duration
+}
+
+// checkDNS resolves dnsCheckHost, timing the lookup.
+func checkDNS() dnsInfo {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	_, err := net.DefaultResolver.LookupHost(ctx, dnsCheckHost)
+	info := dnsInfo{Host: dnsCheckHost, OK: err == nil, Latency: time.Since(start)}
+	if err != nil {
+		logDebugf("DNS lookup of %s failed: %v", dnsCheckHost, err)
+	}
+	return info
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/funcs"
+	"github.com/godbus/dbus/v5"
+)
+
+// equalizerInterval is how often the active preset is read.
+const equalizerInterval = 5 * time.Second
+
+const gtkActions = "org.gtk.Actions"
+
+// equalizerProvider describes how to talk to an audio effects application
+// through the GApplication actions it exports on D-Bus.
+type equalizerProvider struct {
+	Service string
+	Path    string
+	// PresetDir holds the output presets, one JSON file each.
+	PresetDir string
+	// LoadAction loads the preset named by its string parameter.
+	LoadAction string
+	// BypassAction is a boolean stateful action, true when effects are off.
+	BypassAction string
+}
+
+var easyEffectsProvider = equalizerProvider{
+	Service:      "com.github.wwmm.easyeffects",
+	Path:         "/com/github/wwmm/easyeffects",
+	PresetDir:    home(".config/easyeffects/output"),
+	LoadAction:   "load-preset",
+	BypassAction: "global-bypass",
+}
+
+// pulseEffectsProvider is for PulseEffects, the predecessor of EasyEffects
+// that is still packaged for PulseAudio systems.
+var pulseEffectsProvider = equalizerProvider{
+	Service:      "com.github.wwmm.pulseeffects",
+	Path:         "/com/github/wwmm/pulseeffects",
+	PresetDir:    home(".config/PulseEffects/output"),
+	LoadAction:   "load-preset",
+	BypassAction: "bypass",
+}
+
+type equalizerInfo struct {
+	Preset  string
+	Enabled bool
+}
+
+// gtkActionDesc is an action as returned by org.gtk.Actions.DescribeAll.
+type gtkActionDesc struct {
+	Enabled bool
+	Param   dbus.Signature
+	State   []dbus.Variant
+}
+
+// equalizer shows the active preset of EasyEffects or PulseEffects, and
+// cycles through the presets on click.
+type equalizer struct {
+	provider equalizerProvider
+	module   *funcs.RepeatingModule
+	mu       sync.Mutex
+	// loaded is the preset last loaded from the bar, used when the
+	// application doesn't expose the active preset as action state.
+	loaded string
+}
+
+func newEqualizer(provider equalizerProvider) *equalizer {
+	e := &equalizer{provider: provider}
+	e.module = pollEvery(equalizerInterval, e.update)
+	return e
+}
+
+// Stream shows the preset.
+func (e *equalizer) Stream(s bar.Sink) {
+	e.module.Stream(s)
+}
+
+// presets lists the preset names in the provider's preset directory.
+func (e *equalizer) presets() []string {
+	files, _ := filepath.Glob(filepath.Join(e.provider.PresetDir, "*.json"))
+	var names []string
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(f), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// info reads the state of the effects application. ok is false if it
+// isn't running.
+func (e *equalizer) info(presets []string) (info equalizerInfo, ok bool) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return info, false
+	}
+	var actions []string
+	obj := conn.Object(e.provider.Service, dbus.ObjectPath(e.provider.Path))
+	if err := obj.Call(gtkActions+".List", 0).Store(&actions); err != nil {
+		return info, false
+	}
+	var descs map[string]gtkActionDesc
+	if err := obj.Call(gtkActions+".DescribeAll", 0).Store(&descs); err != nil {
+		return info, false
+	}
+	info.Enabled = true
+	if d, ok := descs[e.provider.BypassAction]; ok && len(d.State) > 0 {
+		bypass, _ := d.State[0].Value().(bool)
+		info.Enabled = !bypass
+	}
+	// Any action whose state names a preset file is taken as the one
+	// tracking the active preset.
+	known := map[string]bool{}
+	for _, p := range presets {
+		known[p] = true
+	}
+	for _, name := range actions {
+		d := descs[name]
+		if len(d.State) == 0 {
+			continue
+		}
+		if s, _ := d.State[0].Value().(string); known[s] {
+			info.Preset = s
+			return info, true
+		}
+	}
+	e.mu.Lock()
+	info.Preset = e.loaded
+	e.mu.Unlock()
+	return info, true
+}
+
+func (e *equalizer) update(s bar.Sink) {
+	presets := e.presets()
+	info, ok := e.info(presets)
+	if !ok {
+		s.Output(nil)
+		return
+	}
+	s.Output(equalizerOutput(info, func() { e.next(info.Preset, presets) }))
+}
+
+// next loads the preset after current.
+func (e *equalizer) next(current string, presets []string) {
+	if len(presets) == 0 {
+		return
+	}
+	next := presets[0]
+	for i, p := range presets {
+		if p == current {
+			next = presets[(i+1)%len(presets)]
+		}
+	}
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return
+	}
+	err = conn.Object(e.provider.Service, dbus.ObjectPath(e.provider.Path)).
+		Call(gtkActions+".Activate", 0, e.provider.LoadAction,
+			[]dbus.Variant{dbus.MakeVariant(next)}, map[string]dbus.Variant{}).Err
+	if err != nil {
+		logWarnf("Could not load preset %s: %v", next, err)
+		return
+	}
+	e.mu.Lock()
+	e.loaded = next
+	e.mu.Unlock()
+	e.module.Refresh()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// execTimeout bounds commands the bar expects to finish quickly, so that
+// e.g. df on a stale NFS mount or kubectl against an unreachable cluster
+// can't block a module forever.
+var execTimeout = 3 * time.Second
+
+// errTimedOut is returned by the done function of a command that was
+// killed for running too long.
+var errTimedOut = errors.New("timed out")
+
+// quickCommand is exec.Command for a command that is killed if it runs
+// longer than execTimeout. Call done once it has finished, which logs a
+// timeout, and returns err unchanged.
+func quickCommand(name string, args ...string) (cmd *timedCmd, done func(err error) error) {
+	cmd = timeoutCommand(execTimeout, name, args...)
+	return cmd, func(err error) error {
+		if err == errTimedOut {
+			logWarnf("%s timed out after %v", name, execTimeout)
+		}
+		return err
+	}
+}
+
+// timedCmd is an exec.Cmd that is killed with SIGKILL, along with anything
+// it started, if it runs longer than its timeout. It runs in its own
+// process group so that e.g. both sides of a pipeline in `sh -c` are
+// killed, rather than only the shell, leaving the others holding its
+// output open.
+type timedCmd struct {
+	*exec.Cmd
+	timeout time.Duration
+}
+
+// timeoutCommand is exec.Command for a command that is killed if it runs
+// longer than timeout, in which case Run and Output return errTimedOut.
+func timeoutCommand(timeout time.Duration, name string, args ...string) *timedCmd {
+	cmd := exec.Command(name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return &timedCmd{Cmd: cmd, timeout: timeout}
+}
+
+// Run starts the command and waits for it to finish or be killed.
+func (c *timedCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	finished, killed := false, false
+	timer := time.AfterFunc(c.timeout, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !finished {
+			killed = true
+			// The group has the command's pid, and outlives it if
+			// anything it started is still running.
+			syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+		}
+	})
+	err := c.Wait()
+	timer.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	finished = true
+	if killed {
+		return errTimedOut
+	}
+	return err
+}
+
+// Output runs the command and returns its stdout. Like exec.Cmd.Output,
+// stderr is kept in the *exec.ExitError if it fails and stderr isn't
+// otherwise redirected.
+func (c *timedCmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	captureErr := c.Stderr == nil
+	if captureErr {
+		c.Stderr = &stderr
+	}
+	err := c.Run()
+	if ee, ok := err.(*exec.ExitError); ok && captureErr {
+		ee.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// quickOutput runs a quick command and returns its stdout.
+func quickOutput(name string, args ...string) ([]byte, error) {
+	cmd, done := quickCommand(name, args...)
+	out, err := cmd.Output()
+	return out, done(err)
+}
+
+// quickRun runs a quick command.
+func quickRun(name string, args ...string) error {
+	cmd, done := quickCommand(name, args...)
+	return done(cmd.Run())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+// groupAlive reports whether any process in group pgid is still running,
+// ignoring zombies that are only waiting for their parent to reap them.
+func groupAlive(pgid int) bool {
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, path := range stats {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// The command name is in parentheses and may contain spaces.
+		fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+		if len(fields) < 3 || fields[0] == "Z" {
+			continue
+		}
+		if pgrp, _ := strconv.Atoi(fields[2]); pgrp == pgid {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTimeoutCommandKillsPipeline(t *testing.T) {
+	const d = 200 * time.Millisecond
+	cmd := timeoutCommand(d, "sh", "-c", "sleep 10 | cat")
+	start := time.Now()
+	out, err := cmd.Output()
+	elapsed := time.Since(start)
+	if err != errTimedOut {
+		t.Fatalf("got %v (output %q), want errTimedOut", err, out)
+	}
+	// Wait has returned, so the shell has been reaped.
+	if elapsed > d+100*time.Millisecond {
+		t.Errorf("returned after %v, want within %v", elapsed, d+100*time.Millisecond)
+	}
+	if elapsed < d {
+		t.Errorf("returned after %v, before the %v timeout", elapsed, d)
+	}
+	if !cmd.ProcessState.Exited() {
+		if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); !ok || ws.Signal() != syscall.SIGKILL {
+			t.Errorf("shell ended with %v, want SIGKILL", cmd.ProcessState)
+		}
+	}
+	// sleep and cat were killed with the shell, not left running.
+	if groupAlive(cmd.Process.Pid) {
+		t.Errorf("processes in group %d still running after the timeout", cmd.Process.Pid)
+	}
+}
+
+func TestTimeoutCommandCompletes(t *testing.T) {
+	out, err := timeoutCommand(time.Second, "sh", "-c", "echo out; echo err >&2").Output()
+	if err != nil || string(out) != "out\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+
+	_, err = timeoutCommand(time.Second, "sh", "-c", "echo failed >&2; exit 3").Output()
+	ee, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want an exit error", err)
+	}
+	if ee.ExitCode() != 3 || string(ee.Stderr) != "failed\n" {
+		t.Errorf("got exit %d with stderr %q", ee.ExitCode(), ee.Stderr)
+	}
+
+	if err := timeoutCommand(time.Second, "/nonexistent/command").Run(); err == nil || err == errTimedOut {
+		t.Errorf("missing command: got %v", err)
+	}
+}
+
+func TestShellStderrTimeout(t *testing.T) {
+	stdout, stderr, err := runWithStderr(100*time.Millisecond, "sh", "-c", "echo partial; sleep 5")
+	if err != errTimedOut {
+		t.Fatalf("got %v, want errTimedOut", err)
+	}
+	if stdout != "partial" || stderr != "" {
+		t.Errorf("got stdout %q, stderr %q", stdout, stderr)
+	}
+	stdout, stderr, err = runWithStderr(time.Second, "sh", "-c", "echo ok; echo warn >&2")
+	if err != nil || stdout != "ok" || stderr != "warn" {
+		t.Errorf("got %q, %q, %v", stdout, stderr, err)
+	}
+}
+
+func TestShellStderrTimeoutOutput(t *testing.T) {
+	var elapsed time.Duration
+	var got []bar.Output
+	newShellWithStderr("sleep", "5").
+		WithTimeout(100 * time.Millisecond).
+		WithTimeoutOutput(func(d time.Duration) bar.Output {
+			elapsed = d
+			return outputs.Text("slow")
+		}).
+		Stream(func(o bar.Output) { got = append(got, o) })
+	if len(got) != 1 || baristatest.Text(got[0].Segments()[0]) != "slow" {
+		t.Fatalf("got %v, want the timeout output", got)
+	}
+	if elapsed < 100*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("timeout output given %v", elapsed)
+	}
+
+	got = nil
+	newShellWithStderr("sh", "-c", "echo fine").
+		WithTimeout(time.Second).
+		Stream(func(o bar.Output) { got = append(got, o) })
+	if len(got) != 1 {
+		t.Fatalf("got %d outputs", len(got))
+	}
+	baristatest.AssertOutput(t, func(o bar.Output) bar.Output { return o }, got[0],
+		baristatest.SegmentText(0, "fine"))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"barista.run/bar"
+	"barista.run/modules/static"
+	"github.com/chris-vest/crystal_barista/i3ipc"
+)
+
+// windowTitleLength is the number of characters of the focused window's
+// title shown.
+var windowTitleLength = 60
+
+type i3Node struct {
+	Name          string
+	Type          string
+	Focused       bool
+	Nodes         []i3Node
+	FloatingNodes []i3Node `json:"floating_nodes"`
+}
+
+// focusedTitle returns the title of the focused window in the tree, or ""
+// if the focus is on an empty workspace.
+func (n i3Node) focusedTitle() (string, bool) {
+	if n.Focused {
+		if n.Type == "con" || n.Type == "floating_con" {
+			return n.Name, true
+		}
+		return "", true
+	}
+	for _, children := range [][]i3Node{n.Nodes, n.FloatingNodes} {
+		for _, c := range children {
+			if title, ok := c.focusedTitle(); ok {
+				return title, true
+			}
+		}
+	}
+	return "", false
+}
+
+// focusedWindow shows the title of the focused window, updated on focus
+// and title changes: through i3/sway IPC if available, otherwise by
+// watching _NET_ACTIVE_WINDOW on X11.
+type focusedWindow struct {
+	out *static.Module
+}
+
+func newFocusedWindow() *focusedWindow {
+	return &focusedWindow{out: static.New(nil)}
+}
+
+// Stream shows the title.
+func (f *focusedWindow) Stream(s bar.Sink) {
+	go f.watch()
+	f.out.Stream(s)
+}
+
+func (f *focusedWindow) watch() {
+	// Switching to an empty workspace changes the focus without a window
+	// event.
+	windows, err := i3ipc.Subscribe("window")
+	var wsEvents <-chan json.RawMessage
+	if err == nil {
+		wsEvents, err = i3ipc.Subscribe("workspace")
+		if err != nil {
+			i3ipc.Unsubscribe(windows)
+		}
+	}
+	if err != nil {
+		logDebugf("No i3 IPC for the window title, trying X11: %v", err)
+		f.watchX11()
+		return
+	}
+	f.showI3()
+	for windows != nil && wsEvents != nil {
+		select {
+		case _, ok := <-windows:
+			if !ok {
+				windows = nil
+			}
+		case _, ok := <-wsEvents:
+			if !ok {
+				wsEvents = nil
+			}
+		}
+		f.showI3()
+	}
+	logWarnf("Lost the i3 IPC connection, no longer following the focused window")
+	f.out.Set(nil)
+}
+
+func (f *focusedWindow) showI3() {
+	data, err := i3ipc.Send(i3ipc.GetTreeMsg, "")
+	if err != nil {
+		return
+	}
+	var tree i3Node
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return
+	}
+	title, _ := tree.focusedTitle()
+	f.show(title)
+}
+
+var (
+	xpropWindowID = regexp.MustCompile(`window id # (0x[0-9a-f]+)`)
+	xpropName     = regexp.MustCompile(`= "(.*)"$`)
+)
+
+// watchX11 follows _NET_ACTIVE_WINDOW using `xprop -spy`, which prints a
+// line each time it changes.
+func (f *focusedWindow) watchX11() {
+	cmd := exec.Command("xprop", "-spy", "-root", "_NET_ACTIVE_WINDOW")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil || cmd.Start() != nil {
+		logDebugf("No xprop either, not showing the focused window")
+		return
+	}
+	s := bufio.NewScanner(stdout)
+	for s.Scan() {
+		m := xpropWindowID.FindStringSubmatch(s.Text())
+		if m == nil || m[1] == "0x0" {
+			f.show("")
+			continue
+		}
+		out, err := quickOutput("xprop", "-id", m[1], "_NET_WM_NAME")
+		if err != nil {
+			f.show("")
+			continue
+		}
+		name := xpropName.FindStringSubmatch(strings.TrimSpace(string(out)))
+		if name == nil {
+			f.show("")
+			continue
+		}
+		f.show(name[1])
+	}
+	cmd.Wait()
+}
+
+func (f *focusedWindow) show(title string) {
+	if title == "" {
+		f.out.Set(nil)
+		return
+	}
+	f.out.Set(focusedWindowOutput(truncate(title, windowTitleLength)))
+}
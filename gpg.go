@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/funcs"
+)
+
+// gpgExpiryWarning is how far ahead expiring subkeys are flagged.
+var gpgExpiryWarning = 30 * 24 * time.Hour
+
+// terminalCmd runs a command in a new terminal window.
+var terminalCmd = "alacritty -e"
+
+type gpgInfo struct {
+	ExpiringWithin30Days int
+	AlreadyExpired       int
+	// Fingerprint is of the first key needing attention, to edit on click.
+	Fingerprint string
+}
+
+// gpgKeyState is how urgently a subkey needs renewing, worst last.
+type gpgKeyState int
+
+const (
+	gpgKeyValid gpgKeyState = iota
+	gpgKeyExpiring
+	gpgKeyExpired
+)
+
+// gpgSubkey is a subkey's state and capabilities, e.g. "e" or "sa".
+type gpgSubkey struct {
+	state gpgKeyState
+	caps  string
+}
+
+// gpgKeyStatus returns the state of a key from its subkeys. A subkey that
+// has expired or is expiring doesn't count if another subkey with the same
+// capability is in a better state, since that's its replacement.
+func gpgKeyStatus(subkeys []gpgSubkey) gpgKeyState {
+	best := map[rune]gpgKeyState{}
+	for _, sk := range subkeys {
+		for _, c := range sk.caps {
+			if cur, ok := best[c]; !ok || sk.state < cur {
+				best[c] = sk.state
+			}
+		}
+	}
+	worst := gpgKeyValid
+	for _, state := range best {
+		if state > worst {
+			worst = state
+		}
+	}
+	return worst
+}
+
+// parseGPGKeys counts the secret keys with expired or soon expiring
+// subkeys in `gpg --list-secret-keys --with-colons` output. Revoked
+// subkeys are ignored, since they've been replaced on purpose, and so are
+// subkeys that have already been replaced by a newer one.
+func parseGPGKeys(out string, now time.Time) gpgInfo {
+	var info gpgInfo
+	var fpr string
+	var subkeys []gpgSubkey
+	var wantFpr bool
+	flush := func() {
+		state := gpgKeyStatus(subkeys)
+		switch state {
+		case gpgKeyExpired:
+			info.AlreadyExpired++
+		case gpgKeyExpiring:
+			info.ExpiringWithin30Days++
+		}
+		if state != gpgKeyValid && info.Fingerprint == "" {
+			info.Fingerprint = fpr
+		}
+		fpr, subkeys = "", nil
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, ":")
+		switch fields[0] {
+		case "sec":
+			flush()
+			wantFpr = true
+		case "fpr":
+			// The first fingerprint after sec is the primary key's.
+			if wantFpr && len(fields) > 9 {
+				fpr, wantFpr = fields[9], false
+			}
+		case "ssb":
+			if len(fields) < 7 || fields[1] == "r" {
+				continue
+			}
+			sk := gpgSubkey{}
+			if len(fields) > 11 {
+				sk.caps = strings.ToLower(fields[11])
+			}
+			if sk.caps == "" {
+				// Only replaced by a subkey that can do the same.
+				sk.caps = "?"
+			}
+			if fields[1] == "e" {
+				sk.state = gpgKeyExpired
+			} else if secs, err := strconv.ParseInt(fields[6], 10, 64); err == nil {
+				// An empty expiry never expires.
+				expiry := time.Unix(secs, 0)
+				switch {
+				case !expiry.After(now):
+					sk.state = gpgKeyExpired
+				case expiry.Sub(now) < gpgExpiryWarning:
+					sk.state = gpgKeyExpiring
+				}
+			}
+			subkeys = append(subkeys, sk)
+		}
+	}
+	flush()
+	return info
+}
+
+// editGPGKey opens the key in gpg's editor in a terminal.
+func editGPGKey(fingerprint string) {
+	launch(terminalCmd + " gpg --edit-key " + fingerprint)
+}
+
+// newGPGModule checks the secret keys for expiring subkeys at startup and
+// daily after that. gpg uses $GNUPGHOME if it's set.
+func newGPGModule() *funcs.RepeatingModule {
+	return pollEvery(24*time.Hour, func(s bar.Sink) {
+		out, err := quickOutput("gpg", "--list-secret-keys", "--with-colons")
+		if err != nil {
+			s.Output(nil)
+			return
+		}
+		s.Output(gpgOutput(parseGPGKeys(string(out), time.Now())))
+	})
+}
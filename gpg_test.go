@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGPGKeys(t *testing.T) {
+	out, err := ioutil.ReadFile("testdata/gpg-keys.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	got := parseGPGKeys(string(out), now)
+	// Only B has an expired subkey that nothing replaces; C's subkey and
+	// D's replacement both expire in 10 days.
+	want := gpgInfo{
+		AlreadyExpired:       1,
+		ExpiringWithin30Days: 2,
+		Fingerprint:          strings.Repeat("B", 40),
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// A month later the replacements for C and D have lapsed too.
+	got = parseGPGKeys(string(out), now.Add(31*24*time.Hour))
+	if got.AlreadyExpired != 3 || got.ExpiringWithin30Days != 0 {
+		t.Errorf("a month later: got %+v", got)
+	}
+
+	if got := parseGPGKeys("", now); got != (gpgInfo{}) {
+		t.Errorf("no keys: got %+v", got)
+	}
+}
+
+func TestGPGKeyStatus(t *testing.T) {
+	for _, tc := range []struct {
+		subkeys []gpgSubkey
+		want    gpgKeyState
+	}{
+		{nil, gpgKeyValid},
+		{[]gpgSubkey{{gpgKeyExpired, "e"}, {gpgKeyValid, "e"}}, gpgKeyValid},
+		{[]gpgSubkey{{gpgKeyExpired, "se"}, {gpgKeyValid, "e"}}, gpgKeyExpired},
+		{[]gpgSubkey{{gpgKeyExpired, "se"}, {gpgKeyValid, "s"}, {gpgKeyExpiring, "e"}}, gpgKeyExpiring},
+		{[]gpgSubkey{{gpgKeyExpiring, "a"}, {gpgKeyValid, "sa"}}, gpgKeyValid},
+		{[]gpgSubkey{{gpgKeyExpired, "?"}, {gpgKeyValid, "s"}}, gpgKeyExpired},
+	} {
+		if got := gpgKeyStatus(tc.subkeys); got != tc.want {
+			t.Errorf("gpgKeyStatus(%v) = %v, want %v", tc.subkeys, got, tc.want)
+		}
+	}
+}
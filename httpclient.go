@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpTimeout bounds every HTTP request the bar makes, including reading
+// the response, so that a hung server can't stall a module indefinitely.
+var httpTimeout = 5 * time.Second
+
+func httpClient() *http.Client {
+	return &http.Client{Timeout: httpTimeout}
+}
+
+// httpGet fetches url, giving up when ctx is done or after httpTimeout.
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httpClient().Do(req)
+}
+
+// httpStatusError is a response from service with a status other than 200.
+type httpStatusError struct {
+	service string
+	code    int
+	status  string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.service, e.status)
+}
+
+// checkStatus returns an httpStatusError unless resp is a 200.
+func checkStatus(service string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	return &httpStatusError{service, resp.StatusCode, resp.Status}
+}
+
+// apiKeySet returns whether key was filled in at build time, rather than
+// left as its %%PLACEHOLDER%%.
+func apiKeySet(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "%%")
+}
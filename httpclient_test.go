@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// slowServer answers after headerDelay, and writes the body after a
+// further bodyDelay. It returns once the test's requests have given up.
+func slowServer(t *testing.T, headerDelay, bodyDelay time.Duration) *httptest.Server {
+	t.Helper()
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(headerDelay):
+		case <-done:
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(bodyDelay):
+		case <-done:
+			return
+		}
+		fmt.Fprint(w, `{"latitude": 1, "longitude": 2}`)
+	}))
+	t.Cleanup(func() {
+		close(done)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestHTTPGetTimeout(t *testing.T) {
+	defer func(d time.Duration) { httpTimeout = d }(httpTimeout)
+	httpTimeout = 100 * time.Millisecond
+
+	for _, tc := range []struct {
+		name                   string
+		headerDelay, bodyDelay time.Duration
+	}{
+		{"slow to answer", 10 * time.Second, 0},
+		{"slow to send the body", 0, 10 * time.Second},
+	} {
+		srv := slowServer(t, tc.headerDelay, tc.bodyDelay)
+		start := time.Now()
+		resp, err := httpGet(context.Background(), srv.URL)
+		if err == nil {
+			_, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		if took := time.Since(start); err == nil || took > time.Second {
+			t.Errorf("%s: got %v after %v, want a timeout after %v", tc.name, err, took, httpTimeout)
+		}
+	}
+
+	// A quick server is unaffected.
+	srv := slowServer(t, 0, 0)
+	resp, err := httpGet(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus("test", resp); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHTTPGetCancel(t *testing.T) {
+	srv := slowServer(t, 10*time.Second, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := httpGet(ctx, srv.URL); err == nil || time.Since(start) > time.Second {
+		t.Errorf("got %v after %v, want it cancelled", err, time.Since(start))
+	}
+}
+
+func TestWhereamiSlowServer(t *testing.T) {
+	defer func(d time.Duration) { httpTimeout = d }(httpTimeout)
+	httpTimeout = 50 * time.Millisecond
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+	defer func(u string) { geoipURL = u }(geoipURL)
+	os.Unsetenv("BARISTA_CITY")
+
+	lastLocation.Lock()
+	lat, lng, ok := lastLocation.lat, lastLocation.lng, lastLocation.ok
+	lastLocation.ok = false
+	lastLocation.Unlock()
+	defer func() {
+		lastLocation.Lock()
+		lastLocation.lat, lastLocation.lng, lastLocation.ok = lat, lng, ok
+		lastLocation.Unlock()
+	}()
+
+	geoipURL = slowServer(t, 10*time.Second, 0).URL
+	start := time.Now()
+	if _, _, err := whereami(); err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("got %v after %v, want the geolocation to time out", err, time.Since(start))
+	}
+
+	// Once a location is known, a hung server falls back to it.
+	geoipURL = slowServer(t, 0, 0).URL
+	if lat, lng, err := whereami(); err != nil || lat != 1 || lng != 2 {
+		t.Fatalf("got %v, %v, %v", lat, lng, err)
+	}
+	geoipURL = slowServer(t, 10*time.Second, 0).URL
+	if lat, lng, err := whereami(); err != nil || lat != 1 || lng != 2 {
+		t.Errorf("got %v, %v, %v, want the last known location", lat, lng, err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"barista.run/modules/meminfo"
+	"github.com/martinlindhe/unit"
+)
+
+type hugePagesInfo struct {
+	Total, Free, Rsvd int
+	PageSize          unit.Datasize
+}
+
+// Used returns the number of huge pages in use.
+func (h hugePagesInfo) Used() int {
+	return h.Total - h.Free
+}
+
+// FreeFrac returns the fraction of huge pages still free, or 1 if none are
+// configured.
+func (h hugePagesInfo) FreeFrac() float64 {
+	if h.Total <= 0 {
+		return 1
+	}
+	return float64(h.Free) / float64(h.Total)
+}
+
+// hugePages returns the huge page counts from /proc/meminfo, e.g.
+//
+//	HugePages_Total:       8
+//	HugePages_Free:        4
+//	HugePages_Rsvd:        0
+//	Hugepagesize:       2048 kB
+//
+// meminfo.Info stores the counts, which have no unit, as a number of bytes.
+func hugePages(m meminfo.Info) hugePagesInfo {
+	return hugePagesInfo{
+		Total:    int(m["HugePages_Total"].Bytes()),
+		Free:     int(m["HugePages_Free"].Bytes()),
+		Rsvd:     int(m["HugePages_Rsvd"].Bytes()),
+		PageSize: m["Hugepagesize"],
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"barista.run/modules/meminfo"
+	"github.com/martinlindhe/unit"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+// withHugePages returns meminfo with the given huge page counts, stored the
+// way the meminfo module stores unitless values.
+func withHugePages(total, free int) meminfo.Info {
+	return meminfo.Info{
+		"MemTotal":        16 * unit.Gibibyte,
+		"MemAvailable":    8 * unit.Gibibyte,
+		"HugePages_Total": unit.Datasize(total) * unit.Byte,
+		"HugePages_Free":  unit.Datasize(free) * unit.Byte,
+		"HugePages_Rsvd":  0,
+		"Hugepagesize":    2048 * unit.Kibibyte,
+	}
+}
+
+func TestHugePages(t *testing.T) {
+	hp := hugePages(withHugePages(8, 2))
+	if hp.Total != 8 || hp.Free != 2 || hp.Used() != 6 || hp.PageSize != 2*unit.Mebibyte {
+		t.Errorf("got %+v", hp)
+	}
+	if got := hp.FreeFrac(); got != 0.25 {
+		t.Errorf("FreeFrac() = %v, want 0.25", got)
+	}
+	if got := hugePages(meminfo.Info{}).FreeFrac(); got != 1 {
+		t.Errorf("FreeFrac() with no huge pages = %v, want 1", got)
+	}
+}
+
+func TestFreeMemHugePages(t *testing.T) {
+	baristatest.AssertOutput(t, freeMemOutput, withHugePages(0, 0),
+		baristatest.SegmentCount(1))
+	baristatest.AssertOutput(t, freeMemOutput, withHugePages(8, 4),
+		baristatest.SegmentCount(2),
+		baristatest.SegmentContains(1, "HP: 4/8"),
+		baristatest.Color(1, nil))
+	baristatest.AssertOutput(t, freeMemOutput, withHugePages(20, 1),
+		baristatest.SegmentContains(1, "HP: 19/20"),
+		baristatest.Color(1, schemeColor("degraded")))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/martinlindhe/unit"
+)
+
+// hwmonChips lists the hwmon chip names (the contents of
+// /sys/class/hwmon/*/name) to read temperatures from, e.g. "coretemp",
+// "k10temp" or "pch_cannonlake". When empty, the single-sensor cputemp
+// module is used instead.
+var hwmonChips = []string{}
+
+type hwmonReading struct {
+	Label string
+	Temp  unit.Temperature
+}
+
+// hwmonTemps returns a reading for each temp*_input of the given chips,
+// labelled with the chip name and the sensor's own label if it has one.
+func hwmonTemps(chips []string) []hwmonReading {
+	wanted := map[string]bool{}
+	for _, c := range chips {
+		wanted[c] = true
+	}
+	var readings []hwmonReading
+	dirs, _ := filepath.Glob("/sys/class/hwmon/hwmon*")
+	for _, dir := range dirs {
+		name := readSysfsString(filepath.Join(dir, "name"))
+		if !wanted[name] {
+			continue
+		}
+		inputs, _ := filepath.Glob(filepath.Join(dir, "temp*_input"))
+		for _, input := range inputs {
+			milliC, ok := readSysfsInt(input)
+			if !ok {
+				continue
+			}
+			label := name
+			labelFile := strings.TrimSuffix(input, "_input") + "_label"
+			if l, err := ioutil.ReadFile(labelFile); err == nil {
+				label += " " + strings.TrimSpace(string(l))
+			}
+			readings = append(readings, hwmonReading{
+				Label: label,
+				Temp:  unit.FromCelsius(float64(milliC) / 1000.0),
+			})
+		}
+	}
+	sort.Slice(readings, func(i, j int) bool {
+		return readings[i].Label < readings[j].Label
+	})
+	return readings
+}
+
+func hottest(readings []hwmonReading) hwmonReading {
+	var max hwmonReading
+	for i, r := range readings {
+		if i == 0 || r.Temp > max.Temp {
+			max = r
+		}
+	}
+	return max
+}
@@ -0,0 +1,213 @@
+// Package i3ipc talks to i3 or sway over their IPC socket, to run commands
+// from click handlers and to follow events without polling. See
+// https://i3wm.org/docs/ipc.html for the protocol, which sway also speaks.
+package i3ipc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message types.
+const (
+	RunCommandMsg    = 0
+	GetWorkspacesMsg = 1
+	SubscribeMsg     = 2
+	GetTreeMsg       = 4
+)
+
+// eventBit is set in the type of event messages.
+const eventBit = 1 << 31
+
+var magic = []byte("i3-ipc")
+
+// ErrNotRunning is returned when there's no i3 or sway to talk to.
+var ErrNotRunning = errors.New("i3ipc: not running under i3 or sway")
+
+// SocketPath finds the IPC socket of the running i3 or sway, from
+// $I3SOCK, $SWAYSOCK or `i3 --get-socketpath`.
+func SocketPath() (string, error) {
+	for _, env := range []string{"I3SOCK", "SWAYSOCK"} {
+		if path := os.Getenv(env); path != "" {
+			return path, nil
+		}
+	}
+	out, err := exec.Command("i3", "--get-socketpath").Output()
+	if err != nil || len(strings.TrimSpace(string(out))) == 0 {
+		return "", ErrNotRunning
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+type conn struct {
+	net.Conn
+}
+
+func dial() (*conn, error) {
+	path, err := SocketPath()
+	if err != nil {
+		return nil, err
+	}
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{c}, nil
+}
+
+func (c *conn) send(msgType uint32, payload string) error {
+	msg := make([]byte, len(magic)+8, len(magic)+8+len(payload))
+	copy(msg, magic)
+	binary.LittleEndian.PutUint32(msg[len(magic):], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(msg[len(magic)+4:], msgType)
+	_, err := c.Write(append(msg, payload...))
+	return err
+}
+
+func (c *conn) recv() (msgType uint32, payload []byte, err error) {
+	header := make([]byte, len(magic)+8)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return 0, nil, err
+	}
+	if string(header[:len(magic)]) != string(magic) {
+		return 0, nil, errors.New("i3ipc: bad reply")
+	}
+	size := binary.LittleEndian.Uint32(header[len(magic):])
+	msgType = binary.LittleEndian.Uint32(header[len(magic)+4:])
+	payload = make([]byte, size)
+	_, err = io.ReadFull(c, payload)
+	return msgType, payload, err
+}
+
+// Send sends a single message and returns the reply.
+func Send(msgType uint32, payload string) ([]byte, error) {
+	c, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	if err := c.send(msgType, payload); err != nil {
+		return nil, err
+	}
+	_, reply, err := c.recv()
+	return reply, err
+}
+
+// RunCommand runs an i3 command, e.g. "exec alacritty", which unlike
+// starting the process directly lets i3 place the new window where it was
+// launched from.
+func RunCommand(cmd string) error {
+	reply, err := Send(RunCommandMsg, cmd)
+	if err != nil {
+		return err
+	}
+	var results []struct {
+		Success bool
+		Error   string
+	}
+	if err := json.Unmarshal(reply, &results); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if !r.Success {
+			return fmt.Errorf("i3ipc: %s", r.Error)
+		}
+	}
+	return nil
+}
+
+// FocusWorkspace switches to the named workspace.
+func FocusWorkspace(name string) error {
+	// A quoted Go string is also valid i3 syntax for names with spaces or
+	// quotes.
+	return RunCommand("workspace " + strconv.Quote(name))
+}
+
+// subscription is the connection behind a channel from Subscribe.
+type subscription struct {
+	c    *conn
+	done chan struct{}
+}
+
+var (
+	subsMu sync.Mutex
+	subs   = map[<-chan json.RawMessage]*subscription{}
+)
+
+// Subscribe delivers the payloads of eventType events (e.g. "window" or
+// "workspace") until the connection is lost or Unsubscribe is called,
+// when the channel is closed.
+func Subscribe(eventType string) (<-chan json.RawMessage, error) {
+	c, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	payload, _ := json.Marshal([]string{eventType})
+	if err := c.send(SubscribeMsg, string(payload)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	var reply struct{ Success bool }
+	_, data, err := c.recv()
+	if err == nil {
+		err = json.Unmarshal(data, &reply)
+	}
+	if err == nil && !reply.Success {
+		err = fmt.Errorf("i3ipc: subscription to %s refused", eventType)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	ch := make(chan json.RawMessage)
+	sub := &subscription{c: c, done: make(chan struct{})}
+	subsMu.Lock()
+	subs[ch] = sub
+	subsMu.Unlock()
+	go func() {
+		defer func() {
+			subsMu.Lock()
+			delete(subs, ch)
+			subsMu.Unlock()
+			c.Close()
+			close(ch)
+		}()
+		for {
+			msgType, data, err := c.recv()
+			if err != nil {
+				return
+			}
+			if msgType&eventBit == 0 {
+				continue
+			}
+			select {
+			case ch <- data:
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Unsubscribe closes the connection behind a channel from Subscribe. The
+// channel is closed once any event being delivered has been dropped.
+func Unsubscribe(events <-chan json.RawMessage) {
+	subsMu.Lock()
+	sub, ok := subs[events]
+	delete(subs, events)
+	subsMu.Unlock()
+	if ok {
+		close(sub.done)
+		sub.c.Close()
+	}
+}
@@ -0,0 +1,166 @@
+package i3ipc
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeI3 listens on a unix socket set as $I3SOCK, and calls handle with
+// each connection and the messages sent on it, for handle to reply on.
+func fakeI3(t *testing.T, handle func(c *conn, msgType uint32, payload string)) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ipc.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c *conn) {
+				defer c.Close()
+				for {
+					msgType, payload, err := c.recv()
+					if err != nil {
+						return
+					}
+					handle(c, msgType, string(payload))
+				}
+			}(&conn{nc})
+		}
+	}()
+	old, had := os.LookupEnv("I3SOCK")
+	os.Setenv("I3SOCK", path)
+	t.Cleanup(func() {
+		if had {
+			os.Setenv("I3SOCK", old)
+		} else {
+			os.Unsetenv("I3SOCK")
+		}
+	})
+}
+
+func TestSocketPath(t *testing.T) {
+	fakeI3(t, func(*conn, uint32, string) {})
+	path, err := SocketPath()
+	if err != nil || !strings.HasSuffix(path, "ipc.sock") {
+		t.Errorf("got %q, %v", path, err)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	got := make(chan string, 1)
+	fakeI3(t, func(c *conn, msgType uint32, payload string) {
+		if msgType != RunCommandMsg {
+			t.Errorf("message type %d, want %d", msgType, RunCommandMsg)
+		}
+		got <- payload
+		if strings.Contains(payload, "nope") {
+			c.send(msgType, `[{"success": false, "error": "Unknown command"}]`)
+			return
+		}
+		c.send(msgType, `[{"success": true}]`)
+	})
+
+	if err := FocusWorkspace(`2: "web"`); err != nil {
+		t.Error(err)
+	}
+	if p := <-got; p != `workspace "2: \"web\""` {
+		t.Errorf("sent %q", p)
+	}
+	if err := RunCommand("nope"); err == nil || !strings.Contains(err.Error(), "Unknown command") {
+		t.Errorf("got %v, want the error from i3", err)
+	}
+	<-got
+}
+
+func TestSend(t *testing.T) {
+	fakeI3(t, func(c *conn, msgType uint32, payload string) {
+		c.send(msgType, `{"nodes": []}`)
+	})
+	reply, err := Send(GetTreeMsg, "")
+	if err != nil || string(reply) != `{"nodes": []}` {
+		t.Errorf("got %s, %v", reply, err)
+	}
+
+	os.Setenv("I3SOCK", filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := Send(GetTreeMsg, ""); err == nil {
+		t.Error("no error without i3 listening")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	closed := make(chan struct{})
+	fakeI3(t, func(c *conn, msgType uint32, payload string) {
+		var events []string
+		json.Unmarshal([]byte(payload), &events)
+		if len(events) != 1 || events[0] == "binding" {
+			c.send(msgType, `{"success": false}`)
+			return
+		}
+		c.send(msgType, `{"success": true}`)
+		go func() {
+			// Replies to other messages aren't events.
+			c.send(GetTreeMsg, `{}`)
+			c.send(eventBit|3, `{"change": "focus"}`)
+			for {
+				if err := c.send(eventBit|3, `{"change": "title"}`); err != nil {
+					close(closed)
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	})
+
+	if _, err := Subscribe("binding"); err == nil {
+		t.Error("no error for a refused subscription")
+	}
+
+	events, err := Subscribe("window")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := <-events; string(e) != `{"change": "focus"}` {
+		t.Errorf("first event %s", e)
+	}
+	Unsubscribe(events)
+	Unsubscribe(events)
+	for range events {
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("connection still open after Unsubscribe")
+	}
+}
+
+func TestSubscribeConnectionLost(t *testing.T) {
+	fakeI3(t, func(c *conn, msgType uint32, payload string) {
+		c.send(msgType, `{"success": true}`)
+		c.send(eventBit|0, `{"change": "focus"}`)
+		c.Close()
+	})
+	events, err := Subscribe("workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range events {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("%d events before the connection was lost, want 1", n)
+	}
+	// Harmless once the channel has closed.
+	Unsubscribe(events)
+}
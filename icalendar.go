@@ -0,0 +1,686 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/static"
+	"github.com/fsnotify/fsnotify"
+)
+
+// icalendarPath is a .ics file, or a directory of them (e.g. one synced by
+// vdirsyncer), to show upcoming events from.
+var icalendarPath = home(".calendars")
+
+// icalendarLookahead is how far ahead to show events.
+const icalendarLookahead = 7 * 24 * time.Hour
+
+type calEvent struct {
+	Summary  string
+	Location string
+	Start    time.Time
+	End      time.Time
+	AllDay   bool
+}
+
+// icalRule is the subset of RRULE that's supported: DAILY, WEEKLY (with
+// BYDAY) and MONTHLY repeats, with INTERVAL, COUNT and UNTIL.
+type icalRule struct {
+	Freq     string
+	Interval int
+	Count    int
+	Until    time.Time
+	ByDay    []time.Weekday
+}
+
+type icalEvent struct {
+	Summary  string
+	Location string
+	// start is the wall clock time of the first occurrence, stored as UTC,
+	// which zone converts to an instant. Recurrences are computed on the
+	// wall clock so that they keep their local time across DST changes.
+	start    time.Time
+	zone     func(wall time.Time) time.Time
+	duration time.Duration
+	allDay   bool
+	rule     *icalRule
+	// exdates holds the excluded occurrences as UTC instants, so that
+	// they match whichever zone the EXDATE was given in.
+	exdates map[time.Time]bool
+}
+
+// icalExdate is an EXDATE value before the event's own zone is known.
+// zone is nil for floating times, which are in the event's zone.
+type icalExdate struct {
+	wall time.Time
+	zone func(time.Time) time.Time
+}
+
+// unfoldLines splits iCalendar content into logical lines, joining folded
+// continuation lines that start with a space or tab.
+func unfoldLines(r io.Reader) ([]string, error) {
+	var lines []string
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, s.Err()
+}
+
+// parseICalProp splits a content line, e.g.
+// "DTSTART;TZID=Europe/Copenhagen:20210706T100000".
+func parseICalProp(line string) (name string, params map[string]string, value string) {
+	params = map[string]string{}
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), params, ""
+	}
+	head, value := line[:colon], line[colon+1:]
+	parts := strings.Split(head, ";")
+	for _, p := range parts[1:] {
+		if kv := strings.SplitN(p, "=", 2); len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+func unescapeICalText(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// parseICalWallTime parses a DATE or DATE-TIME value as a wall clock time
+// in UTC. utc is set for times with a trailing Z.
+func parseICalWallTime(value string) (wall time.Time, allDay, utc bool, err error) {
+	switch {
+	case len(value) == 8:
+		wall, err = time.Parse("20060102", value)
+		return wall, true, false, err
+	case strings.HasSuffix(value, "Z"):
+		wall, err = time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+		return wall, false, true, err
+	}
+	wall, err = time.Parse("20060102T150405", value)
+	return wall, false, false, err
+}
+
+// inLocation reinterprets a wall clock time in loc.
+func inLocation(loc *time.Location) func(time.Time) time.Time {
+	return func(wall time.Time) time.Time {
+		return time.Date(wall.Year(), wall.Month(), wall.Day(),
+			wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+	}
+}
+
+// parseICalDuration parses durations such as "PT1H30M", "P1D" or "P2W".
+func parseICalDuration(value string) (time.Duration, error) {
+	v := strings.TrimPrefix(value, "+")
+	neg := strings.HasPrefix(v, "-")
+	v = strings.TrimPrefix(v, "-")
+	if !strings.HasPrefix(v, "P") {
+		return 0, fmt.Errorf("bad duration %q", value)
+	}
+	var d time.Duration
+	inTime := false
+	num := ""
+	for _, c := range v[1:] {
+		switch {
+		case c >= '0' && c <= '9':
+			num += string(c)
+			continue
+		case c == 'T':
+			inTime = true
+			continue
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return 0, fmt.Errorf("bad duration %q", value)
+		}
+		num = ""
+		switch {
+		case c == 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case c == 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case c == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case c == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case c == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("bad duration %q", value)
+		}
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+var icalWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseICalRule(value string) (*icalRule, error) {
+	r := &icalRule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		var err error
+		switch strings.ToUpper(kv[0]) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(kv[1])
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(kv[1])
+		case "COUNT":
+			r.Count, err = strconv.Atoi(kv[1])
+		case "UNTIL":
+			var utc bool
+			r.Until, _, utc, err = parseICalWallTime(kv[1])
+			if err == nil && !utc {
+				// Floating UNTIL is compared on the wall clock anyway.
+				r.Until = r.Until.UTC()
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(kv[1], ",") {
+				// Ordinals such as 1MO only make sense for MONTHLY, which
+				// isn't supported with BYDAY, so just use the weekday.
+				d = strings.TrimLeft(d, "+-0123456789")
+				if wd, ok := icalWeekdays[strings.ToUpper(d)]; ok {
+					r.ByDay = append(r.ByDay, wd)
+				}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad RRULE %q: %v", value, err)
+		}
+	}
+	switch r.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY":
+	default:
+		return nil, fmt.Errorf("unsupported RRULE frequency %q", r.Freq)
+	}
+	if r.Interval < 1 {
+		r.Interval = 1
+	}
+	return r, nil
+}
+
+// vtimezone is a timezone defined in the calendar itself, for TZIDs that
+// aren't in the tz database (e.g. Outlook's "W. Europe Standard Time").
+type vtimezone struct {
+	observances []tzObservance
+}
+
+// tzObservance is a STANDARD or DAYLIGHT component. It starts at start
+// (local wall time, before the change) and recurs yearly in month on the
+// nth weekday (negative counts from the end of the month), if month is set.
+type tzObservance struct {
+	offset  int
+	start   time.Time
+	month   time.Month
+	nth     int
+	weekday time.Weekday
+}
+
+// parseUTCOffset parses offsets such as "+0200" or "-0530" into seconds.
+func parseUTCOffset(value string) (int, error) {
+	if len(value) < 5 {
+		return 0, fmt.Errorf("bad UTC offset %q", value)
+	}
+	h, err1 := strconv.Atoi(value[1:3])
+	m, err2 := strconv.Atoi(value[3:5])
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("bad UTC offset %q", value)
+	}
+	secs := h*3600 + m*60
+	if value[0] == '-' {
+		secs = -secs
+	}
+	return secs, nil
+}
+
+// transition returns the wall clock time at which o takes effect in year.
+func (o tzObservance) transition(year int) time.Time {
+	if o.month == 0 {
+		return o.start
+	}
+	hour, min, sec := o.start.Clock()
+	if o.nth < 0 {
+		last := time.Date(year, o.month+1, 0, hour, min, sec, 0, time.UTC)
+		back := (int(last.Weekday()) - int(o.weekday) + 7) % 7
+		return last.AddDate(0, 0, -back+7*(o.nth+1))
+	}
+	first := time.Date(year, o.month, 1, hour, min, sec, 0, time.UTC)
+	fwd := (int(o.weekday) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, fwd+7*(o.nth-1))
+}
+
+// offsetAt returns the UTC offset in effect at a wall clock time, from
+// whichever observance most recently took effect.
+func (tz *vtimezone) offsetAt(wall time.Time) int {
+	var best time.Time
+	offset, found := 0, false
+	for _, o := range tz.observances {
+		for _, year := range []int{wall.Year() - 1, wall.Year()} {
+			t := o.transition(year)
+			if o.start.After(t) || t.After(wall) {
+				continue
+			}
+			if !found || t.After(best) {
+				best, offset, found = t, o.offset, true
+			}
+		}
+	}
+	if !found && len(tz.observances) > 0 {
+		return tz.observances[0].offset
+	}
+	return offset
+}
+
+func (tz *vtimezone) zone(name string) func(time.Time) time.Time {
+	return func(wall time.Time) time.Time {
+		return inLocation(time.FixedZone(name, tz.offsetAt(wall)))(wall)
+	}
+}
+
+func parseVTimezone(lines []string) (string, *vtimezone) {
+	var tzid string
+	tz := &vtimezone{}
+	var cur *tzObservance
+	for _, line := range lines {
+		name, _, value := parseICalProp(line)
+		switch {
+		case name == "TZID" && cur == nil:
+			tzid = value
+		case name == "BEGIN" && (value == "STANDARD" || value == "DAYLIGHT"):
+			cur = &tzObservance{}
+		case name == "END" && (value == "STANDARD" || value == "DAYLIGHT"):
+			if cur != nil {
+				tz.observances = append(tz.observances, *cur)
+			}
+			cur = nil
+		case cur == nil:
+		case name == "TZOFFSETTO":
+			cur.offset, _ = parseUTCOffset(value)
+		case name == "DTSTART":
+			cur.start, _, _, _ = parseICalWallTime(value)
+		case name == "RRULE":
+			for _, part := range strings.Split(value, ";") {
+				kv := strings.SplitN(part, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				switch kv[0] {
+				case "BYMONTH":
+					m, _ := strconv.Atoi(kv[1])
+					cur.month = time.Month(m)
+				case "BYDAY":
+					day := strings.TrimLeft(kv[1], "+-0123456789")
+					nth, err := strconv.Atoi(strings.TrimSuffix(kv[1], day))
+					if err != nil {
+						nth = 1
+					}
+					cur.nth, cur.weekday = nth, icalWeekdays[day]
+				}
+			}
+		}
+	}
+	return tzid, tz
+}
+
+// parseICalendar reads the VEVENTs from an iCalendar stream.
+func parseICalendar(r io.Reader) ([]icalEvent, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+	timezones := map[string]*vtimezone{}
+	var tzLines []string
+	inTz := false
+	for _, line := range lines {
+		name, _, value := parseICalProp(line)
+		switch {
+		case name == "BEGIN" && value == "VTIMEZONE":
+			inTz, tzLines = true, nil
+		case name == "END" && value == "VTIMEZONE":
+			inTz = false
+			if id, tz := parseVTimezone(tzLines); id != "" {
+				timezones[id] = tz
+			}
+		case inTz:
+			tzLines = append(tzLines, line)
+		}
+	}
+	zoneFor := func(params map[string]string, utc bool) func(time.Time) time.Time {
+		if utc {
+			return inLocation(time.UTC)
+		}
+		tzid, ok := params["TZID"]
+		if !ok {
+			// Floating time, which is the same wall clock time everywhere.
+			return inLocation(time.Local)
+		}
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			return inLocation(loc)
+		}
+		if tz, ok := timezones[tzid]; ok {
+			return tz.zone(tzid)
+		}
+		return inLocation(time.Local)
+	}
+
+	var events []icalEvent
+	var cur *icalEvent
+	var end time.Time
+	var endZone func(time.Time) time.Time
+	var exdates []icalExdate
+	depth := 0
+	for _, line := range lines {
+		name, params, value := parseICalProp(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			cur, end, endZone, exdates, depth = &icalEvent{exdates: map[time.Time]bool{}}, time.Time{}, nil, nil, 0
+			continue
+		case cur == nil:
+			continue
+		case name == "BEGIN":
+			// e.g. VALARM, whose properties aren't the event's.
+			depth++
+			continue
+		case name == "END" && value != "VEVENT":
+			depth--
+			continue
+		case depth > 0:
+			continue
+		}
+		switch name {
+		case "SUMMARY":
+			cur.Summary = unescapeICalText(value)
+		case "LOCATION":
+			cur.Location = unescapeICalText(value)
+		case "DTSTART":
+			wall, allDay, utc, err := parseICalWallTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("bad DTSTART %q: %v", value, err)
+			}
+			cur.start, cur.allDay, cur.zone = wall, allDay, zoneFor(params, utc)
+		case "DTEND":
+			wall, _, utc, err := parseICalWallTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("bad DTEND %q: %v", value, err)
+			}
+			end, endZone = wall, zoneFor(params, utc)
+		case "DURATION":
+			d, err := parseICalDuration(value)
+			if err != nil {
+				return nil, err
+			}
+			cur.duration = d
+		case "RRULE":
+			rule, err := parseICalRule(value)
+			if err != nil {
+				return nil, err
+			}
+			cur.rule = rule
+		case "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				wall, _, utc, err := parseICalWallTime(v)
+				if err != nil {
+					continue
+				}
+				ex := icalExdate{wall: wall}
+				if _, ok := params["TZID"]; ok || utc {
+					ex.zone = zoneFor(params, utc)
+				}
+				exdates = append(exdates, ex)
+			}
+		case "END":
+			if cur.zone == nil {
+				// No DTSTART, so there's nothing to show.
+				cur = nil
+				continue
+			}
+			if !end.IsZero() {
+				cur.duration = endZone(end).Sub(cur.zone(cur.start))
+			} else if cur.duration == 0 && cur.allDay {
+				cur.duration = 24 * time.Hour
+			}
+			for _, ex := range exdates {
+				zone := ex.zone
+				if zone == nil {
+					zone = cur.zone
+				}
+				cur.exdates[zone(ex.wall).UTC()] = true
+			}
+			events = append(events, *cur)
+			cur = nil
+		}
+	}
+	return events, nil
+}
+
+// nth returns the wall clock start of the nth repeat period of a rule.
+func (e icalEvent) nth(n int) (time.Time, bool) {
+	step := n * e.rule.Interval
+	switch e.rule.Freq {
+	case "DAILY":
+		return e.start.AddDate(0, 0, step), true
+	case "WEEKLY":
+		return e.start.AddDate(0, 0, 7*step), true
+	}
+	t := e.start.AddDate(0, step, 0)
+	// Months without the day of the month (e.g. the 31st) are skipped.
+	return t, t.Day() == e.start.Day()
+}
+
+// firstPeriod returns a repeat period that starts no later than any
+// occurrence overlapping from, so that expansion needn't start at DTSTART.
+// Rules with a COUNT are always expanded from the start, since skipped
+// occurrences still count towards it.
+func (e icalEvent) firstPeriod(from time.Time) int {
+	if e.rule.Count > 0 {
+		return 0
+	}
+	// Wall clock times are within a day of the instant, whatever the zone.
+	wall := from.Add(-e.duration).Add(-48 * time.Hour).UTC()
+	if !wall.After(e.start) {
+		return 0
+	}
+	var periods int
+	switch e.rule.Freq {
+	case "DAILY":
+		periods = int(wall.Sub(e.start)/(24*time.Hour)) / e.rule.Interval
+	case "WEEKLY":
+		periods = int(wall.Sub(e.start)/(7*24*time.Hour))/e.rule.Interval - 1
+	case "MONTHLY":
+		months := (wall.Year()-e.start.Year())*12 + int(wall.Month()-e.start.Month())
+		periods = months/e.rule.Interval - 1
+	}
+	if periods < 0 {
+		return 0
+	}
+	return periods
+}
+
+// Occurrences returns the instances of the event that overlap from-to.
+func (e icalEvent) Occurrences(from, to time.Time) []calEvent {
+	occurrence := func(wall time.Time) calEvent {
+		start := e.zone(wall)
+		return calEvent{
+			Summary: e.Summary, Location: e.Location, AllDay: e.allDay,
+			Start: start, End: start.Add(e.duration),
+		}
+	}
+	overlaps := func(c calEvent) bool {
+		return c.End.After(from) && c.Start.Before(to)
+	}
+	var res []calEvent
+	if e.rule == nil {
+		if c := occurrence(e.start); overlaps(c) {
+			res = append(res, c)
+		}
+		return res
+	}
+	count := 0
+	for n := e.firstPeriod(from); ; n++ {
+		period, ok := e.nth(n)
+		if !ok {
+			continue
+		}
+		starts := []time.Time{period}
+		if e.rule.Freq == "WEEKLY" && len(e.rule.ByDay) > 0 {
+			starts = weekdaysOf(period, e.rule.ByDay)
+		}
+		for _, wall := range starts {
+			if wall.Before(e.start) {
+				continue
+			}
+			if e.rule.Count > 0 && count >= e.rule.Count {
+				return res
+			}
+			if !e.rule.Until.IsZero() && wall.After(e.rule.Until) {
+				return res
+			}
+			count++
+			c := occurrence(wall)
+			if !c.Start.Before(to) {
+				return res
+			}
+			if !e.exdates[c.Start.UTC()] && overlaps(c) {
+				res = append(res, c)
+			}
+		}
+	}
+}
+
+// weekdaysOf returns the given days of the Monday-based week containing
+// t, at the same time of day.
+func weekdaysOf(t time.Time, days []time.Weekday) []time.Time {
+	monday := t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	var res []time.Time
+	for _, d := range days {
+		res = append(res, monday.AddDate(0, 0, (int(d)+6)%7))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Before(res[j]) })
+	return res
+}
+
+// icalFiles returns path if it's a file, or the .ics files in it if it's
+// a directory.
+func icalFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	return filepath.Glob(filepath.Join(path, "*.ics"))
+}
+
+// upcomingEvents returns the events in the files at path that haven't yet
+// ended by now, and start within the lookahead, soonest first.
+func upcomingEvents(path string, now time.Time, lookahead time.Duration) ([]calEvent, error) {
+	files, err := icalFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var res []calEvent
+	for _, f := range files {
+		file, err := os.Open(f)
+		if err != nil {
+			return nil, err
+		}
+		events, err := parseICalendar(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Base(f), err)
+		}
+		for _, e := range events {
+			res = append(res, e.Occurrences(now, now.Add(lookahead))...)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Start.Before(res[j].Start) })
+	return res, nil
+}
+
+// icalendarModule shows upcoming events from local .ics files, updating
+// whenever they change and every minute for the passing time.
+type icalendarModule struct {
+	path   string
+	output func([]calEvent, time.Time) bar.Output
+	out    *static.Module
+	mu     sync.Mutex
+}
+
+func newICalendar(path string, output func([]calEvent, time.Time) bar.Output) *icalendarModule {
+	return &icalendarModule{path: path, output: output, out: static.New(nil)}
+}
+
+func (m *icalendarModule) update() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	events, err := upcomingEvents(m.path, now, icalendarLookahead)
+	if os.IsNotExist(err) {
+		m.out.Set(nil)
+		return
+	}
+	if err != nil {
+		logWarnf("Could not read calendar: %v", err)
+		m.out.Set(nil)
+		return
+	}
+	m.out.Set(m.output(events, now))
+}
+
+// Stream watches the calendar files.
+func (m *icalendarModule) Stream(s bar.Sink) {
+	m.update()
+	go m.watch()
+	m.out.Stream(s)
+}
+
+func (m *icalendarModule) watch() {
+	changed := make(<-chan fsnotify.Event)
+	if w, err := fsnotify.NewWatcher(); err == nil {
+		defer w.Close()
+		dir := m.path
+		if info, err := os.Stat(m.path); err == nil && !info.IsDir() {
+			// Syncing replaces the file, so watch its directory.
+			dir = filepath.Dir(m.path)
+		}
+		if err := w.Add(dir); err == nil {
+			changed = w.Events
+		}
+	}
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+	for {
+		select {
+		case <-changed:
+		case <-tick.C:
+		}
+		m.update()
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// occurrences parses a single VEVENT and returns the starts of its
+// occurrences between from and to, formatted in loc.
+func occurrences(t *testing.T, loc *time.Location, from, to string, event ...string) []string {
+	t.Helper()
+	ics := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n" + strings.Join(event, "\r\n") + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	events, err := parseICalendar(strings.NewReader(ics))
+	if err != nil || len(events) != 1 {
+		t.Fatalf("got %d events, %v", len(events), err)
+	}
+	f, err1 := time.Parse(time.RFC3339, from)
+	u, err2 := time.Parse(time.RFC3339, to)
+	if err1 != nil || err2 != nil {
+		t.Fatal(err1, err2)
+	}
+	res := []string{}
+	for _, c := range events[0].Occurrences(f, u) {
+		res = append(res, c.Start.In(loc).Format("2006-01-02 15:04 MST"))
+	}
+	return res
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skip(err)
+	}
+	return loc
+}
+
+func TestICalDaily(t *testing.T) {
+	cph := loadLocation(t, "Europe/Copenhagen")
+	// Over 10000 days after DTSTART, with occurrences excluded in UTC and
+	// in another zone.
+	got := occurrences(t, cph, "2026-10-17T00:00:00Z", "2026-10-22T00:00:00Z",
+		"SUMMARY:Standup",
+		"DTSTART;TZID=Europe/Copenhagen:19900101T090000",
+		"DURATION:PT30M",
+		"RRULE:FREQ=DAILY",
+		"EXDATE:20261019T070000Z",
+		"EXDATE;TZID=America/New_York:20261020T030000")
+	want := []string{"2026-10-17 09:00 CEST", "2026-10-18 09:00 CEST", "2026-10-21 09:00 CEST"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestICalDailyAllDay(t *testing.T) {
+	got := occurrences(t, time.UTC, "2026-10-17T00:00:00Z", "2026-10-20T00:00:00Z",
+		"DTSTART;VALUE=DATE:20261001",
+		"RRULE:FREQ=DAILY",
+		"EXDATE;VALUE=DATE:20261018")
+	want := []string{"2026-10-17 00:00 UTC", "2026-10-19 00:00 UTC"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestICalWeekly(t *testing.T) {
+	cph := loadLocation(t, "Europe/Copenhagen")
+	// Every other week, keeping 10:00 local across the end of DST.
+	got := occurrences(t, cph, "2026-10-12T00:00:00Z", "2026-11-03T00:00:00Z",
+		"DTSTART;TZID=Europe/Copenhagen:20260105T100000",
+		"DTEND;TZID=Europe/Copenhagen:20260105T110000",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH")
+	want := []string{
+		"2026-10-12 10:00 CEST", "2026-10-15 10:00 CEST",
+		"2026-10-26 10:00 CET", "2026-10-29 10:00 CET",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = occurrences(t, time.UTC, "2026-01-01T00:00:00Z", "2026-02-01T00:00:00Z",
+		"DTSTART:20260105T100000",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3")
+	want = []string{"2026-01-05 10:00 UTC", "2026-01-07 10:00 UTC", "2026-01-12 10:00 UTC"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("with COUNT: got %q, want %q", got, want)
+	}
+}
+
+func TestICalMonthly(t *testing.T) {
+	got := occurrences(t, time.UTC, "2026-02-01T00:00:00Z", "2027-06-01T00:00:00Z",
+		"DTSTART:20260131T120000Z",
+		"RRULE:FREQ=MONTHLY;UNTIL=20261001T000000Z")
+	want := []string{
+		"2026-03-31 12:00 UTC", "2026-05-31 12:00 UTC",
+		"2026-07-31 12:00 UTC", "2026-08-31 12:00 UTC",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = occurrences(t, time.UTC, "2026-10-01T00:00:00Z", "2026-12-01T00:00:00Z",
+		"DTSTART:19000115T120000Z",
+		"RRULE:FREQ=MONTHLY;INTERVAL=3")
+	want = []string{"2026-10-15 12:00 UTC"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("from 1900: got %q, want %q", got, want)
+	}
+}
+
+func TestICalCrossesMidnight(t *testing.T) {
+	// The occurrence that started yesterday is still on.
+	got := occurrences(t, time.UTC, "2026-10-17T00:30:00Z", "2026-10-17T12:00:00Z",
+		"DTSTART:20260101T230000Z",
+		"DTEND:20260102T010000Z",
+		"RRULE:FREQ=DAILY")
+	want := []string{"2026-10-16 23:00 UTC"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = occurrences(t, time.UTC, "2026-10-17T01:00:00Z", "2026-10-17T12:00:00Z",
+		"DTSTART:20260101T230000Z",
+		"DTEND:20260102T010000Z",
+		"RRULE:FREQ=DAILY")
+	if len(got) != 0 {
+		t.Errorf("after it ended: got %q", got)
+	}
+
+	got = occurrences(t, time.UTC, "2026-10-17T00:30:00Z", "2026-10-17T12:00:00Z",
+		"DTSTART:20261016T230000Z",
+		"DURATION:PT2H")
+	want = []string{"2026-10-16 23:00 UTC"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("single event: got %q, want %q", got, want)
+	}
+}
+
+func TestICalVTimezone(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VTIMEZONE",
+		"TZID:W. Europe Standard Time",
+		"BEGIN:STANDARD",
+		"DTSTART:16010101T030000",
+		"TZOFFSETFROM:+0200",
+		"TZOFFSETTO:+0100",
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10",
+		"END:STANDARD",
+		"BEGIN:DAYLIGHT",
+		"DTSTART:16010101T020000",
+		"TZOFFSETFROM:+0100",
+		"TZOFFSETTO:+0200",
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3",
+		"END:DAYLIGHT",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"DTSTART;TZID=W. Europe Standard Time:20260105T100000",
+		"RRULE:FREQ=WEEKLY",
+		"EXDATE;TZID=W. Europe Standard Time:20261019T100000",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	events, err := parseICalendar(strings.NewReader(ics))
+	if err != nil || len(events) != 1 {
+		t.Fatalf("got %d events, %v", len(events), err)
+	}
+	from := time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+	var got []string
+	for _, c := range events[0].Occurrences(from, from.Add(3*7*24*time.Hour)) {
+		got = append(got, c.Start.UTC().Format("2006-01-02 15:04"))
+	}
+	want := []string{"2026-10-12 08:00", "2026-10-26 09:00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/funcs"
+	"github.com/godbus/dbus/v5"
+)
+
+// idleThreshold is how long the session must be idle before the idle
+// indicator is shown, e.g. set a little below the screen lock timeout.
+var idleThreshold = 4 * time.Minute
+
+// idlePollInterval is how often the idle time is read.
+var idlePollInterval = 10 * time.Second
+
+// idleTime returns how long the session has been idle, from the X screen
+// saver extension through xprintidle, or from logind's idle hint, which
+// Wayland idle daemons like swayidle set.
+func idleTime() (time.Duration, error) {
+	if os.Getenv("DISPLAY") != "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		if out, err := quickOutput("xprintidle"); err == nil {
+			ms, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+			if err == nil {
+				return time.Duration(ms) * time.Millisecond, nil
+			}
+		}
+	}
+	return logindIdleTime()
+}
+
+// logindIdleTime reads the idle hint of the current logind session.
+func logindIdleTime() (time.Duration, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return 0, err
+	}
+	session := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1/session/auto")
+	hint, err := session.GetProperty("org.freedesktop.login1.Session.IdleHint")
+	if err != nil {
+		return 0, err
+	}
+	if idle, _ := hint.Value().(bool); !idle {
+		return 0, nil
+	}
+	since, err := session.GetProperty("org.freedesktop.login1.Session.IdleSinceHint")
+	if err != nil {
+		return 0, err
+	}
+	// In microseconds since the epoch.
+	us, ok := since.Value().(uint64)
+	if !ok || us == 0 {
+		return 0, errors.New("no idle time in session")
+	}
+	return time.Since(time.Unix(0, int64(us)*int64(time.Microsecond))), nil
+}
+
+// newIdleModule shows how long the session has been idle, once it's been
+// idle for longer than idleThreshold.
+func newIdleModule() *funcs.RepeatingModule {
+	return pollEvery(idlePollInterval, func(s bar.Sink) {
+		idle, err := idleTime()
+		if err != nil {
+			logDebugf("Could not read idle time: %v", err)
+		}
+		if err != nil || idle < idleThreshold {
+			s.Output(nil)
+			return
+		}
+		s.Output(idleOutput(idle))
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// barLayout lists the modal modes and top-level modules to show, in order.
+// Anything not listed is disabled.
+type barLayout struct {
+	Modes   []string `json:"modes"`
+	Modules []string `json:"modules"`
+}
+
+// layoutFile overrides defaultLayout, e.g.
+//
+//	{"modes": ["sysinfo", "weather"], "modules": ["modes", "localtime"]}
+//
+// where "modes" is the modal itself.
+var layoutFile = configDir("layout.json")
+
+var defaultLayout = barLayout{
+	Modes: []string{
+		"kubeContext", "network", "media", "sysinfo",
+		"battery", "weather", "timezones", "calendar", "profiles",
+	},
+	Modules: []string{"workspaces", "display", "usb", "colorpicker", "clipboard", "webcam", "recording", "pomodoro", "gpg", "modes", "localdate", "localtime"},
+}
+
+// loadLayout reads layoutFile, using the default for anything it doesn't
+// set.
+func loadLayout() barLayout {
+	layout := defaultLayout
+	data, err := ioutil.ReadFile(layoutFile)
+	if os.IsNotExist(err) {
+		return layout
+	}
+	var l barLayout
+	if err == nil {
+		err = json.Unmarshal(data, &l)
+	}
+	if err != nil {
+		logWarnf("Ignoring %s: %v", layoutFile, err)
+		return layout
+	}
+	if l.Modes != nil {
+		layout.Modes = l.Modes
+	}
+	if l.Modules != nil {
+		layout.Modules = l.Modules
+	}
+	return layout
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// linkMonitorBuffer is how many events of each kind are kept for slow
+// readers. Events are dropped rather than blocking the monitor, since the
+// next change will bring any reader up to date.
+const linkMonitorBuffer = 8
+
+// linkMonitor turns the changes to the primary network link into typed
+// events. netlink only exposes the link, not the routing table, so route
+// changes show up as the primary interface going down and another coming
+// up, and addresses have no prefix length.
+//
+// Each call to an event method returns a new channel that receives every
+// event of that kind from then on, so modules can share a monitor, and
+// kinds of event that nothing reads aren't sent at all.
+type linkMonitor struct {
+	mu             sync.Mutex
+	up, down       []chan string
+	added, removed []chan net.IP
+	changed        []chan linkAttrs
+	// watchAttrs starts listening for RTM_NEWLINK, the first time
+	// LinkChanged is used.
+	watchAttrs sync.Once
+}
+
+// linkAttrs are the attributes of an interface from an RTM_NEWLINK message,
+// which netlink.Link doesn't carry.
+type linkAttrs struct {
+	Name     string
+	MTU      int
+	Loopback bool
+}
+
+// primaryInterface returns the name of the current primary interface.
+func primaryInterface() string {
+	sub := netlink.Any()
+	defer sub.Unsubscribe()
+	return sub.Get().Name
+}
+
+func newLinkMonitor() *linkMonitor {
+	m := &linkMonitor{}
+	go m.watch()
+	return m
+}
+
+func (m *linkMonitor) subscribeName(subs *[]chan string) <-chan string {
+	ch := make(chan string, linkMonitorBuffer)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	*subs = append(*subs, ch)
+	return ch
+}
+
+func (m *linkMonitor) subscribeIP(subs *[]chan net.IP) <-chan net.IP {
+	ch := make(chan net.IP, linkMonitorBuffer)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	*subs = append(*subs, ch)
+	return ch
+}
+
+// InterfaceUp receives the name of each interface that comes up as the
+// primary one.
+func (m *linkMonitor) InterfaceUp() <-chan string { return m.subscribeName(&m.up) }
+
+// InterfaceDown receives the name of each interface that stops being the
+// primary one, or goes down.
+func (m *linkMonitor) InterfaceDown() <-chan string { return m.subscribeName(&m.down) }
+
+// AddressAdded receives the addresses added to the primary interface.
+func (m *linkMonitor) AddressAdded() <-chan net.IP { return m.subscribeIP(&m.added) }
+
+// AddressRemoved receives the addresses removed from the primary interface.
+func (m *linkMonitor) AddressRemoved() <-chan net.IP { return m.subscribeIP(&m.removed) }
+
+// LinkChanged receives the attributes of every interface, primary or not,
+// each time the kernel reports a change to it, e.g. of its MTU.
+func (m *linkMonitor) LinkChanged() <-chan linkAttrs {
+	m.watchAttrs.Do(func() { go m.watchLinkAttrs() })
+	ch := make(chan linkAttrs, linkMonitorBuffer)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changed = append(m.changed, ch)
+	return ch
+}
+
+func (m *linkMonitor) watch() {
+	sub := netlink.Any()
+	defer sub.Unsubscribe()
+	var prev netlink.Link
+	for {
+		cur := sub.Get()
+		m.diff(prev, cur)
+		prev = cur
+		<-sub.Next()
+	}
+}
+
+// diff sends the events for a change of the primary link from prev to cur.
+func (m *linkMonitor) diff(prev, cur netlink.Link) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wasUp := prev.Name != "" && prev.State == netlink.Up
+	isUp := cur.Name != "" && cur.State == netlink.Up
+	same := prev.Name == cur.Name
+	if wasUp && (!same || !isUp) {
+		sendName(m.down, prev.Name)
+	}
+	if isUp && (!same || !wasUp) {
+		sendName(m.up, cur.Name)
+	}
+	// Addresses of a different interface are all new.
+	before := prev.IPs
+	if !same {
+		before = nil
+		for _, ip := range prev.IPs {
+			sendIP(m.removed, ip)
+		}
+	}
+	for _, ip := range before {
+		if !containsIP(cur.IPs, ip) {
+			sendIP(m.removed, ip)
+		}
+	}
+	for _, ip := range cur.IPs {
+		if !containsIP(before, ip) {
+			sendIP(m.added, ip)
+		}
+	}
+}
+
+// watchLinkAttrs sends the attributes from the RTM_NEWLINK messages of the
+// kernel's link multicast group.
+func (m *linkMonitor) watchLinkAttrs() {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		logWarnf("Cannot watch link changes: %v", err)
+		return
+	}
+	defer syscall.Close(fd)
+	addr := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: unix.RTMGRP_LINK}
+	if err := syscall.Bind(fd, addr); err != nil {
+		logWarnf("Cannot watch link changes: %v", err)
+		return
+	}
+	buf := make([]byte, 1<<16)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.EINTR || err == syscall.ENOBUFS {
+			// Messages were lost, but the next change is complete.
+			continue
+		}
+		if err != nil {
+			logWarnf("Stopped watching link changes: %v", err)
+			return
+		}
+		for _, attrs := range parseLinkMessages(buf[:n]) {
+			m.mu.Lock()
+			for _, ch := range m.changed {
+				select {
+				case ch <- attrs:
+				default:
+					logDebugf("Dropped link event for %s", attrs.Name)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// nativeEndian is the byte order of netlink attributes, which is the
+// host's.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// parseLinkMessages returns the attributes from the RTM_NEWLINK messages in
+// b, skipping anything else or anything malformed.
+func parseLinkMessages(b []byte) []linkAttrs {
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil
+	}
+	var links []linkAttrs
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWLINK || len(msg.Data) < syscall.SizeofIfInfomsg {
+			continue
+		}
+		ifi := (*syscall.IfInfomsg)(unsafe.Pointer(&msg.Data[0]))
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+		if err != nil {
+			continue
+		}
+		link := linkAttrs{Loopback: ifi.Flags&syscall.IFF_LOOPBACK != 0}
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case syscall.IFLA_IFNAME:
+				link.Name = string(bytes.TrimRight(a.Value, "\x00"))
+			case syscall.IFLA_MTU:
+				if len(a.Value) >= 4 {
+					link.MTU = int(nativeEndian.Uint32(a.Value))
+				}
+			}
+		}
+		if link.Name != "" {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func sendName(subs []chan string, v string) {
+	for _, ch := range subs {
+		select {
+		case ch <- v:
+		default:
+			logDebugf("Dropped link event for %s", v)
+		}
+	}
+}
+
+func sendIP(subs []chan net.IP, ip net.IP) {
+	for _, ch := range subs {
+		select {
+		case ch <- ip:
+		default:
+			logDebugf("Dropped link event for %s", ip)
+		}
+	}
+}
+
+// ifaceFollower shows the module built for the primary interface, switching
+// to a new one whenever another interface comes up. Modules keep running
+// once started, so that switching back, e.g. from a VPN, is instant.
+type ifaceFollower struct {
+	mon     *linkMonitor
+	build   func(iface string) bar.Module
+	mu      sync.Mutex
+	sink    bar.Sink
+	current string
+	last    map[string]bar.Output
+}
+
+func newIfaceFollower(mon *linkMonitor, build func(iface string) bar.Module) *ifaceFollower {
+	return &ifaceFollower{mon: mon, build: build, last: map[string]bar.Output{}}
+}
+
+// Stream shows the module for the current primary interface.
+func (f *ifaceFollower) Stream(s bar.Sink) {
+	f.mu.Lock()
+	f.sink = s
+	f.mu.Unlock()
+	f.follow(primaryInterface())
+	for iface := range f.mon.InterfaceUp() {
+		f.follow(iface)
+	}
+}
+
+func (f *ifaceFollower) follow(iface string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if iface == "" || iface == f.current {
+		return
+	}
+	f.current = iface
+	if _, ok := f.last[iface]; !ok {
+		f.last[iface] = nil
+		go f.build(iface).Stream(f.forward(iface))
+	}
+	if f.sink != nil {
+		f.sink.Output(f.last[iface])
+	}
+}
+
+// forward returns a sink that passes on the outputs of the module for
+// iface while it's the primary interface.
+func (f *ifaceFollower) forward(iface string) bar.Sink {
+	return func(o bar.Output) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.last[iface] = o
+		if f.current == iface && f.sink != nil {
+			f.sink.Output(o)
+		}
+	}
+}
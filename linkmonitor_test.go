@@ -0,0 +1,186 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/netlink"
+	"barista.run/outputs"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+// drainNames returns the names waiting on ch.
+func drainNames(ch <-chan string) []string {
+	var names []string
+	for {
+		select {
+		case n := <-ch:
+			names = append(names, n)
+		default:
+			return names
+		}
+	}
+}
+
+func drainIPs(ch <-chan net.IP) []string {
+	var ips []string
+	for {
+		select {
+		case ip := <-ch:
+			ips = append(ips, ip.String())
+		default:
+			return ips
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLinkMonitorDiff(t *testing.T) {
+	ip1, ip2, ip3 := net.ParseIP("10.0.0.2"), net.ParseIP("fe80::1"), net.ParseIP("10.8.0.5")
+	eth := netlink.Link{Name: "eth0", State: netlink.Up, IPs: []net.IP{ip1}}
+	ethMore := netlink.Link{Name: "eth0", State: netlink.Up, IPs: []net.IP{ip1, ip2}}
+	ethDown := netlink.Link{Name: "eth0", State: netlink.Down}
+	vpn := netlink.Link{Name: "wg0", State: netlink.Up, IPs: []net.IP{ip3}}
+	for _, tc := range []struct {
+		name                     string
+		prev, cur                netlink.Link
+		up, down, added, removed []string
+	}{
+		{"first link", netlink.Link{}, eth, []string{"eth0"}, nil, []string{"10.0.0.2"}, nil},
+		{"unchanged", eth, eth, nil, nil, nil, nil},
+		{"address added", eth, ethMore, nil, nil, []string{"fe80::1"}, nil},
+		{"address removed", ethMore, eth, nil, nil, nil, []string{"fe80::1"}},
+		{"went down", eth, ethDown, nil, []string{"eth0"}, nil, []string{"10.0.0.2"}},
+		{"came back", ethDown, eth, []string{"eth0"}, nil, []string{"10.0.0.2"}, nil},
+		{"vpn took over", eth, vpn, []string{"wg0"}, []string{"eth0"},
+			[]string{"10.8.0.5"}, []string{"10.0.0.2"}},
+		{"no link", eth, netlink.Link{}, nil, []string{"eth0"}, nil, []string{"10.0.0.2"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &linkMonitor{}
+			up, down := m.InterfaceUp(), m.InterfaceDown()
+			added, removed := m.AddressAdded(), m.AddressRemoved()
+			m.diff(tc.prev, tc.cur)
+			if got := drainNames(up); !equalStrings(got, tc.up) {
+				t.Errorf("up: got %v, want %v", got, tc.up)
+			}
+			if got := drainNames(down); !equalStrings(got, tc.down) {
+				t.Errorf("down: got %v, want %v", got, tc.down)
+			}
+			if got := drainIPs(added); !equalStrings(got, tc.added) {
+				t.Errorf("added: got %v, want %v", got, tc.added)
+			}
+			if got := drainIPs(removed); !equalStrings(got, tc.removed) {
+				t.Errorf("removed: got %v, want %v", got, tc.removed)
+			}
+		})
+	}
+}
+
+func TestLinkMonitorSubscribers(t *testing.T) {
+	m := &linkMonitor{}
+	// Nothing is sent, or dropped, without a subscriber.
+	m.diff(netlink.Link{}, netlink.Link{Name: "eth0", State: netlink.Up})
+
+	a, b := m.InterfaceUp(), m.InterfaceUp()
+	m.diff(netlink.Link{}, netlink.Link{Name: "wlan0", State: netlink.Up})
+	for i, ch := range []<-chan string{a, b} {
+		if got := drainNames(ch); !equalStrings(got, []string{"wlan0"}) {
+			t.Errorf("subscriber %d: got %v", i, got)
+		}
+	}
+
+	// A reader that falls behind loses events instead of blocking.
+	for i := 0; i < linkMonitorBuffer+3; i++ {
+		m.diff(netlink.Link{}, netlink.Link{Name: "eth0", State: netlink.Up})
+	}
+	if got := len(drainNames(a)); got != linkMonitorBuffer {
+		t.Errorf("got %d buffered events, want %d", got, linkMonitorBuffer)
+	}
+}
+
+func TestIfaceFollower(t *testing.T) {
+	var mu sync.Mutex
+	built := map[string]int{}
+	sinks := map[string]bar.Sink{}
+	ready := make(chan string, 4)
+	f := newIfaceFollower(&linkMonitor{}, func(iface string) bar.Module {
+		mu.Lock()
+		built[iface]++
+		mu.Unlock()
+		return moduleFunc(func(s bar.Sink) {
+			mu.Lock()
+			sinks[iface] = s
+			mu.Unlock()
+			ready <- iface
+		})
+	})
+	var got []bar.Output
+	f.sink = func(o bar.Output) { got = append(got, o) }
+	emit := func(iface, text string) {
+		mu.Lock()
+		s := sinks[iface]
+		mu.Unlock()
+		s.Output(outputs.Text(text))
+	}
+	waitReady := func(want string) {
+		select {
+		case iface := <-ready:
+			if iface != want {
+				t.Fatalf("started %s, want %s", iface, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("module for %s not started", want)
+		}
+	}
+
+	f.follow("eth0")
+	waitReady("eth0")
+	emit("eth0", "eth 1")
+	f.follow("wg0")
+	waitReady("wg0")
+	// Output from an interface that isn't primary is kept, not shown.
+	emit("eth0", "eth 2")
+	emit("wg0", "wg 1")
+	// Switching back shows the last output straight away.
+	f.follow("eth0")
+	f.follow("eth0")
+
+	var texts []string
+	for _, o := range got {
+		if o == nil {
+			texts = append(texts, "<nil>")
+			continue
+		}
+		texts = append(texts, baristatest.Text(o.Segments()[0]))
+	}
+	want := []string{"<nil>", "eth 1", "<nil>", "wg 1", "eth 2"}
+	if !equalStrings(texts, want) {
+		t.Errorf("got outputs %v, want %v", texts, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if built["eth0"] != 1 || built["wg0"] != 1 {
+		t.Errorf("modules built %v, want each once", built)
+	}
+}
+
+// moduleFunc is a module that calls the function to stream.
+type moduleFunc func(bar.Sink)
+
+func (f moduleFunc) Stream(s bar.Sink) { f(s) }
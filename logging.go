@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = map[logLevel]string{
+	levelDebug: "DEBUG",
+	levelInfo:  "INFO",
+	levelWarn:  "WARN",
+	levelError: "ERROR",
+}
+
+// verbose enables debug logging.
+var verbose = flag.Bool("v", false, "log debugging information")
+
+// logger writes to stderr, since stdout carries the i3bar protocol and any
+// stray output there breaks the bar.
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+func logf(level logLevel, format string, args ...interface{}) {
+	minLevel := levelInfo
+	if *verbose {
+		minLevel = levelDebug
+	}
+	if level < minLevel {
+		return
+	}
+	logger.Printf(levelNames[level]+" "+format, args...)
+}
+
+func logDebugf(format string, args ...interface{}) { logf(levelDebug, format, args...) }
+func logInfof(format string, args ...interface{})  { logf(levelInfo, format, args...) }
+func logWarnf(format string, args ...interface{})  { logf(levelWarn, format, args...) }
+func logErrorf(format string, args ...interface{}) { logf(levelError, format, args...) }
+
+// logFatalf logs an error and exits.
+func logFatalf(format string, args ...interface{}) {
+	logf(levelError, format, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// testModes stands in for the modal controller, recording the output each
+// mode was given.
+type testModes struct {
+	mu      sync.Mutex
+	current string
+	outputs map[string]bar.Output
+}
+
+func (m *testModes) Modes() []string { return nil }
+
+func (m *testModes) Current() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current
+}
+
+func (m *testModes) Activate(mode string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current = mode
+}
+
+func (m *testModes) Toggle(mode string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current == mode {
+		m.current = ""
+	} else {
+		m.current = mode
+	}
+}
+
+func (m *testModes) Reset() { m.Activate("") }
+
+func (m *testModes) SetOutput(mode string, out bar.Output) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outputs[mode] = out
+}
+
+// testColors are the scheme colours used by every test, so that colours in
+// golden files are stable.
+var testColors = map[string]string{
+	"bad":        "#ff5555",
+	"degraded":   "#ffb86c",
+	"good":       "#50fa7b",
+	"background": "#282a36",
+	"statusline": "#f8f8f2",
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	baristatest.FakeIcons("mdi", "fa")
+	updateTheme(func() { colors.LoadFromMap(testColors) })
+	mainModalController = &testModes{outputs: map[string]bar.Output{}}
+	// Times from Unix timestamps are shown in UTC wherever the tests run.
+	time.Local = time.UTC
+	os.Exit(m.Run())
+}
+
+// assertGolden compares got with testdata/name.golden, or rewrites the
+// file when run with -update.
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s:\ngot:\n%s\nwant:\n%s", name, path, got, want)
+	}
+}
+
+// restoreRefreshers removes the hooks registered with onRefresh during
+// the test once it finishes, so they don't run in later tests.
+func restoreRefreshers(t *testing.T) {
+	refreshMu.Lock()
+	saved := append([]func(){}, refreshers...)
+	refreshMu.Unlock()
+	t.Cleanup(func() {
+		refreshMu.Lock()
+		refreshers = saved
+		refreshMu.Unlock()
+	})
+}
+
+// writeTemp writes content to name in dir, returning its path.
+func writeTemp(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	mprisPrefix    = "org.mpris.MediaPlayer2."
+	mprisPath      = "/org/mpris/MediaPlayer2"
+	mprisPlayer    = "org.mpris.MediaPlayer2.Player"
+	mprisTrackList = "org.mpris.MediaPlayer2.TrackList"
+)
+
+type trackMeta struct {
+	Title  string
+	Artist string
+}
+
+type mediaQueueInfo struct {
+	Tracks []trackMeta
+}
+
+// mprisPlayers returns the bus names of all MPRIS players, with the
+// currently playing ones first.
+func mprisPlayers(conn *dbus.Conn) []string {
+	var names []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		return nil
+	}
+	var playing, others []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, mprisPrefix) {
+			continue
+		}
+		status, _ := conn.Object(name, mprisPath).GetProperty(mprisPlayer + ".PlaybackStatus")
+		if s, _ := status.Value().(string); s == "Playing" {
+			playing = append(playing, name)
+		} else {
+			others = append(others, name)
+		}
+	}
+	return append(playing, others...)
+}
+
+// mediaQueue returns up to n tracks following the current one in the
+// TrackList of the selected player, or the first allowed one if none is
+// selected. ok is false if there is no player, or the player does not
+// implement org.mpris.MediaPlayer2.TrackList.
+func mediaQueue(n int) (info mediaQueueInfo, ok bool) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return info, false
+	}
+	player := ""
+	if selected := selectedPlayer(); selected != "" {
+		player = mprisPrefix + selected
+	} else {
+		for _, name := range mprisPlayers(conn) {
+			if mediaPlayerAllowed(strings.TrimPrefix(name, mprisPrefix)) {
+				player = name
+				break
+			}
+		}
+	}
+	if player == "" {
+		return info, false
+	}
+	return queueFrom(conn.Object(player, mprisPath), n)
+}
+
+// queueFrom returns up to n tracks following the current one in the
+// TrackList of obj, a player's MPRIS object.
+func queueFrom(obj dbus.BusObject, n int) (info mediaQueueInfo, ok bool) {
+	tracksVar, err := obj.GetProperty(mprisTrackList + ".Tracks")
+	if err != nil {
+		return info, false
+	}
+	tracks, _ := tracksVar.Value().([]dbus.ObjectPath)
+	metaVar, err := obj.GetProperty(mprisPlayer + ".Metadata")
+	if err != nil {
+		return info, false
+	}
+	meta, _ := metaVar.Value().(map[string]dbus.Variant)
+	current, _ := meta["mpris:trackid"].Value().(dbus.ObjectPath)
+	upcoming := tracksAfter(tracks, current, n)
+	if len(upcoming) == 0 {
+		return info, true
+	}
+	var metas []map[string]dbus.Variant
+	err = obj.Call(mprisTrackList+".GetTracksMetadata", 0, upcoming).Store(&metas)
+	if err != nil {
+		return info, false
+	}
+	for _, m := range metas {
+		info.Tracks = append(info.Tracks, parseTrackMeta(m))
+	}
+	return info, true
+}
+
+// tracksAfter returns up to n track IDs following current. If current is not
+// in the list (e.g. the list changed since the metadata was read), the queue
+// starts from the beginning of the list.
+func tracksAfter(tracks []dbus.ObjectPath, current dbus.ObjectPath, n int) []dbus.ObjectPath {
+	start := 0
+	for i, t := range tracks {
+		if t == current {
+			start = i + 1
+			break
+		}
+	}
+	end := start + n
+	if end > len(tracks) {
+		end = len(tracks)
+	}
+	return tracks[start:end]
+}
+
+func parseTrackMeta(m map[string]dbus.Variant) trackMeta {
+	var t trackMeta
+	t.Title, _ = m["xesam:title"].Value().(string)
+	artists, _ := m["xesam:artist"].Value().([]string)
+	t.Artist = strings.Join(artists, ", ")
+	return t
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// overTheWire encodes body in a D-Bus message and decodes it again, so
+// that it has the types a real player's reply or call would have.
+func overTheWire(t *testing.T, msgType dbus.Type, body ...interface{}) (dbus.Signature, []interface{}) {
+	t.Helper()
+	msg := &dbus.Message{
+		Type: msgType,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldSignature: dbus.MakeVariant(dbus.SignatureOf(body...)),
+		},
+		Body: body,
+	}
+	if msgType == dbus.TypeMethodCall {
+		msg.Headers[dbus.FieldPath] = dbus.MakeVariant(dbus.ObjectPath(mprisPath))
+		msg.Headers[dbus.FieldInterface] = dbus.MakeVariant(mprisTrackList)
+		msg.Headers[dbus.FieldMember] = dbus.MakeVariant("GetTracksMetadata")
+	} else {
+		msg.Headers[dbus.FieldReplySerial] = dbus.MakeVariant(uint32(1))
+	}
+	var buf bytes.Buffer
+	if err := msg.EncodeTo(&buf, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := dbus.DecodeMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := decoded.Headers[dbus.FieldSignature].Value().(dbus.Signature)
+	return sig, decoded.Body
+}
+
+// fakeTrackList is a player's MPRIS object with a track list.
+type fakeTrackList struct {
+	dbus.BusObject
+	t           *testing.T
+	tracks      []dbus.ObjectPath
+	current     dbus.ObjectPath
+	titles      map[dbus.ObjectPath]string
+	noTrackList bool
+	// requested is the signature and tracks of the last GetTracksMetadata.
+	signature string
+	requested []dbus.ObjectPath
+}
+
+func (f *fakeTrackList) GetProperty(p string) (dbus.Variant, error) {
+	switch p {
+	case mprisTrackList + ".Tracks":
+		if f.noTrackList {
+			return dbus.Variant{}, errors.New("org.freedesktop.DBus.Error.UnknownInterface")
+		}
+		return dbus.MakeVariant(f.tracks), nil
+	case mprisPlayer + ".Metadata":
+		return dbus.MakeVariant(map[string]dbus.Variant{
+			"mpris:trackid": dbus.MakeVariant(f.current),
+		}), nil
+	}
+	return dbus.Variant{}, errors.New("unknown property " + p)
+}
+
+func (f *fakeTrackList) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	if method != mprisTrackList+".GetTracksMetadata" {
+		return &dbus.Call{Err: errors.New("unknown method " + method)}
+	}
+	sig, body := overTheWire(f.t, dbus.TypeMethodCall, args...)
+	f.signature = sig.String()
+	f.requested, _ = body[0].([]dbus.ObjectPath)
+	var metas []map[string]dbus.Variant
+	for _, id := range f.requested {
+		metas = append(metas, map[string]dbus.Variant{
+			"mpris:trackid": dbus.MakeVariant(id),
+			"xesam:title":   dbus.MakeVariant(f.titles[id]),
+			"xesam:artist":  dbus.MakeVariant([]string{"Portishead"}),
+		})
+	}
+	_, reply := overTheWire(f.t, dbus.TypeMethodReply, metas)
+	return &dbus.Call{Body: reply}
+}
+
+func TestQueueFrom(t *testing.T) {
+	f := &fakeTrackList{
+		t:       t,
+		tracks:  []dbus.ObjectPath{"/t/1", "/t/2", "/t/3", "/t/4"},
+		current: "/t/1",
+		titles:  map[dbus.ObjectPath]string{"/t/1": "Mysterons", "/t/2": "Sour Times", "/t/3": "Strangers", "/t/4": "It Could Be Sweet", "/t/9": "Roads"},
+	}
+	queue := func(n int) []trackMeta {
+		t.Helper()
+		info, ok := queueFrom(f, n)
+		if !ok {
+			t.Fatal("no queue")
+		}
+		return info.Tracks
+	}
+
+	got := queue(2)
+	want := []trackMeta{{"Sour Times", "Portishead"}, {"Strangers", "Portishead"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if f.signature != "ao" || !reflect.DeepEqual(f.requested, []dbus.ObjectPath{"/t/2", "/t/3"}) {
+		t.Errorf("called GetTracksMetadata(%s) with %v", f.signature, f.requested)
+	}
+
+	// Only the tracks that are left.
+	f.current = "/t/3"
+	if got := queue(5); len(got) != 1 || got[0].Title != "It Could Be Sweet" {
+		t.Errorf("near the end: got %+v", got)
+	}
+	f.current, f.requested = "/t/4", nil
+	if got := queue(2); len(got) != 0 || f.requested != nil {
+		t.Errorf("at the end: got %+v, requested %v", got, f.requested)
+	}
+
+	// The list changes between refreshes: a track is added after the
+	// current one, then the current one is removed.
+	f.current = "/t/2"
+	f.tracks = []dbus.ObjectPath{"/t/1", "/t/2", "/t/9", "/t/3", "/t/4"}
+	if got := queue(1); len(got) != 1 || got[0].Title != "Roads" {
+		t.Errorf("after adding a track: got %+v", got)
+	}
+	f.tracks = []dbus.ObjectPath{"/t/9", "/t/3", "/t/4"}
+	if got := queue(1); len(got) != 1 || got[0].Title != "Roads" {
+		t.Errorf("after removing the current track: got %+v, want the start of the list", got)
+	}
+
+	f.noTrackList = true
+	if info, ok := queueFrom(f, 2); ok {
+		t.Errorf("no TrackList: got %+v", info)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/modules/media"
+	"barista.run/modules/static"
+	"barista.run/outputs"
+	"barista.run/pango"
+	"github.com/godbus/dbus/v5"
+)
+
+// mediaSelectorInterval is how often the list of players is refreshed.
+const mediaSelectorInterval = 5 * time.Second
+
+var mediaSelectionMu sync.Mutex
+
+// selectedMediaPlayer is the player chosen in the source selector, without
+// mprisPrefix. Empty means the first allowed player.
+var selectedMediaPlayer string
+
+func selectedPlayer() string {
+	mediaSelectionMu.Lock()
+	defer mediaSelectionMu.Unlock()
+	return selectedMediaPlayer
+}
+
+type mediaPlayer struct {
+	Name   string
+	Status string
+}
+
+// mediaPlayers lists the MPRIS players on the session bus, with the
+// currently playing ones first.
+func mediaPlayers() []mediaPlayer {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil
+	}
+	var players []mediaPlayer
+	for _, name := range mprisPlayers(conn) {
+		status, _ := conn.Object(name, mprisPath).GetProperty(mprisPlayer + ".PlaybackStatus")
+		s, _ := status.Value().(string)
+		players = append(players, mediaPlayer{
+			Name:   strings.TrimPrefix(name, mprisPrefix),
+			Status: s,
+		})
+	}
+	return players
+}
+
+// mediaSource shows the selected player. With no player selected it
+// follows the first allowed player, preferring ones that are playing, and
+// shows nothing if mediaBlacklist and mediaWhitelist rule them all out.
+// Only the player being followed is watched, so that players that come
+// and go, e.g. browsers with a bus name for each instance, don't leave
+// anything running behind them.
+type mediaSource struct {
+	format func(mprisInfo) bar.Output
+	// watch is watchMpris, replaced in tests.
+	watch   func(player string, update func(mprisInfo), stop <-chan struct{})
+	mu      sync.Mutex
+	sink    bar.Sink
+	current string
+	stop    chan struct{}
+	last    bar.Output
+}
+
+func newMediaSource(format func(mprisInfo) bar.Output) *mediaSource {
+	return &mediaSource{format: format, watch: watchMpris}
+}
+
+// Stream shows the selected player, and otherwise checks for the player
+// to follow every mediaSelectorInterval.
+func (m *mediaSource) Stream(s bar.Sink) {
+	m.mu.Lock()
+	m.sink = s
+	s.Output(m.last)
+	m.mu.Unlock()
+	for {
+		m.follow(selectedPlayer())
+		time.Sleep(mediaSelectorInterval)
+	}
+}
+
+// follow switches the output to player, or to the first allowed player if
+// it is empty, and stops watching the one it followed before.
+func (m *mediaSource) follow(player string) {
+	if player == "" {
+		for _, p := range mediaPlayers() {
+			if mediaPlayerAllowed(p.Name) {
+				player = p.Name
+				break
+			}
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current == player {
+		return
+	}
+	m.current = player
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	m.show(nil)
+	if player == "" {
+		return
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	go m.watch(player, func(info mprisInfo) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// Updates that race with switching away are dropped.
+		if m.stop == stop {
+			m.show(m.format(info))
+		}
+	}, stop)
+}
+
+// show sets the output, with m.mu held.
+func (m *mediaSource) show(o bar.Output) {
+	m.last = o
+	if m.sink != nil {
+		m.sink.Output(o)
+	}
+}
+
+// mediaSelector lists the MPRIS players when more than one is connected,
+// and selects the one the media source follows when it's clicked. The
+// selection is dropped once that player disconnects.
+type mediaSelector struct {
+	source *mediaSource
+	out    *static.Module
+}
+
+func newMediaSelector(source *mediaSource) *mediaSelector {
+	return &mediaSelector{source: source, out: static.New(nil)}
+}
+
+// Stream refreshes the list of players periodically.
+func (s *mediaSelector) Stream(sink bar.Sink) {
+	go func() {
+		for {
+			s.update()
+			time.Sleep(mediaSelectorInterval)
+		}
+	}()
+	s.out.Stream(sink)
+}
+
+func (s *mediaSelector) selectPlayer(name string) {
+	mediaSelectionMu.Lock()
+	selectedMediaPlayer = name
+	mediaSelectionMu.Unlock()
+	s.source.follow(name)
+	s.update()
+}
+
+func (s *mediaSelector) update() {
+	players := mediaPlayers()
+	selected := selectedPlayer()
+	if selected != "" {
+		connected := false
+		for _, p := range players {
+			connected = connected || p.Name == selected
+		}
+		if !connected {
+			logInfof("Media player %s disconnected, following the active player", selected)
+			s.selectPlayer("")
+			return
+		}
+	}
+	if len(players) < 2 {
+		s.out.Set(nil)
+		return
+	}
+	out := outputs.Group()
+	for _, p := range players {
+		p := p
+		icon := "mdi-radiobox-blank"
+		if p.Name == selected {
+			icon = "mdi-radiobox-marked"
+		}
+		status := "mdi-stop"
+		switch p.Status {
+		case string(media.Playing):
+			status = "mdi-play"
+		case string(media.Paused):
+			status = "mdi-pause"
+		}
+		seg := outputs.Pango(
+			pango.Icon(icon), spacer,
+			pango.Text(p.Name), spacer,
+			pango.Icon(status).Alpha(0.8),
+		).OnClick(click.Left(func() {
+			if p.Name == selectedPlayer() {
+				// Clicking the selected player goes back to automatic.
+				s.selectPlayer("")
+			} else {
+				s.selectPlayer(p.Name)
+			}
+		}))
+		if p.Status != string(media.Playing) {
+			seg.Color(themeColor("degraded"))
+		}
+		out.Append(seg)
+	}
+	s.out.Set(out)
+}
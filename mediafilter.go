@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// mediaBlacklist are the players that are never followed automatically,
+// e.g. browsers playing notification sounds and videos. They can still be
+// picked in the media selector. Names are matched case-insensitively
+// against the MPRIS bus name without its prefix, either as globs like
+// "*chromium*", or as plain names that also match their instances, like
+// "chromium.instance1234".
+var mediaBlacklist = []string{"chromium", "firefox"}
+
+// mediaWhitelist, if not empty, limits the players followed automatically
+// to those it matches, in the same way as mediaBlacklist.
+var mediaWhitelist []string
+
+// mediaPlayerAllowed reports whether player can be followed automatically.
+func mediaPlayerAllowed(player string) bool {
+	if len(mediaWhitelist) > 0 && !matchesPlayer(mediaWhitelist, player) {
+		return false
+	}
+	return !matchesPlayer(mediaBlacklist, player)
+}
+
+func matchesPlayer(patterns []string, player string) bool {
+	player = strings.ToLower(player)
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if strings.ContainsAny(p, "*?[") {
+			if ok, _ := path.Match(p, player); ok {
+				return true
+			}
+			continue
+		}
+		if player == p || strings.HasPrefix(player, p+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchesPlayer(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		player   string
+		want     bool
+	}{
+		{[]string{"spotify"}, "spotify", true},
+		{[]string{"Spotify"}, "spotify", true},
+		{[]string{"spotify"}, "Spotify", true},
+		{[]string{"chromium"}, "chromium.instance1234", true},
+		{[]string{"chromium"}, "chromiumx", false},
+		{[]string{"chromium"}, "ungoogled.chromium", false},
+		{[]string{"*chromium*"}, "ungoogled.chromium", true},
+		{[]string{"*CHROMIUM*"}, "Chromium.instance1", true},
+		{[]string{"firefox.instance_?_*"}, "firefox.instance_1_42", true},
+		{[]string{"firefox.instance_?_*"}, "firefox.instance_12_42", false},
+		{[]string{"[mv]pv"}, "mpv", true},
+		{[]string{"mpv", "vlc"}, "vlc", true},
+		{nil, "vlc", false},
+	} {
+		if got := matchesPlayer(tc.patterns, tc.player); got != tc.want {
+			t.Errorf("matchesPlayer(%q, %q) = %v, want %v",
+				tc.patterns, tc.player, got, tc.want)
+		}
+	}
+}
+
+func TestMediaPlayerAllowed(t *testing.T) {
+	defer func(b, w []string) {
+		mediaBlacklist, mediaWhitelist = b, w
+	}(mediaBlacklist, mediaWhitelist)
+
+	players := []string{
+		"spotify",
+		"chromium.instance12",
+		"firefox.instance_1_42",
+		"mpv",
+		"vlc",
+		"VLC.instance7",
+	}
+	for _, tc := range []struct {
+		name      string
+		blacklist []string
+		whitelist []string
+		want      []string
+	}{
+		{
+			name: "nothing filtered",
+			want: players,
+		},
+		{
+			name:      "default blacklist",
+			blacklist: []string{"chromium", "firefox"},
+			want:      []string{"spotify", "mpv", "vlc", "VLC.instance7"},
+		},
+		{
+			name:      "blacklist glob",
+			blacklist: []string{"*i*", "*.*"},
+			want:      []string{"mpv", "vlc"},
+		},
+		{
+			name:      "whitelist",
+			whitelist: []string{"Spotify", "vlc"},
+			want:      []string{"spotify", "vlc", "VLC.instance7"},
+		},
+		{
+			name:      "whitelist and blacklist",
+			blacklist: []string{"vlc.*"},
+			whitelist: []string{"spotify", "vlc", "chromium"},
+			want:      []string{"spotify", "chromium.instance12", "vlc"},
+		},
+		{
+			name:      "whitelist glob",
+			whitelist: []string{"*v"},
+			want:      []string{"mpv"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mediaBlacklist, mediaWhitelist = tc.blacklist, tc.whitelist
+			var got []string
+			for _, p := range players {
+				if mediaPlayerAllowed(p) {
+					got = append(got, p)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("allowed %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"barista.run/modules/weather"
+	"github.com/martinlindhe/unit"
+)
+
+// metnoUserAgent identifies the bar to Met.no, whose terms require a
+// User-Agent with contact details. Set it to your own site or email.
+var metnoUserAgent = "crystal_barista github.com/chris-vest/crystal_barista"
+
+const metnoURL = "https://api.met.no/weatherapi/locationforecast/2.0/compact"
+
+type metnoResponse struct {
+	Properties struct {
+		Meta struct {
+			UpdatedAt time.Time `json:"updated_at"`
+		} `json:"meta"`
+		Timeseries []struct {
+			Time time.Time `json:"time"`
+			Data struct {
+				Instant struct {
+					Details struct {
+						AirPressureAtSeaLevel float64 `json:"air_pressure_at_sea_level"`
+						AirTemperature        float64 `json:"air_temperature"`
+						CloudAreaFraction     float64 `json:"cloud_area_fraction"`
+						RelativeHumidity      float64 `json:"relative_humidity"`
+						WindFromDirection     float64 `json:"wind_from_direction"`
+						WindSpeed             float64 `json:"wind_speed"`
+					} `json:"details"`
+				} `json:"instant"`
+				Next1Hours *struct {
+					Summary struct {
+						SymbolCode string `json:"symbol_code"`
+					} `json:"summary"`
+				} `json:"next_1_hours"`
+				Next6Hours *struct {
+					Summary struct {
+						SymbolCode string `json:"symbol_code"`
+					} `json:"summary"`
+				} `json:"next_6_hours"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"properties"`
+}
+
+// metnoCondition maps a Met.no symbol code, e.g. "lightrainshowers_day",
+// to a weather condition.
+func metnoCondition(symbol string) weather.Condition {
+	code := metnoBaseSymbol(symbol)
+	switch {
+	case strings.Contains(code, "thunder"):
+		return weather.Thunderstorm
+	case strings.Contains(code, "sleet"):
+		return weather.Sleet
+	case strings.Contains(code, "snow"):
+		return weather.Snow
+	case strings.HasPrefix(code, "lightrain"):
+		return weather.Drizzle
+	case strings.Contains(code, "rain"):
+		return weather.Rain
+	}
+	switch code {
+	case "clearsky":
+		return weather.Clear
+	case "fair", "partlycloudy":
+		return weather.PartlyCloudy
+	case "cloudy":
+		return weather.Cloudy
+	case "fog":
+		return weather.Fog
+	}
+	return weather.ConditionUnknown
+}
+
+// metnoBaseSymbol strips the time of day variant from a symbol code.
+func metnoBaseSymbol(symbol string) string {
+	if i := strings.Index(symbol, "_"); i >= 0 {
+		return symbol[:i]
+	}
+	return symbol
+}
+
+var metnoWords = []string{
+	"clear", "sky", "fair", "partly", "cloudy", "fog", "light", "heavy",
+	"rain", "sleet", "snow", "showers", "and", "thunder",
+}
+
+// metnoDescription spells out a symbol code, e.g. "light rain showers".
+func metnoDescription(symbol string) string {
+	code := metnoBaseSymbol(symbol)
+	var words []string
+	for code != "" {
+		found := false
+		for _, w := range metnoWords {
+			if strings.HasPrefix(code, w) {
+				words = append(words, w)
+				code = code[len(w):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			words = append(words, code)
+			break
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// metnoWeather converts the current conditions of a forecast.
+func metnoWeather(res metnoResponse) (weather.Weather, error) {
+	if len(res.Properties.Timeseries) == 0 {
+		return weather.Weather{}, errors.New("no forecast returned")
+	}
+	now := res.Properties.Timeseries[0].Data
+	d := now.Instant.Details
+	var symbol string
+	if now.Next1Hours != nil {
+		symbol = now.Next1Hours.Summary.SymbolCode
+	} else if now.Next6Hours != nil {
+		symbol = now.Next6Hours.Summary.SymbolCode
+	}
+	return weather.Weather{
+		Condition:   metnoCondition(symbol),
+		Description: metnoDescription(symbol),
+		Temperature: unit.FromCelsius(d.AirTemperature),
+		Humidity:    d.RelativeHumidity / 100,
+		Pressure:    unit.Pressure(d.AirPressureAtSeaLevel) * unit.Hectopascal,
+		Wind: weather.Wind{
+			Speed:     unit.Speed(d.WindSpeed) * unit.MetersPerSecond,
+			Direction: weather.Direction(d.WindFromDirection),
+		},
+		CloudCover:  d.CloudAreaFraction / 100,
+		Updated:     res.Properties.Meta.UpdatedAt,
+		Attribution: "Met.no",
+	}, nil
+}
+
+// metnoGetWeather fetches the current conditions at the given coordinates
+// from Met.no's free Locationforecast API.
+func metnoGetWeather(ctx context.Context, lat, lng float64) (weather.Weather, error) {
+	// Met.no asks for no more than 4 decimals, to improve caching.
+	req, err := http.NewRequestWithContext(ctx, "GET",
+		fmt.Sprintf("%s?lat=%.4f&lon=%.4f", metnoURL, lat, lng), nil)
+	if err != nil {
+		return weather.Weather{}, err
+	}
+	req.Header.Set("User-Agent", metnoUserAgent)
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return weather.Weather{}, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus("met.no", resp); err != nil {
+		return weather.Weather{}, err
+	}
+	var res metnoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return weather.Weather{}, err
+	}
+	return metnoWeather(res)
+}
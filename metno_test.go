@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barista.run/modules/weather"
+	"github.com/martinlindhe/unit"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+func TestMetnoFixture(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "metno.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res metnoResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+	w, err := metnoWeather(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	if w.Condition != weather.Drizzle || w.Description != "light rain showers" {
+		t.Errorf("got %v, %q from lightrainshowers_day", w.Condition, w.Description)
+	}
+	if !near(w.Temperature.Celsius(), 7.3) {
+		t.Errorf("temperature %v°C, want 7.3", w.Temperature.Celsius())
+	}
+	if !near(w.Wind.Speed.KilometersPerHour(), 19.8) || w.Wind.Direction != 214 {
+		t.Errorf("wind %v km/h from %v, want 19.8 km/h from 214", w.Wind.Speed.KilometersPerHour(), w.Wind.Direction)
+	}
+	if !near(w.Humidity, 0.872) || !near(w.CloudCover, 0.961) {
+		t.Errorf("humidity %v, cloud cover %v", w.Humidity, w.CloudCover)
+	}
+	if hPa := float64(w.Pressure / unit.Hectopascal); !near(hPa, 1003.4) {
+		t.Errorf("pressure %v hPa", hPa)
+	}
+	if got := w.Updated.Format(time.RFC3339); got != "2026-10-17T08:41:17Z" {
+		t.Errorf("updated %s", got)
+	}
+	assertGolden(t, "metno", baristatest.Dump(weatherOutput(w, 0, true, res.Properties.Timeseries[0].Time)))
+
+	// Without a 1 hour summary, the 6 hour one is used.
+	res.Properties.Timeseries[0].Data.Next1Hours = nil
+	if w, _ := metnoWeather(res); w.Condition != weather.Rain {
+		t.Errorf("from rainshowers_day: got %v", w.Condition)
+	}
+	res.Properties.Timeseries = nil
+	if _, err := metnoWeather(res); err == nil {
+		t.Error("no error without a forecast")
+	}
+}
+
+func TestMetnoCondition(t *testing.T) {
+	for symbol, want := range map[string]weather.Condition{
+		"clearsky_day":                 weather.Clear,
+		"clearsky_polartwilight":       weather.Clear,
+		"fair_night":                   weather.PartlyCloudy,
+		"partlycloudy_day":             weather.PartlyCloudy,
+		"cloudy":                       weather.Cloudy,
+		"fog":                          weather.Fog,
+		"lightrain":                    weather.Drizzle,
+		"lightrainshowers_day":         weather.Drizzle,
+		"rain":                         weather.Rain,
+		"heavyrainshowers_night":       weather.Rain,
+		"lightsleet":                   weather.Sleet,
+		"heavysnowshowers_day":         weather.Snow,
+		"rainandthunder":               weather.Thunderstorm,
+		"lightssleetshowersandthunder": weather.Thunderstorm,
+		"":                             weather.ConditionUnknown,
+		"meteorshower":                 weather.ConditionUnknown,
+	} {
+		if got := metnoCondition(symbol); got != want {
+			t.Errorf("metnoCondition(%q) = %v, want %v", symbol, got, want)
+		}
+	}
+	if got := metnoDescription("heavysnowshowersandthunder_night"); got != "heavy snow showers and thunder" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/funcs"
+)
+
+// micPollInterval is how often the capture mute state is read, to pick up
+// changes made outside the bar.
+const micPollInterval = 3 * time.Second
+
+// amixerCaptureSwitch matches the capture switch state in `amixer get
+// Capture` output, e.g. "Front Left: Capture 39 [60%] [12.00dB] [on]".
+var amixerCaptureSwitch = regexp.MustCompile(`\[(on|off)\]`)
+
+// micState reads whether the default capture device is muted, using
+// PulseAudio if it's running and ALSA otherwise. ok is false if neither
+// has a capture device.
+func micState() (muted, ok bool) {
+	if out, err := quickOutput("pactl", "get-source-mute", "@DEFAULT_SOURCE@"); err == nil {
+		// "Mute: yes" or "Mute: no".
+		return strings.TrimSpace(strings.TrimPrefix(string(out), "Mute:")) == "yes", true
+	}
+	out, err := quickOutput("amixer", "get", "Capture")
+	if err != nil {
+		return false, false
+	}
+	m := amixerCaptureSwitch.FindStringSubmatch(string(out))
+	if m == nil {
+		return false, false
+	}
+	return m[1] == "off", true
+}
+
+// toggleMic mutes or unmutes the default capture device.
+func toggleMic() {
+	err := quickRun("pactl", "set-source-mute", "@DEFAULT_SOURCE@", "toggle")
+	if err != nil {
+		err = quickRun("amixer", "-q", "set", "Capture", "toggle")
+	}
+	if err != nil {
+		logWarnf("Could not toggle microphone: %v", err)
+	}
+}
+
+// newMicModule shows whether the microphone is muted, toggling it on
+// left-click.
+func newMicModule() *funcs.RepeatingModule {
+	var m *funcs.RepeatingModule
+	m = pollEvery(micPollInterval, func(s bar.Sink) {
+		muted, ok := micState()
+		if !ok {
+			s.Output(nil)
+			return
+		}
+		s.Output(micOutput(muted, func() {
+			toggleMic()
+			m.Refresh()
+		}))
+	})
+	return m
+}
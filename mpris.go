@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"barista.run/modules/media"
+	"github.com/godbus/dbus/v5"
+)
+
+// mprisInfo is the state of an MPRIS player, as shown by the media source.
+type mprisInfo struct {
+	PlayerName     string
+	PlaybackStatus media.PlaybackStatus
+	Length         time.Duration
+	Title          string
+	Artist         string
+	Album          string
+	// position is the playback position as of updated.
+	position time.Duration
+	updated  time.Time
+}
+
+// Position returns the playback position, counting on from the last
+// update while the player is playing.
+func (i mprisInfo) Position() time.Duration {
+	if i.PlaybackStatus != media.Playing {
+		return i.position
+	}
+	return i.position + time.Since(i.updated)
+}
+
+// mprisInfoFrom builds the state of player from its
+// org.mpris.MediaPlayer2.Player properties, as read at now.
+func mprisInfoFrom(player string, props map[string]dbus.Variant, now time.Time) mprisInfo {
+	info := mprisInfo{PlayerName: player, updated: now}
+	if s, ok := props["PlaybackStatus"].Value().(string); ok {
+		info.PlaybackStatus = media.PlaybackStatus(s)
+	}
+	if p, ok := props["Position"].Value().(int64); ok {
+		info.position = time.Duration(p) * time.Microsecond
+	}
+	meta, _ := props["Metadata"].Value().(map[string]dbus.Variant)
+	info.Title, _ = meta["xesam:title"].Value().(string)
+	info.Album, _ = meta["xesam:album"].Value().(string)
+	if artists, ok := meta["xesam:artist"].Value().([]string); ok {
+		info.Artist = strings.Join(artists, ", ")
+	}
+	// Players disagree on the type of the length.
+	switch l := meta["mpris:length"].Value().(type) {
+	case int64:
+		info.Length = time.Duration(l) * time.Microsecond
+	case uint64:
+		info.Length = time.Duration(l) * time.Microsecond
+	}
+	return info
+}
+
+// watchMpris calls update with the state of player, without mprisPrefix,
+// and again whenever it changes, until stop is closed. A player that isn't
+// on the bus has an empty PlaybackStatus.
+func watchMpris(player string, update func(mprisInfo), stop <-chan struct{}) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		logWarnf("No session bus for media player %s: %v", player, err)
+		return
+	}
+	name := mprisPrefix + player
+	rules := [][]dbus.MatchOption{
+		{dbus.WithMatchSender(name), dbus.WithMatchObjectPath(mprisPath)},
+		{dbus.WithMatchMember("NameOwnerChanged"), dbus.WithMatchArg(0, name)},
+	}
+	for _, rule := range rules {
+		if err := conn.AddMatchSignal(rule...); err != nil {
+			logWarnf("Could not watch media player %s: %v", player, err)
+			return
+		}
+		defer conn.RemoveMatchSignal(rule...)
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	// Signals come from the unique name that owns the player's name.
+	var owner string
+	refresh := func() {
+		conn.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, name).Store(&owner)
+		props := map[string]dbus.Variant{}
+		err := conn.Object(name, mprisPath).
+			Call("org.freedesktop.DBus.Properties.GetAll", 0, mprisPlayer).Store(&props)
+		if err != nil {
+			owner = ""
+			update(mprisInfo{PlayerName: player})
+			return
+		}
+		update(mprisInfoFrom(player, props, time.Now()))
+	}
+	refresh()
+	for {
+		select {
+		case <-stop:
+			return
+		case sig := <-signals:
+			switch {
+			case sig.Name == "org.freedesktop.DBus.NameOwnerChanged":
+				if len(sig.Body) > 0 && sig.Body[0] == name {
+					refresh()
+				}
+			case sig.Sender == owner && sig.Path == mprisPath:
+				// PropertiesChanged, or Seeked after a jump in position.
+				refresh()
+			}
+		}
+	}
+}
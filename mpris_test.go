@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/media"
+	"barista.run/outputs"
+	"github.com/godbus/dbus/v5"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+func TestMprisInfoFrom(t *testing.T) {
+	now := time.Now()
+	props := map[string]dbus.Variant{
+		"PlaybackStatus": dbus.MakeVariant("Paused"),
+		"Position":       dbus.MakeVariant(int64(83 * time.Second / time.Microsecond)),
+		"Metadata": dbus.MakeVariant(map[string]dbus.Variant{
+			"xesam:title":  dbus.MakeVariant("Teardrop"),
+			"xesam:artist": dbus.MakeVariant([]string{"Massive Attack", "Elizabeth Fraser"}),
+			"xesam:album":  dbus.MakeVariant("Mezzanine"),
+			"mpris:length": dbus.MakeVariant(int64(330 * time.Second / time.Microsecond)),
+		}),
+	}
+	got := mprisInfoFrom("spotify", props, now)
+	want := mprisInfo{
+		PlayerName:     "spotify",
+		PlaybackStatus: media.Paused,
+		Length:         330 * time.Second,
+		Title:          "Teardrop",
+		Artist:         "Massive Attack, Elizabeth Fraser",
+		Album:          "Mezzanine",
+		position:       83 * time.Second,
+		updated:        now,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if p := got.Position(); p != 83*time.Second {
+		t.Errorf("paused at %v, want 1:23", p)
+	}
+
+	// Some players send the length unsigned, or leave fields out.
+	props = map[string]dbus.Variant{
+		"PlaybackStatus": dbus.MakeVariant("Playing"),
+		"Metadata": dbus.MakeVariant(map[string]dbus.Variant{
+			"mpris:length": dbus.MakeVariant(uint64(time.Minute / time.Microsecond)),
+		}),
+	}
+	got = mprisInfoFrom("mpv", props, now.Add(-10*time.Second))
+	if got.Length != time.Minute || got.Title != "" || got.Artist != "" {
+		t.Errorf("got %+v", got)
+	}
+	if p := got.Position(); p < 10*time.Second || p > 11*time.Second {
+		t.Errorf("playing for 10s from the start, at %v", p)
+	}
+	if got := mprisInfoFrom("gone", nil, now); got.PlaybackStatus != media.Disconnected {
+		t.Errorf("no properties: got %+v", got)
+	}
+}
+
+// fakeWatches records the players being watched by a media source.
+type fakeWatches struct {
+	mu      sync.Mutex
+	updates map[string]func(mprisInfo)
+	stopped map[string]<-chan struct{}
+}
+
+func (f *fakeWatches) watch(player string, update func(mprisInfo), stop <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates[player], f.stopped[player] = update, stop
+}
+
+func (f *fakeWatches) get(player string) (func(mprisInfo), <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.updates[player], f.stopped[player]
+}
+
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestMediaSourceStopsPreviousPlayer(t *testing.T) {
+	watches := &fakeWatches{updates: map[string]func(mprisInfo){}, stopped: map[string]<-chan struct{}{}}
+	src := newMediaSource(func(i mprisInfo) bar.Output { return outputs.Text(i.PlayerName + ": " + i.Title) })
+	src.watch = watches.watch
+	var mu sync.Mutex
+	var last bar.Output
+	src.sink = func(o bar.Output) {
+		mu.Lock()
+		defer mu.Unlock()
+		last = o
+	}
+	shown := func() bar.Output {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+	assertShown := func(want string) {
+		t.Helper()
+		if o := shown(); o == nil || baristatest.Text(o.Segments()[0]) != want {
+			t.Errorf("showing %v, want %q", o, want)
+		}
+	}
+	waitFor := func(player string) (func(mprisInfo), <-chan struct{}) {
+		t.Helper()
+		for end := time.Now().Add(time.Second); time.Now().Before(end); time.Sleep(time.Millisecond) {
+			if update, stop := watches.get(player); update != nil {
+				return update, stop
+			}
+		}
+		t.Fatalf("%s not watched", player)
+		return nil, nil
+	}
+
+	src.follow("spotify")
+	spotify, spotifyStop := waitFor("spotify")
+	spotify(mprisInfo{PlayerName: "spotify", Title: "Teardrop"})
+	assertShown("spotify: Teardrop")
+
+	src.follow("firefox.instance_1_42")
+	firefox, _ := waitFor("firefox.instance_1_42")
+	if !isClosed(spotifyStop) {
+		t.Error("still watching spotify after switching away")
+	}
+	if shown() != nil {
+		t.Error("spotify still shown before firefox reports")
+	}
+	spotify(mprisInfo{PlayerName: "spotify", Title: "Angel"})
+	if shown() != nil {
+		t.Error("late update from spotify shown")
+	}
+	firefox(mprisInfo{PlayerName: "firefox.instance_1_42", Title: "Video"})
+	assertShown("firefox.instance_1_42: Video")
+
+	// Going back to a player watches it afresh.
+	watches.mu.Lock()
+	delete(watches.updates, "spotify")
+	watches.mu.Unlock()
+	src.follow("spotify")
+	spotify, _ = waitFor("spotify")
+	if _, stop := watches.get("firefox.instance_1_42"); !isClosed(stop) {
+		t.Error("still watching firefox after switching away")
+	}
+	spotify(mprisInfo{PlayerName: "spotify", Title: "Angel"})
+	assertShown("spotify: Angel")
+}
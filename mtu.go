@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net"
+
+	"barista.run/bar"
+	"barista.run/modules/static"
+)
+
+// standardMTUs are the usual Ethernet and jumbo frame sizes. Anything else,
+// e.g. 1420 inside a WireGuard tunnel, is shown as degraded, since a wrong
+// MTU is a common cause of slow or stalled connections.
+var standardMTUs = []int{1500, 9000}
+
+type mtuInfo struct {
+	Interface string
+	MTU       int
+	Loopback  bool
+}
+
+// Standard returns whether the MTU is one of standardMTUs, or the
+// interface is loopback, which has its own large MTU.
+func (m mtuInfo) Standard() bool {
+	if m.Loopback {
+		return true
+	}
+	for _, s := range standardMTUs {
+		if m.MTU == s {
+			return true
+		}
+	}
+	return false
+}
+
+// mtuModule shows the MTU of the primary interface, following the link
+// monitor as the primary interface changes, e.g. when a VPN comes up, and
+// as the kernel reports a new MTU for it.
+type mtuModule struct {
+	mon *linkMonitor
+	out *static.Module
+}
+
+func newMTUModule(mon *linkMonitor) *mtuModule {
+	return &mtuModule{mon: mon, out: static.New(nil)}
+}
+
+// Stream shows the MTU.
+func (m *mtuModule) Stream(s bar.Sink) {
+	go m.watch()
+	m.out.Stream(s)
+}
+
+func (m *mtuModule) watch() {
+	ups, downs := m.mon.InterfaceUp(), m.mon.InterfaceDown()
+	changes := m.mon.LinkChanged()
+	current := primaryInterface()
+	m.out.Set(readMTU(current))
+	for {
+		select {
+		case iface := <-ups:
+			current = iface
+			m.out.Set(readMTU(current))
+		case iface := <-downs:
+			if iface == current {
+				current = ""
+				m.out.Set(nil)
+			}
+		case link := <-changes:
+			if link.Name == current {
+				m.out.Set(mtuOutput(mtuInfo{Interface: link.Name, MTU: link.MTU, Loopback: link.Loopback}))
+			}
+		}
+	}
+}
+
+// readMTU returns the output for iface's current MTU, for when it becomes
+// the primary interface without a change to the link itself.
+func readMTU(iface string) bar.Output {
+	if iface == "" {
+		return nil
+	}
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil
+	}
+	return mtuOutput(mtuInfo{
+		Interface: iface,
+		MTU:       ifi.MTU,
+		Loopback:  ifi.Flags&net.FlagLoopback != 0,
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/netlink"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+// newLinkMessage builds an RTM_NEWLINK message like the kernel's, with the
+// name and MTU attributes.
+func newLinkMessage(name string, mtu uint32, flags uint32) []byte {
+	align := func(n int) int { return (n + syscall.NLMSG_ALIGNTO - 1) &^ (syscall.NLMSG_ALIGNTO - 1) }
+	attr := func(typ uint16, value []byte) []byte {
+		b := make([]byte, align(syscall.SizeofRtAttr+len(value)))
+		nativeEndian.PutUint16(b[0:], uint16(syscall.SizeofRtAttr+len(value)))
+		nativeEndian.PutUint16(b[2:], typ)
+		copy(b[syscall.SizeofRtAttr:], value)
+		return b
+	}
+	mtuBytes := make([]byte, 4)
+	nativeEndian.PutUint32(mtuBytes, mtu)
+	body := make([]byte, syscall.SizeofIfInfomsg)
+	ifi := (*syscall.IfInfomsg)(unsafe.Pointer(&body[0]))
+	ifi.Family = syscall.AF_UNSPEC
+	ifi.Flags = flags
+	body = append(body, attr(syscall.IFLA_IFNAME, append([]byte(name), 0))...)
+	body = append(body, attr(syscall.IFLA_MTU, mtuBytes)...)
+	msg := make([]byte, syscall.NLMSG_HDRLEN, syscall.NLMSG_HDRLEN+len(body))
+	nativeEndian.PutUint32(msg[0:], uint32(syscall.NLMSG_HDRLEN+len(body)))
+	nativeEndian.PutUint16(msg[4:], syscall.RTM_NEWLINK)
+	return append(msg, body...)
+}
+
+func TestParseLinkMessages(t *testing.T) {
+	var buf []byte
+	buf = append(buf, newLinkMessage("lo", 65536, syscall.IFF_LOOPBACK|syscall.IFF_UP)...)
+	buf = append(buf, newLinkMessage("eth0", 1500, syscall.IFF_UP)...)
+	// Other messages in the same read are skipped.
+	other := newLinkMessage("gone0", 1500, 0)
+	nativeEndian.PutUint16(other[4:], syscall.RTM_DELLINK)
+	buf = append(buf, other...)
+	buf = append(buf, newLinkMessage("wg0", 1420, syscall.IFF_UP)...)
+
+	got := parseLinkMessages(buf)
+	want := []linkAttrs{
+		{Name: "lo", MTU: 65536, Loopback: true},
+		{Name: "eth0", MTU: 1500},
+		{Name: "wg0", MTU: 1420},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("link %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got := parseLinkMessages([]byte{1, 2, 3}); got != nil {
+		t.Errorf("truncated message parsed as %+v", got)
+	}
+}
+
+func TestMTUOutput(t *testing.T) {
+	for _, tc := range []struct {
+		info  mtuInfo
+		color string
+	}{
+		{mtuInfo{Interface: "lo", MTU: 65536, Loopback: true}, ""},
+		{mtuInfo{Interface: "eth0", MTU: 1500}, ""},
+		{mtuInfo{Interface: "eth0", MTU: 9000}, ""},
+		{mtuInfo{Interface: "wg0", MTU: 1420}, "degraded"},
+	} {
+		t.Run(tc.info.Interface, func(t *testing.T) {
+			baristatest.AssertOutput(t, mtuOutput, tc.info,
+				baristatest.SegmentText(0, "MTU "+strconv.Itoa(tc.info.MTU)),
+				baristatest.Color(0, schemeColor(tc.color)))
+		})
+	}
+}
+
+func TestMTUModuleFollowsLinkChanges(t *testing.T) {
+	mon := &linkMonitor{}
+	// No RTM_NEWLINK socket in tests; changes are sent by hand below.
+	mon.watchAttrs.Do(func() {})
+	outs := make(chan bar.Output, 10)
+	go newMTUModule(mon).Stream(func(o bar.Output) { outs <- o })
+	next := func() string {
+		select {
+		case o := <-outs:
+			if o == nil || len(o.Segments()) == 0 {
+				return "<nil>"
+			}
+			return baristatest.Text(o.Segments()[0])
+		case <-time.After(time.Second):
+			return "<timeout>"
+		}
+	}
+	// Skips the empty outputs from before there's a primary interface.
+	nextShown := func() string {
+		for {
+			if got := next(); got != "<nil>" {
+				return got
+			}
+		}
+	}
+	waitSubscribed := func() {
+		for i := 0; i < 1000; i++ {
+			mon.mu.Lock()
+			n := len(mon.changed)
+			mon.mu.Unlock()
+			if n > 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatal("module never subscribed")
+	}
+	waitSubscribed()
+	send := func(l linkAttrs) {
+		mon.mu.Lock()
+		defer mon.mu.Unlock()
+		for _, ch := range mon.changed {
+			ch <- l
+		}
+	}
+
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+	mon.diff(netlink.Link{}, netlink.Link{Name: "lo", State: netlink.Up})
+	if got, want := nextShown(), "MTU "+strconv.Itoa(lo.MTU); got != want {
+		t.Fatalf("after lo came up: got %q, want %q", got, want)
+	}
+	// Changes to other interfaces are ignored, the primary's are shown.
+	send(linkAttrs{Name: "eth0", MTU: 9000})
+	send(linkAttrs{Name: "lo", MTU: 1420, Loopback: true})
+	if got := nextShown(); got != "MTU 1420" {
+		t.Fatalf("after MTU change: %q", got)
+	}
+	mon.diff(netlink.Link{Name: "lo", State: netlink.Up}, netlink.Link{})
+	if got := next(); got != "<nil>" {
+		t.Fatalf("after lo went down: %q", got)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/martinlindhe/unit"
+)
+
+// netCumulativeFile persists transfer totals across restarts.
+var netCumulativeFile = home(".cache/barista/netcumulative.json")
+
+// netCumulativeSaveInterval limits how often totals are written to disk.
+const netCumulativeSaveInterval = time.Minute
+
+// readNetDevCounters returns the received and transmitted byte counters of
+// iface from /proc/net/dev.
+func readNetDevCounters(iface string) (rx, tx uint64, ok bool) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != iface {
+			continue
+		}
+		// Receive fields come first, then transmit, 8 of each.
+		fields := strings.Fields(parts[1])
+		if len(fields) < 9 {
+			return 0, 0, false
+		}
+		rx, rxErr := strconv.ParseUint(fields[0], 10, 64)
+		tx, txErr := strconv.ParseUint(fields[8], 10, 64)
+		return rx, tx, rxErr == nil && txErr == nil
+	}
+	return 0, 0, false
+}
+
+// counterDelta returns how much a counter has grown from last to cur. A
+// counter that goes backwards has either wrapped, if it was close to the
+// limit, or been reset (e.g. the interface was recreated), in which case
+// it has counted up from zero.
+func counterDelta(last, cur uint64) uint64 {
+	if cur >= last || last > math.MaxUint64/2 {
+		// Unsigned arithmetic handles the wrap.
+		return cur - last
+	}
+	return cur
+}
+
+// netCumulative counts the bytes transferred on an interface since it was
+// created, or since the start of the current period if period is set, e.g.
+// to track usage against a monthly cap.
+type netCumulative struct {
+	iface   string
+	period  func(time.Time) time.Time
+	read    func(iface string) (rx, tx uint64, ok bool)
+	mu      sync.Mutex
+	state   netCumulativeState
+	lastRx  uint64
+	lastTx  uint64
+	primed  bool
+	savedAt time.Time
+}
+
+type netCumulativeState struct {
+	Interface string    `json:"interface"`
+	Start     time.Time `json:"start"`
+	Rx        uint64    `json:"rx"`
+	Tx        uint64    `json:"tx"`
+}
+
+func newNetCumulative(iface string) *netCumulative {
+	return &netCumulative{
+		iface: iface,
+		read:  readNetDevCounters,
+		state: netCumulativeState{Interface: iface, Start: time.Now()},
+	}
+}
+
+// WithCumulativeReset counts from the start of the period containing the
+// current time, as returned by period, and starts from zero again whenever
+// a new period begins. Totals saved by a previous run in the same period
+// are picked up.
+func (n *netCumulative) WithCumulativeReset(period func(time.Time) time.Time) *netCumulative {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.period = period
+	n.state = netCumulativeState{Interface: n.iface, Start: period(time.Now())}
+	if saved, err := loadNetCumulative(netCumulativeFile); err == nil &&
+		saved.Interface == n.iface && saved.Start.Equal(n.state.Start) {
+		n.state = saved
+	}
+	return n
+}
+
+// monthStart is a period for WithCumulativeReset that starts at midnight on
+// the first of each month, e.g. for a monthly data cap.
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+func loadNetCumulative(path string) (netCumulativeState, error) {
+	var state netCumulativeState
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+func saveNetCumulative(path string, state netCumulativeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Update reads the interface counters and returns the totals so far.
+func (n *netCumulative) Update() (rx, tx unit.Datasize) {
+	return n.update(time.Now())
+}
+
+func (n *netCumulative) update(now time.Time) (rx, tx unit.Datasize) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.period != nil {
+		if start := n.period(now); start.After(n.state.Start) {
+			n.state.Start, n.state.Rx, n.state.Tx = start, 0, 0
+		}
+	}
+	if curRx, curTx, ok := n.read(n.iface); ok {
+		if n.primed {
+			n.state.Rx += counterDelta(n.lastRx, curRx)
+			n.state.Tx += counterDelta(n.lastTx, curTx)
+		}
+		n.lastRx, n.lastTx, n.primed = curRx, curTx, true
+	}
+	if now.Sub(n.savedAt) >= netCumulativeSaveInterval {
+		if err := saveNetCumulative(netCumulativeFile, n.state); err != nil {
+			logWarnf("Could not save network totals: %v", err)
+		}
+		n.savedAt = now
+	}
+	return unit.Datasize(n.state.Rx) * unit.Byte, unit.Datasize(n.state.Tx) * unit.Byte
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/martinlindhe/unit"
+)
+
+func TestCounterDelta(t *testing.T) {
+	for _, tc := range []struct{ last, cur, want uint64 }{
+		{100, 250, 150},
+		// Wrapped around.
+		{math.MaxUint64 - 9, 10, 20},
+		// Reset, e.g. the interface was recreated.
+		{5000, 300, 300},
+	} {
+		if got := counterDelta(tc.last, tc.cur); got != tc.want {
+			t.Errorf("counterDelta(%d, %d) = %d, want %d", tc.last, tc.cur, got, tc.want)
+		}
+	}
+}
+
+func TestNetCumulativeMonthRollover(t *testing.T) {
+	defer func(f string) { netCumulativeFile = f }(netCumulativeFile)
+	netCumulativeFile = filepath.Join(t.TempDir(), "netcumulative.json")
+
+	var rx, tx uint64
+	n := newNetCumulative("eth0").WithCumulativeReset(monthStart)
+	n.read = func(string) (uint64, uint64, bool) { return rx, tx, true }
+
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2021, month, d, 23, 59, 0, 0, time.Local)
+	}
+	check := func(now time.Time, wantRx, wantTx unit.Datasize) {
+		t.Helper()
+		gotRx, gotTx := n.update(now)
+		if gotRx != wantRx || gotTx != wantTx {
+			t.Errorf("at %v: got %v/%v, want %v/%v", now, gotRx, gotTx, wantRx, wantTx)
+		}
+	}
+	n.state.Start = monthStart(day(time.July, 1))
+	check(day(time.July, 30), 0, 0)
+	rx, tx = 1000, 100
+	check(day(time.July, 31), 1000*unit.Byte, 100*unit.Byte)
+
+	// A new month starts from zero. What was transferred since the last
+	// update counts towards it, since there's no telling when it was sent.
+	rx, tx = 1500, 300
+	check(day(time.August, 1), 500*unit.Byte, 200*unit.Byte)
+	if want := monthStart(day(time.August, 1)); !n.state.Start.Equal(want) {
+		t.Errorf("period starts %v, want %v", n.state.Start, want)
+	}
+	rx, tx = 1600, 400
+	check(day(time.August, 2), 600*unit.Byte, 300*unit.Byte)
+}
+
+func TestNetCumulativeResumesSavedPeriod(t *testing.T) {
+	defer func(f string) { netCumulativeFile = f }(netCumulativeFile)
+	netCumulativeFile = filepath.Join(t.TempDir(), "netcumulative.json")
+
+	thisMonth := monthStart(time.Now())
+	saved := netCumulativeState{Interface: "eth0", Start: thisMonth, Rx: 42, Tx: 7}
+	if err := saveNetCumulative(netCumulativeFile, saved); err != nil {
+		t.Fatal(err)
+	}
+	if n := newNetCumulative("eth0").WithCumulativeReset(monthStart); n.state.Rx != 42 || n.state.Tx != 7 {
+		t.Errorf("saved totals for this month not picked up: %+v", n.state)
+	}
+	if n := newNetCumulative("wlan0").WithCumulativeReset(monthStart); n.state.Rx != 0 {
+		t.Errorf("another interface's totals picked up: %+v", n.state)
+	}
+
+	saved.Start = thisMonth.AddDate(0, -1, 0)
+	if err := saveNetCumulative(netCumulativeFile, saved); err != nil {
+		t.Fatal(err)
+	}
+	if n := newNetCumulative("eth0").WithCumulativeReset(monthStart); n.state.Rx != 0 || !n.state.Start.Equal(thisMonth) {
+		t.Errorf("last month's totals picked up: %+v", n.state)
+	}
+}
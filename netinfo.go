@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// interfaceIconPrefixes maps interface name prefixes to icons, for when the
+// type can't be read from sysfs.
+var interfaceIconPrefixes = []struct{ Prefix, Icon string }{
+	{"eth", "mdi-ethernet"},
+	{"en", "mdi-ethernet"},
+	{"wl", "mdi-wifi"},
+	{"tun", "mdi-vpn"},
+	{"tap", "mdi-vpn"},
+	{"wg", "mdi-vpn"},
+	{"br", "mdi-server-network"},
+	{"lo", "mdi-laptop"},
+}
+
+// interfaceTypeIcon returns an icon for the type of the named interface,
+// based on sysfs where possible and the name otherwise.
+func interfaceTypeIcon(name string) string {
+	if icon := sysfsInterfaceIcon(filepath.Join("/sys/class/net", name)); icon != "" {
+		return icon
+	}
+	for _, p := range interfaceIconPrefixes {
+		if strings.HasPrefix(name, p.Prefix) {
+			return p.Icon
+		}
+	}
+	return "mdi-lan-pending"
+}
+
+func sysfsInterfaceIcon(dir string) string {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+	switch {
+	case exists("wireless"), exists("phy80211"):
+		return "mdi-wifi"
+	case exists("bridge"):
+		return "mdi-server-network"
+	case exists("tun_flags"):
+		return "mdi-vpn"
+	}
+	// ARPHRD_* values from if_arp.h.
+	switch readSysfsString(filepath.Join(dir, "type")) {
+	case "772": // ARPHRD_LOOPBACK
+		return "mdi-laptop"
+	case "65534": // ARPHRD_NONE, used by WireGuard.
+		return "mdi-vpn"
+	case "1": // ARPHRD_ETHER, but virtual devices (veth, docker) also use it.
+		if exists("device") {
+			return "mdi-ethernet"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	"barista.run/modules/netspeed"
+	"github.com/martinlindhe/unit"
+)
+
+// netSpeedMeter measures the speeds of an interface from its byte counters
+// in /proc/net/dev.
+type netSpeedMeter struct {
+	iface  string
+	read   func(iface string) (rx, tx uint64, ok bool)
+	last   time.Time
+	rx, tx uint64
+}
+
+func newNetSpeedMeter(iface string) *netSpeedMeter {
+	return &netSpeedMeter{iface: iface, read: readNetDevCounters}
+}
+
+// Update returns the average speeds since the last call. ok is false on
+// the first call, or if the counters can't be read.
+func (m *netSpeedMeter) Update(now time.Time) (s netspeed.Speeds, ok bool) {
+	rx, tx, ok := m.read(m.iface)
+	if !ok {
+		m.last = time.Time{}
+		return s, false
+	}
+	elapsed := now.Sub(m.last).Seconds()
+	ok = !m.last.IsZero() && elapsed > 0
+	if ok {
+		s.Rx = unit.Datarate(float64(counterDelta(m.rx, rx))/elapsed) * unit.BytePerSecond
+		s.Tx = unit.Datarate(float64(counterDelta(m.tx, tx))/elapsed) * unit.BytePerSecond
+	}
+	m.last, m.rx, m.tx = now, rx, tx
+	return s, ok
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNetSpeedMeter(t *testing.T) {
+	var rx, tx uint64 = 1000, 500
+	readable := true
+	m := newNetSpeedMeter("wlan0")
+	m.read = func(iface string) (uint64, uint64, bool) {
+		if iface != "wlan0" {
+			t.Errorf("read %s", iface)
+		}
+		return rx, tx, readable
+	}
+	start := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	if _, ok := m.Update(start); ok {
+		t.Error("speeds from a single reading")
+	}
+
+	rx, tx = 5000, 1500
+	s, ok := m.Update(start.Add(2 * time.Second))
+	if !ok || s.Rx.BytesPerSecond() != 2000 || s.Tx.BytesPerSecond() != 500 {
+		t.Errorf("got %v, %v, %v", s.Rx.BytesPerSecond(), s.Tx.BytesPerSecond(), ok)
+	}
+
+	// After a long gap, e.g. a suspend, it's the average over the gap.
+	rx = 5000 + 60000
+	s, ok = m.Update(start.Add(62 * time.Second))
+	if !ok || s.Rx.BytesPerSecond() != 1000 || s.Tx.BytesPerSecond() != 0 {
+		t.Errorf("after a minute: got %v, %v, %v", s.Rx.BytesPerSecond(), s.Tx.BytesPerSecond(), ok)
+	}
+
+	// Once the interface is gone it starts again from a fresh reading.
+	readable = false
+	if _, ok := m.Update(start.Add(64 * time.Second)); ok {
+		t.Error("speeds without counters")
+	}
+	readable, rx = true, 0
+	if _, ok := m.Update(start.Add(66 * time.Second)); ok {
+		t.Error("speeds from the reading before the interface went away")
+	}
+	rx = 4000
+	if s, ok := m.Update(start.Add(68 * time.Second)); !ok || s.Rx.BytesPerSecond() != 2000 {
+		t.Errorf("after coming back: got %v, %v", s.Rx.BytesPerSecond(), ok)
+	}
+}
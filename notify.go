@@ -0,0 +1,17 @@
+package main
+
+import "os/exec"
+
+// notify shows a desktop notification through notify-send.
+func notify(summary, body string, urgent bool) {
+	urgency := "normal"
+	if urgent {
+		urgency = "critical"
+	}
+	cmd := exec.Command("notify-send", "-u", urgency, "-a", "barista", summary, body)
+	if err := cmd.Start(); err != nil {
+		logWarnf("Could not send notification %q: %v", summary, err)
+		return
+	}
+	go cmd.Wait()
+}
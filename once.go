@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+
+	"barista.run/bar"
+	"github.com/chris-vest/crystal_barista/replay"
+)
+
+// renderOnce prints the first output of every module and exits, instead of
+// starting the bar.
+var renderOnce = flag.Bool("once", false,
+	"print the first output of each module as JSON, then exit")
+
+// onceTimeout is how long to wait for each module's first output.
+const onceTimeout = 5 * time.Second
+
+type namedModule struct {
+	Name   string
+	Module bar.Module
+	// Live modules compute rates between samples, so their first output
+	// isn't representative.
+	Live bool
+}
+
+type onceResult struct {
+	Name     string           `json:"name"`
+	Segments []replay.Segment `json:"segments,omitempty"`
+	Skipped  string           `json:"skipped,omitempty"`
+}
+
+// printOnce streams all modules at once, and prints a line of JSON with
+// each module's first output as it arrives.
+func printOnce(modules []namedModule) {
+	results := make(chan onceResult)
+	pending := 0
+	enc := json.NewEncoder(os.Stdout)
+	for _, m := range modules {
+		if m.Module == nil {
+			continue
+		}
+		if m.Live {
+			enc.Encode(onceResult{Name: m.Name, Skipped: "needs live data"})
+			continue
+		}
+		pending++
+		go func(m namedModule) {
+			first := make(chan bar.Output, 1)
+			go m.Module.Stream(func(out bar.Output) {
+				select {
+				case first <- out:
+				default:
+				}
+			})
+			select {
+			case out := <-first:
+				results <- onceResult{Name: m.Name, Segments: replay.Capture(out)}
+			case <-time.After(onceTimeout):
+				results <- onceResult{Name: m.Name, Skipped: "no output"}
+			}
+		}(m)
+	}
+	for ; pending > 0; pending-- {
+		enc.Encode(<-results)
+	}
+}
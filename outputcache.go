@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"barista.run/bar"
+)
+
+// themeGeneration changes whenever the colours do, so that cached outputs
+// built with the old colours are rebuilt.
+var themeGeneration int32
+
+func themeChanged() {
+	atomic.AddInt32(&themeGeneration, 1)
+}
+
+// outputCache remembers the output last built for a module and the input it
+// was built from. Polling modules mostly see the same input on every poll,
+// e.g. the kubectl context is checked every second but changes a few times
+// a day, so with the cache they skip both building the output and sending
+// it to the bar, which would otherwise parse the same pango markup again.
+// The display profile and colours are part of the key, since outputs depend
+// on both.
+type outputCache struct {
+	mu     sync.Mutex
+	key    outputCacheKey
+	output bar.Output
+	valid  bool
+}
+
+type outputCacheKey struct {
+	input   interface{}
+	compact bool
+	theme   int32
+}
+
+// Get returns the output for input, calling build only if the input has
+// changed since the last call. fresh is true if the output was rebuilt.
+func (c *outputCache) Get(input interface{}, build func() bar.Output) (out bar.Output, fresh bool) {
+	key := outputCacheKey{
+		input:   input,
+		compact: isCompact(),
+		theme:   atomic.LoadInt32(&themeGeneration),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.valid && reflect.DeepEqual(key, c.key) {
+		return c.output, false
+	}
+	c.key, c.output, c.valid = key, build(), true
+	return c.output, true
+}
+
+// Reset forgets the cached output, so that the next Get rebuilds it, e.g.
+// after something else was shown in its place.
+func (c *outputCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.valid = false
+}
@@ -0,0 +1,910 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/format"
+	"barista.run/modules/diskio"
+	"barista.run/modules/diskspace"
+	"barista.run/modules/meminfo"
+	"barista.run/modules/netinfo"
+	"barista.run/modules/netspeed"
+	"barista.run/modules/sysinfo"
+	"barista.run/modules/volume"
+	"barista.run/modules/wlan"
+	"barista.run/outputs"
+	"barista.run/pango"
+	"github.com/martinlindhe/unit"
+)
+
+// CLOCKS
+
+// localdateOutput opens a calendar on left click, and cycles through the
+// date presets on scroll.
+func localdateOutput(now time.Time) bar.Output {
+	onClick := func(e bar.Event) {
+		switch e.Button {
+		case bar.ButtonLeft:
+			launch("gsimplecal")
+		case bar.ScrollUp:
+			cycleDatePreset(1)
+		case bar.ScrollDown:
+			cycleDatePreset(-1)
+		}
+	}
+	if isCompact() {
+		return outputs.Text(formatDate(now, "Jan 2")).OnClick(onClick)
+	}
+	return outputs.Pango(
+		pango.Icon("mdi-calendar-today"),
+		spacer,
+		formatDate(now, dateFormat),
+	).OnClick(onClick)
+}
+
+// localtimeOutput toggles the timezones on left click, and shows the Unix
+// time for a few seconds on middle click.
+func localtimeOutput(now time.Time) bar.Output {
+	text := now.Format(timeFormat)
+	if showingUnixTime(now) {
+		text = fmt.Sprint(now.Unix())
+	}
+	return outputs.Text(text).
+		OnClick(func(e bar.Event) {
+			switch e.Button {
+			case bar.ButtonLeft:
+				mainModalController.Toggle("timezones")
+			case bar.ButtonMiddle:
+				showUnixTime()
+			}
+		})
+}
+
+func pomodoroOutput(running bool, remaining time.Duration, onClick func(bar.Event)) bar.Output {
+	if !running {
+		return outputs.Pango(pango.Icon("mdi-timer-play-outline")).OnClick(onClick)
+	}
+	out := outputs.Pango(pango.Icon("mdi-timer"), spacer, pango.Text(formatMediaTime(remaining))).
+		OnClick(onClick)
+	return threshold(out, thresholdConfig{Urgent: remaining <= time.Minute})
+}
+
+func pomodoroStopwatchOutput(i stopwatchInfo, onClick func(bar.Event)) bar.Output {
+	icon := "mdi-timer-pause-outline"
+	if i.Running {
+		icon = "mdi-timer-outline"
+	}
+	return outputs.Pango(pango.Icon(icon), spacer, pango.Text(formatMediaTime(i.Elapsed))).
+		OnClick(onClick)
+}
+
+func stopwatchOutput(i stopwatchInfo, ctl stopwatchController) bar.Output {
+	icon := "mdi-timer-sand-paused"
+	if i.Running {
+		icon = "mdi-timer-sand"
+	}
+	return outputs.Pango(pango.Icon(icon), spacer, pango.Text(formatMediaTime(i.Elapsed))).
+		OnClick(func(e bar.Event) {
+			switch e.Button {
+			case bar.ButtonLeft:
+				ctl.Toggle()
+			case bar.ButtonRight:
+				ctl.Reset()
+			}
+		})
+}
+
+func tzClockOutput(lbl string, now time.Time) bar.Output {
+	return outputs.Pango(pango.Text(lbl).Smaller(), spacer, now.Format(tzClockFormat))
+}
+
+func workDayOutput(b businessInfo) bar.Output {
+	switch b.Phase {
+	case "working":
+		return outputs.Pango(
+			pango.Icon("mdi-briefcase-clock-outline"), spacer,
+			pango.Textf("%s left", formatHoursMinutes(b.Remaining)),
+		)
+	case "after":
+		return outputs.Pango(
+			pango.Icon("mdi-briefcase-clock-outline"), spacer,
+			pango.Textf("+%s", formatHoursMinutes(b.Elapsed)),
+		).Urgent(true)
+	}
+	return outputs.Pango(
+		pango.Icon("mdi-briefcase-outline"), spacer,
+		pango.Textf("in %s", formatHoursMinutes(b.Remaining)),
+	)
+}
+
+// NETWORK
+
+func wifiOutput(i wlan.Info) bar.Output {
+	if !i.Connecting() && !i.Connected() {
+		return nil
+	}
+	if i.Connecting() {
+		return outputs.Pango(pango.Icon("mdi-wifi"), "...").
+			Color(themeColor("degraded"))
+	}
+	out := outputs.Group()
+	// First segment shown in summary mode only.
+	summary := pango.Icon("mdi-wifi")
+	if !isCompact() {
+		// summary.Append(spacer, pango.Text(truncate(i.SSID, -9)))
+		summary.Append(spacer, pango.Text(i.SSID))
+	}
+	out.Append(outputs.Pango(summary).OnClick(click.Left(func() {
+		mainModalController.Toggle("network")
+	})))
+	// Full name, frequency, bssid in detail mode
+	out.Append(outputs.Pango(
+		pango.Icon("mdi-wifi"),
+		spacer,
+		pango.Text(i.SSID),
+	))
+	out.Append(outputs.Textf(" %2.1f Ghz", i.Frequency.Gigahertz()))
+	out.Append(outputs.Pango(
+		pango.Icon("mdi-access-point"),
+		spacer,
+		pango.Text(i.AccessPointMAC),
+		spacer,
+		pango.Textf("(%s)", i.Name).Smaller(),
+	))
+	return out
+}
+
+// netspeedInfo is everything shown alongside the current speeds.
+type netspeedInfo struct {
+	netspeed.Speeds
+	Peak                 unit.Datarate
+	TxSamples, RxSamples []float64
+	TotalRx, TotalTx     unit.Datasize
+}
+
+func rateSparkline(samples []float64) *pango.Node {
+	_, hi := minMax(samples)
+	return pango.Text(sparkline(samples, 0, hi)).Smaller()
+}
+
+func netspeedOutput(s netspeedInfo, u rateUnit) bar.Output {
+	return outputs.Group(
+		outputs.Pango(
+			pango.Icon("mdi-upload"), pango.Textf("%9s", formatRate(s.Tx, u)),
+			pango.Text(" ").Small(),
+			pango.Icon("mdi-download"), pango.Textf("%9s", formatRate(s.Rx, u)),
+			pango.Text(" ").Small(),
+			pango.Textf("(peak %s)", formatRate(s.Peak, u)).Smaller(),
+		),
+		outputs.Pango(
+			pango.Icon("mdi-upload").Alpha(0.6), rateSparkline(s.TxSamples),
+			pango.Text(" ").Small(),
+			pango.Icon("mdi-download").Alpha(0.6), rateSparkline(s.RxSamples),
+		),
+		outputs.Pango(
+			pango.Icon("mdi-sigma").Alpha(0.6),
+			pango.Icon("mdi-upload").Alpha(0.6), pango.Text(format.Bytesize(s.TotalTx)).Smaller(),
+			pango.Text(" ").Small(),
+			pango.Icon("mdi-download").Alpha(0.6), pango.Text(format.Bytesize(s.TotalRx)).Smaller(),
+		),
+	)
+}
+
+// captivePortalOutput warns about a captive portal, opening its login page
+// on left click and checking again on right click.
+func captivePortalOutput(p captivePortalInfo, recheck func()) bar.Output {
+	if !p.Detected {
+		return nil
+	}
+	return outputs.Pango(pango.Icon("mdi-web-box"), spacer, pango.Text("Portal")).
+		Color(themeColor("degraded")).
+		OnClick(func(e bar.Event) {
+			switch e.Button {
+			case bar.ButtonLeft:
+				openURL(p.URL)
+			case bar.ButtonRight:
+				recheck()
+			}
+		})
+}
+
+// pingOutput shows the latency to the ping host, and the recent packet
+// loss in a second segment for the detail.
+func pingOutput(p pingInfo) bar.Output {
+	if !p.Reachable {
+		return outputs.Pango(pango.Icon("mdi-lan-disconnect"), spacer, pango.Text(p.Host)).
+			Color(themeColor("degraded"))
+	}
+	latency := threshold(outputs.Pango(
+		pango.Icon("mdi-lan-connect"), spacer,
+		pango.Textf("%d", p.RTT.Milliseconds()), pango.Text("ms").Smaller(),
+	), thresholdConfig{
+		Bad:      p.Loss > 0 || p.RTT > 200*time.Millisecond,
+		Degraded: p.RTT > 80*time.Millisecond,
+	})
+	loss := threshold(outputs.Textf("%.0f%% loss", p.Loss*100), thresholdConfig{
+		Bad: p.Loss > 0,
+	})
+	return outputs.Group(latency, loss)
+}
+
+// dnsOutput shows whether DNS is working, with the lookup time in a second
+// segment for the detail.
+func dnsOutput(d dnsInfo) bar.Output {
+	if !d.OK {
+		return outputs.Pango(pango.Icon("mdi-dns"), spacer, pango.Text("DNS")).
+			Color(themeColor("bad"))
+	}
+	return outputs.Group(
+		outputs.Pango(pango.Icon("mdi-dns")).Color(themeColor("good")),
+		outputs.Pango(
+			pango.Text(d.Host).Smaller(), spacer,
+			pango.Textf("%d", d.Latency.Milliseconds()), pango.Text("ms").Smaller(),
+		),
+	)
+}
+
+// dhcpOutput warns when the lease is within an hour of expiring, or has
+// expired, renewing it on click.
+func dhcpOutput(lease dhcpInfo, now time.Time) bar.Output {
+	remaining := lease.Expiry.Sub(now)
+	if remaining > time.Hour {
+		return nil
+	}
+	icon := "mdi-clock-alert-outline"
+	if lease.Renewing {
+		icon = "mdi-autorenew"
+	}
+	text := pango.Textf("DHCP %d:%02d", int(remaining.Hours()), int(remaining.Minutes())%60)
+	if remaining <= 0 {
+		text = pango.Text("DHCP expired")
+	}
+	out := outputs.Pango(pango.Icon(icon), spacer, text).
+		OnClick(click.Left(func() { renewDHCPLease(lease.Interface) }))
+	return threshold(out, thresholdConfig{
+		Urgent:   remaining < 10*time.Minute,
+		Degraded: true,
+	})
+}
+
+func mtuOutput(m mtuInfo) bar.Output {
+	out := outputs.Pango(
+		pango.Text("MTU").Smaller(), spacer,
+		pango.Textf("%d", m.MTU),
+	)
+	return threshold(out, thresholdConfig{Degraded: !m.Standard()})
+}
+
+func netinfoOutput(i netinfo.State) bar.Output {
+	if !i.Enabled() {
+		return nil
+	}
+	name := pango.Icon(interfaceTypeIcon(i.Name)).
+		Concat(spacer).
+		ConcatText(i.Name)
+	if i.Connecting() || len(i.IPs) < 1 {
+		return outputs.Pango(name).Color(themeColor("degraded"))
+	}
+	return outputs.Group(outputs.Pango(name), outputs.Textf("%s", i.IPs[0]))
+}
+
+// MEDIA
+
+func volumeOutput(v volume.Volume) bar.Output {
+	onClick := volumeClickHandler(v, volumeScrollStep, volumeMuteOnScrollToZero)
+	if v.Mute {
+		return outputs.
+			Pango(pango.Icon("mdi-volume-off")).
+			Color(themeColor("degraded")).
+			OnClick(onClick)
+	}
+	iconName := "mute"
+	pct := v.Pct()
+	if pct > 66 {
+		iconName = "high"
+	} else if pct > 33 {
+		iconName = "low"
+	}
+	if isCompact() {
+		return outputs.Pango(pango.Icon("mdi-volume-" + iconName)).OnClick(onClick)
+	}
+	return outputs.Pango(
+		pango.Icon("mdi-volume-"+iconName),
+		spacer,
+		pango.Textf("%2d%%", pct),
+	).OnClick(onClick)
+}
+
+func appVolumeOutput(apps []appVolume) bar.Output {
+	out := outputs.Group()
+	for _, a := range apps {
+		onClick := volumeControlClickHandler(a, a.Vol, 0, paVolumeNorm, a.Mute,
+			volumeScrollStep, volumeMuteOnScrollToZero)
+		name := a.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", a.Index)
+		}
+		seg := outputs.Pango(
+			pango.Text(truncate(name, 15)).Smaller(), spacer,
+			pango.Textf("%d%%", a.Pct()),
+		).OnClick(onClick)
+		if a.Mute {
+			seg.Color(themeColor("degraded"))
+		}
+		out.Append(seg)
+	}
+	return out
+}
+
+func equalizerOutput(info equalizerInfo, next func()) bar.Output {
+	name := info.Preset
+	if name == "" {
+		name = "EQ"
+	}
+	out := outputs.Pango(pango.Icon("mdi-equalizer"), spacer, pango.Text(truncate(name, 20))).
+		OnClick(click.Left(next))
+	if !info.Enabled {
+		out.Color(themeColor("degraded"))
+	}
+	return out
+}
+
+func micOutput(muted bool, toggle func()) bar.Output {
+	if muted {
+		return outputs.Pango(pango.Icon("mdi-microphone-off")).
+			Color(themeColor("degraded")).
+			OnClick(click.Left(toggle))
+	}
+	return outputs.Pango(pango.Icon("mdi-microphone")).OnClick(click.Left(toggle))
+}
+
+func mediaUpNextOutput(q mediaQueueInfo) bar.Output {
+	if len(q.Tracks) == 0 {
+		return nil
+	}
+	out := outputs.Group()
+	for _, t := range q.Tracks {
+		title := truncate(t.Title, 35)
+		if t.Artist != "" {
+			title = truncate(t.Artist, 20) + " - " + title
+		}
+		out.Append(outputs.Pango(
+			pango.Icon("mdi-playlist-music").Alpha(0.8), spacer,
+			pango.Text(title).Smaller(),
+		))
+	}
+	return out
+}
+
+// WEATHER
+
+func aqiOutput(aqi aqiInfo) bar.Output {
+	out := pango.Icon("mdi-air-filter").
+		Concat(spacer).
+		ConcatTextf("AQI %d", aqi.Index)
+	if aqi.Dominant != "" {
+		out.Append(spacer, pango.Text(aqi.Dominant).Smaller())
+	}
+	return outputs.Pango(out).Color(aqi.Color())
+}
+
+// KUBERNETES
+
+func kubeContextOutput(context string) bar.Output {
+	out := pango.Icon("mdi-ship-wheel")
+	if !isCompact() {
+		out.Append(spacer, pango.Text(context))
+	}
+	return outputs.Pango(out).OnClick(click.Left(func() {
+		mainModalController.Toggle("kubeContext")
+	}))
+}
+
+func kubeNsOutput(ns string) bar.Output {
+	if ns == "" {
+		ns = "default"
+	}
+	return outputs.Pango(pango.Textf("Namespace: %s", ns))
+}
+
+func kubeErrorOutput(err error) bar.Output {
+	return outputs.Pango(
+		pango.Icon("mdi-alert"), spacer,
+		pango.Text(truncate(err.Error(), 20)),
+	).Color(themeColor("degraded"))
+}
+
+// SYSINFO
+
+// cgroupMemOutput shows the memory pressure of a cgroup over the last 10s,
+// with the longer averages in the smaller text.
+func cgroupMemOutput(p psiInfo) bar.Output {
+	pt := thresholds.Pressure
+	return threshold(outputs.Pango(
+		pango.Icon("mdi-package-variant"), spacer,
+		pango.Text(filepath.Base(p.Path)).Smaller(), spacer,
+		pango.Textf("%.0f%%", p.Some.Avg10),
+		pango.Textf(" %.0f/%.0f%%", p.Some.Avg60, p.Full.Avg10).Smaller(),
+	), bandThreshold(p.Some.Avg10,
+		band{pt.Degraded, ""},
+		band{pt.Bad, "degraded"},
+		band{pt.Urgent, "bad"},
+		band{above, "urgent"},
+	))
+}
+
+// coreHeatmapOutput shows a block per core, from green when idle to red
+// when busy.
+func coreHeatmapOutput(usage []float64) bar.Output {
+	out := pango.Icon("mdi-chip").Concat(spacer)
+	for _, u := range usage {
+		block := pango.Text(" ")
+		if c := heatColor(u); c != nil {
+			block.Background(c)
+		}
+		out.Append(block)
+	}
+	return outputs.Pango(out)
+}
+
+// heatColor blends from the good colour at 0 to the bad colour at 1, or
+// returns nil if the scheme lacks either.
+func heatColor(frac float64) color.Color {
+	if frac < 0 {
+		frac = 0
+	}
+	if frac > 1 {
+		frac = 1
+	}
+	from, to := themeColor("good"), themeColor("bad")
+	if from == nil || to == nil {
+		return nil
+	}
+	fr, fg, fb, _ := from.RGBA()
+	tr, tg, tb, _ := to.RGBA()
+	blend := func(a, b uint32) uint16 {
+		return uint16(float64(a) + (float64(b)-float64(a))*frac)
+	}
+	return color.RGBA64{blend(fr, tr), blend(fg, tg), blend(fb, tb), 0xFFFF}
+}
+
+// loadTrendMargin is how far apart the 1 and 5 minute loads must be, as a
+// fraction of the 5 minute load, to count as rising or falling.
+const loadTrendMargin = 0.1
+
+// loadTrend returns an arrow showing whether the load is rising, falling or
+// steady, by comparing the 1 minute load to the 5 minute load.
+func loadTrend(s sysinfo.Info) *pango.Node {
+	diff := s.Loads[0] - s.Loads[1]
+	margin := s.Loads[1] * loadTrendMargin
+	switch {
+	case diff > margin:
+		return pango.Text("↑").Color(themeColor("degraded"))
+	case diff < -margin:
+		return pango.Text("↓").Color(themeColor("good"))
+	}
+	return pango.Text("→").Alpha(0.6)
+}
+
+func loadAvgOutput(s sysinfo.Info, procs loadavgInfo, numCPU int) bar.Output {
+	load := pango.Icon("mdi-desktop-tower")
+	if !isCompact() {
+		load.Append(spacer, pango.Textf("%0.2f", s.Loads[0]), loadTrend(s))
+	}
+	out := outputs.Pango(load)
+	// Load averages are unusually high for a few minutes after boot.
+	if s.Uptime < 10*time.Minute {
+		// so don't add colours until 10 minutes after system start.
+		return out
+	}
+	perCPU := s.Loads[0] / float64(numCPU)
+	// Many more runnable processes than cores means work is queueing.
+	l := thresholds.Load
+	c := bandThreshold(perCPU,
+		band{l.Good, "good"},
+		band{l.Degraded, ""},
+		band{l.Bad, "degraded"},
+		band{l.Urgent, "bad"},
+		band{above, "urgent"},
+	)
+	c.Urgent = c.Urgent || procs.RunningProcesses > 4*numCPU
+	threshold(out, c)
+	out.OnClick(click.Left(func() {
+		mainModalController.Toggle("sysinfo")
+	}))
+	return out
+}
+
+// loadAvgDetailOutput shows the longer term loads, and the process counts
+// if procsOK is set.
+func loadAvgDetailOutput(s sysinfo.Info, procs loadavgInfo, procsOK bool) bar.Output {
+	loads := pango.Textf("%0.2f %0.2f", s.Loads[1], s.Loads[2]).Smaller()
+	if !procsOK {
+		return loads
+	}
+	return outputs.Group(loads, outputs.Pango(
+		pango.Icon("mdi-cogs").Alpha(0.8), spacer,
+		pango.Textf("%d/%d", procs.RunningProcesses, procs.TotalProcesses),
+	))
+}
+
+func uptimeOutput(s sysinfo.Info) bar.Output {
+	u := s.Uptime
+	var uptimeOut *pango.Node
+	if u.Hours() < 24 {
+		uptimeOut = pango.Textf("%d:%02d",
+			int(u.Hours()), int(u.Minutes())%60)
+	} else {
+		uptimeOut = pango.Textf("%dd%02dh",
+			int(u.Hours()/24), int(u.Hours())%24)
+	}
+	return pango.Icon("mdi-weather-sunset-up").Concat(spacer, uptimeOut)
+}
+
+// freeMemOutput shows the available memory, and huge page usage in detail
+// mode if any huge pages are configured.
+func freeMemOutput(m meminfo.Info) bar.Output {
+	mem := pango.Icon("mdi-memory")
+	if !isCompact() {
+		mem.Append(spacer, ibytesize(m.Available(), sigFigs(2)))
+	}
+	out := outputs.Pango(mem)
+	freeGigs := m.Available().Gigabytes()
+	mt := thresholds.Memory
+	threshold(out, bandThreshold(freeGigs,
+		band{mt.Urgent, "urgent"},
+		band{mt.Bad, "bad"},
+		band{mt.Degraded, "degraded"},
+		band{mt.Good, ""},
+		band{above, "good"},
+	))
+	out.OnClick(click.Left(func() {
+		mainModalController.Toggle("sysinfo")
+	}))
+	hp := hugePages(m)
+	if hp.Total <= 0 {
+		return out
+	}
+	pages := outputs.Pango(
+		pango.Textf("HP: %d/%d", hp.Used(), hp.Total), spacer,
+		pango.Textf("(%s each)", format.IBytesize(hp.PageSize)).Smaller(),
+	)
+	return outputs.Group(out, threshold(pages, thresholdConfig{
+		Degraded: hp.FreeFrac() < 0.1,
+	}))
+}
+
+// sessionOutput shows how long the login session has been running, as a
+// reminder to take a break once it passes sessionBreakAfter.
+func sessionOutput(s sessionInfo) bar.Output {
+	d := s.SessionDuration
+	out := outputs.Pango(
+		pango.Icon("mdi-account-clock"), spacer,
+		pango.Textf("%d:%02d", int(d.Hours()), int(d.Minutes())%60),
+	)
+	if d >= sessionBreakAfter {
+		out.Color(themeColor("degraded"))
+	}
+	return out
+}
+
+func swapMemOutput(m meminfo.Info) bar.Output {
+	return outputs.Pango(
+		pango.Icon("mdi-swap-horizontal"),
+		spacer,
+		ibytesize(m["SwapTotal"]-m["SwapFree"], sigFigs(2)),
+		pango.Textf("(%2.0f%%)", (1-m.FreeFrac("Swap"))*100.0).Small(),
+	)
+}
+
+func tempSparkline(samples []float64) bar.Output {
+	lo, hi := minMax(samples)
+	// Don't turn a degree or two of noise into a full-height graph.
+	if hi-lo < 10 {
+		hi = lo + 10
+	}
+	return outputs.Pango(pango.Text(sparkline(samples, lo, hi)).Smaller())
+}
+
+// tempNode shows a temperature, marked when the CPU is being throttled,
+// since that's when the heat is actually costing performance.
+func tempNode(temp unit.Temperature, throttling bool) *pango.Node {
+	out := pango.Icon("mdi-fan").Concat(spacer).ConcatTextf("%2d℃", int(temp.Celsius()))
+	if throttling {
+		out.Append(spacer, pango.Icon("mdi-alert").Color(themeColor("bad")))
+	}
+	return out
+}
+
+// tempOutput shows the CPU temperature, with a sparkline of its recent
+// history.
+func tempOutput(temp unit.Temperature, history []float64, throttling bool) bar.Output {
+	return outputs.Group(
+		tempThreshold(outputs.Pango(tempNode(temp, throttling)), temp),
+		tempSparkline(history))
+}
+
+func hwmonOutput(readings []hwmonReading, history []float64, throttling bool) bar.Output {
+	if len(readings) == 0 {
+		return nil
+	}
+	max := hottest(readings)
+	out := outputs.Group(tempThreshold(outputs.Pango(tempNode(max.Temp, throttling)), max.Temp))
+	out.Append(tempSparkline(history))
+	for _, r := range readings {
+		out.Append(tempThreshold(outputs.Pango(
+			pango.Text(r.Label).Smaller(), spacer,
+			pango.Textf("%2d℃", int(r.Temp.Celsius())),
+		), r.Temp))
+	}
+	return out
+}
+
+func cpuFreqOutput(f cpuFreqInfo) bar.Output {
+	out := outputs.Group()
+	freq := pango.Icon("mdi-speedometer").
+		Concat(spacer).
+		ConcatTextf("%.2fGHz", f.Current.Gigahertz())
+	if f.Governor != "" {
+		freq.Append(spacer, pango.Text(f.Governor).Smaller())
+	}
+	out.Append(outputs.Pango(freq))
+	if f.Max > 0 {
+		out.Append(outputs.Pango(
+			pango.Text("max").Smaller(), spacer,
+			pango.Textf("%.2fGHz", f.Max.Gigahertz()),
+		))
+	}
+	return out
+}
+
+// powerOutput shows a plug while on AC power, and the power draw if the
+// batteries report it. flash is set briefly after the adapter is
+// disconnected.
+func powerOutput(i powerInfo, flash bool) bar.Output {
+	if flash {
+		return outputs.Pango(pango.Icon("mdi-power-plug-off")).Urgent(true)
+	}
+	if !i.OnAC && i.PowerWatts == 0 {
+		return nil
+	}
+	out := pango.Icon("mdi-power-plug-off")
+	if i.OnAC {
+		out = pango.Icon("mdi-power-plug")
+	}
+	if i.PowerWatts != 0 {
+		out.Append(spacer, pango.Textf("%.1f", i.PowerWatts), pango.Text("W").Smaller())
+	}
+	return outputs.Pango(out)
+}
+
+// idleOutput shows how long the session has been idle.
+func idleOutput(idle time.Duration) bar.Output {
+	h, m, _ := hms(idle)
+	return outputs.Pango(pango.Icon("mdi-account-clock"), spacer, pango.Textf("%d:%02d", h, m)).
+		Color(themeColor("degraded"))
+}
+
+// recordingOutput blinks a dot in the bad colour while recorder is running.
+func recordingOutput(recorder string) bar.Output {
+	return outputs.Repeat(func(now time.Time) bar.Output {
+		icon := pango.Icon("mdi-record-circle").Color(themeColor("bad"))
+		if now.Second()%2 == 1 {
+			icon.Alpha(0.3)
+		}
+		return outputs.Pango(icon, spacer, pango.Text(recorder).Smaller())
+	}).Every(time.Second)
+}
+
+// webcamOutput shows an urgent camera while the webcam is in use, naming
+// the process using it on click.
+func webcamOutput(i webcamInfo) bar.Output {
+	if !i.Active {
+		return nil
+	}
+	return outputs.Pango(pango.Icon("mdi-webcam")).
+		Urgent(true).
+		OnClick(click.Left(func() {
+			notify("Webcam in use", i.Consumer, false)
+		}))
+}
+
+// DISKS
+
+// diskSpaceOutput shows the free space at path, with inode usage on a
+// separate segment if the filesystem has a fixed number of inodes.
+func diskSpaceOutput(i diskspace.Info, inodesFree float64, hasInodes bool, icon string) bar.Output {
+	// Running out of inodes is as bad as running out of space, so
+	// colour on whichever is closer to exhaustion.
+	if !hasInodes {
+		inodesFree = 1
+	}
+	space := pango.Icon(icon)
+	if !isCompact() {
+		space.Append(spacer, ibytesize(i.Available, sigFigs(2)))
+	}
+	out := outputs.Pango(space)
+	d := thresholds.Disk
+	// Space is urgent by what's left in GB, as a fraction means little on
+	// a big disk, but inodes only come as a fraction.
+	inodeBands := bandThreshold(inodesFree,
+		band{d.UrgentInodes, "urgent"},
+		band{d.Bad, "bad"},
+		band{d.Degraded, "degraded"},
+	)
+	threshold(out, worstOf(
+		bandThreshold(i.Available.Gigabytes(), band{d.UrgentGB, "urgent"}),
+		bandThreshold(i.AvailFrac(), band{d.Bad, "bad"}, band{d.Degraded, "degraded"}),
+		inodeBands,
+	))
+	if !hasInodes {
+		return out
+	}
+	// Inode usage is only shown in detail mode.
+	inodes := outputs.Pango(
+		pango.Icon("mdi-file-multiple-outline").Alpha(0.8), spacer,
+		pango.Textf("%2.0f%%", (1-inodesFree)*100),
+	)
+	return outputs.Group(out, threshold(inodes, inodeBands))
+}
+
+// diskioDeviceLen is the space given to the device name, enough for e.g.
+// "sda1" but shortened in the middle for "nvme0n1p2" to keep the partition.
+const diskioDeviceLen = 7
+
+// diskioOutput shows the disk throughput, and utilization if utilOK is
+// set.
+func diskioOutput(dev string, r diskio.IO, util float64, utilOK bool) bar.Output {
+	out := pango.Icon("mdi-swap-vertical").
+		Concat(spacer).
+		ConcatText(format.IByterate(r.Total()))
+	if !isCompact() {
+		out.Append(spacer, pango.Text(truncateMiddle(dev, diskioDeviceLen)).Smaller())
+	}
+	if utilOK {
+		out.Append(spacer, pango.Textf("%.0f%%", util*100).Smaller())
+	}
+	return threshold(outputs.Pango(out), thresholdConfig{
+		// Saturated, so anything else touching the disk will wait.
+		Degraded: util > 0.9,
+	})
+}
+
+// CALENDAR
+
+// calEventTime describes when an event is, relative to now.
+func calEventTime(e calEvent, now time.Time) string {
+	sameDay := func(a, b time.Time) bool {
+		return midnight(a).Equal(midnight(b))
+	}
+	start := e.Start.In(now.Location())
+	switch {
+	case e.AllDay && sameDay(start, now):
+		return "today"
+	case e.AllDay:
+		return start.Format("Mon")
+	case !start.After(now):
+		return "until " + e.End.In(now.Location()).Format("15:04")
+	case sameDay(start, now):
+		return start.Format("15:04")
+	}
+	return start.Format("Mon 15:04")
+}
+
+// calendarOutput shows the next event, followed by up to three more that
+// are only shown in detail mode.
+func calendarOutput(events []calEvent, now time.Time) bar.Output {
+	if len(events) == 0 {
+		return nil
+	}
+	out := outputs.Group()
+	for i, e := range events {
+		if i > 3 {
+			break
+		}
+		text := pango.Icon("mdi-calendar-clock")
+		if i > 0 {
+			text.Alpha(0.8)
+		}
+		if i > 0 || !isCompact() {
+			summary := pango.Text(truncate(e.Summary, 25))
+			if i > 0 {
+				summary.Smaller()
+			}
+			text.Append(spacer, summary)
+		}
+		text.Append(spacer, pango.Text(calEventTime(e, now)).Smaller())
+		seg := outputs.Pango(text)
+		if i == 0 {
+			seg.OnClick(click.Left(func() {
+				mainModalController.Toggle("calendar")
+			}))
+			if !e.AllDay && e.Start.After(now) && e.Start.Sub(now) < 10*time.Minute {
+				seg.Color(themeColor("degraded"))
+			}
+		}
+		out.Append(seg)
+	}
+	return out
+}
+
+// DESKTOP
+
+func clipboardOutput(c clipboardManager, entries int) bar.Output {
+	return outputs.Pango(pango.Icon("mdi-clipboard"), spacer, pango.Textf("%d", entries)).
+		OnClick(click.Left(c.openPicker))
+}
+
+func focusedWindowOutput(title string) bar.Output {
+	return outputs.Pango(pango.Icon("mdi-application"), spacer, pango.Text(title))
+}
+
+func workspacesOutput(list []i3Workspace) bar.Output {
+	out := outputs.Group()
+	for _, ws := range list {
+		name := ws.Name
+		seg := outputs.Text(name).OnClick(click.Left(func() { focusWorkspace(name) }))
+		switch {
+		case ws.Urgent:
+			seg.Urgent(true)
+		case ws.Focused:
+			seg.Color(themeColor("good"))
+		case !ws.Visible:
+			seg.Color(themeColor("degraded"))
+		}
+		out.Append(seg)
+	}
+	return out
+}
+
+func commandOutput(c commandSegment, stdout, stderr string) bar.Output {
+	var out bar.Output
+	text, ok := c.extract(stdout)
+	switch {
+	case ok && text != "":
+		out = threshold(outputs.Text(text), c.thresholds(text))
+	case stderr != "":
+		out = outputs.Text(truncate(strings.SplitN(stderr, "\n", 2)[0], 50)).Urgent(true)
+	default:
+		return nil
+	}
+	if c.icon != "" {
+		out = withIcon(out, c.icon)
+	}
+	return out
+}
+
+func tickerOutput(t tickerInfo) bar.Output {
+	icon := "mdi-currency-usd"
+	if t.Currency == "EUR" {
+		icon = "mdi-currency-eur"
+	}
+	out := pango.Icon(icon).Concat(spacer).ConcatTextf("%s %.2f", t.Symbol, t.Price)
+	switch {
+	case t.Change > 0:
+		out.Append(spacer, pango.Icon("mdi-arrow-up").Color(themeColor("good")))
+	case t.Change < 0:
+		out.Append(spacer, pango.Icon("mdi-arrow-down").Color(themeColor("bad")))
+	}
+	return outputs.Pango(out)
+}
+
+func gpgOutput(g gpgInfo) bar.Output {
+	if g.AlreadyExpired == 0 && g.ExpiringWithin30Days == 0 {
+		return nil
+	}
+	out := outputs.Pango(
+		pango.Icon("mdi-key-alert"), spacer,
+		pango.Textf("%d", g.AlreadyExpired+g.ExpiringWithin30Days),
+	).OnClick(click.Left(func() { editGPGKey(g.Fingerprint) }))
+	return threshold(out, thresholdConfig{
+		Urgent:   g.AlreadyExpired > 0,
+		Degraded: g.ExpiringWithin30Days > 0,
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/modules/diskspace"
+	"barista.run/modules/sysinfo"
+	"github.com/martinlindhe/unit"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+func TestDiskSpaceThresholds(t *testing.T) {
+	disk := func(availGB, totalGB float64) diskspace.Info {
+		return diskspace.Info{
+			Available: unit.Datasize(availGB) * unit.Gigabyte,
+			Total:     unit.Datasize(totalGB) * unit.Gigabyte,
+		}
+	}
+	for _, tc := range []struct {
+		info       diskspace.Info
+		inodesFree float64
+		hasInodes  bool
+		urgent     bool
+		color      string
+	}{
+		{info: disk(500, 1000), color: ""},
+		{info: disk(100, 1000), color: "degraded"},
+		{info: disk(50, 1000), color: "bad"},
+		// Few GB left is urgent however big the disk.
+		{info: disk(0.5, 4), urgent: true},
+		// A small disk at 25% free is fine.
+		{info: disk(1.5, 6), color: ""},
+		// Inodes running out outweigh plenty of free space.
+		{info: disk(500, 1000), inodesFree: 0.08, hasInodes: true, color: "degraded"},
+		{info: disk(500, 1000), inodesFree: 0.04, hasInodes: true, color: "bad"},
+		{info: disk(500, 1000), inodesFree: 0.005, hasInodes: true, urgent: true},
+		// Without fixed inodes, inodesFree is ignored.
+		{info: disk(500, 1000), inodesFree: 0, hasInodes: false, color: ""},
+		// The worse of the two wins.
+		{info: disk(50, 1000), inodesFree: 0.08, hasInodes: true, color: "bad"},
+	} {
+		name := fmt.Sprintf("%.1f/%.0fGB,inodes=%v", tc.info.Available.Gigabytes(),
+			tc.info.Total.Gigabytes(), tc.inodesFree)
+		t.Run(name, func(t *testing.T) {
+			matchers := []baristatest.OutputMatcher{baristatest.Color(0, schemeColor(tc.color))}
+			if tc.urgent {
+				matchers = append(matchers, baristatest.IsUrgent(0))
+			}
+			baristatest.AssertOutput(t, func(i diskspace.Info) bar.Output {
+				return diskSpaceOutput(i, tc.inodesFree, tc.hasInodes, "mdi-harddisk")
+			}, tc.info, matchers...)
+		})
+	}
+}
+
+func TestHeatColor(t *testing.T) {
+	rgb := func(c color.Color) [3]uint32 {
+		r, g, b, _ := c.RGBA()
+		return [3]uint32{r >> 8, g >> 8, b >> 8}
+	}
+	good, bad := rgb(themeColor("good")), rgb(themeColor("bad"))
+	for _, tc := range []struct {
+		frac float64
+		want [3]uint32
+	}{
+		{-1, good}, {0, good}, {1, bad}, {2, bad},
+	} {
+		if got := rgb(heatColor(tc.frac)); got != tc.want {
+			t.Errorf("heatColor(%v) = %v, want %v", tc.frac, got, tc.want)
+		}
+	}
+	mid := rgb(heatColor(0.5))
+	for i := range mid {
+		lo, hi := good[i], bad[i]
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		if mid[i] < lo || mid[i] > hi {
+			t.Errorf("heatColor(0.5) = %v, not between %v and %v", mid, good, bad)
+		}
+	}
+
+	defer updateTheme(func() { colors.LoadFromMap(testColors) })
+	updateTheme(func() { setThemeColor("bad", colors.Hex("#0000ff")) })
+	if got := rgb(heatColor(1)); got != [3]uint32{0, 0, 0xff} {
+		t.Errorf("after a theme change: got %v", got)
+	}
+}
+
+func TestRecordingOutputColor(t *testing.T) {
+	defer updateTheme(func() { colors.LoadFromMap(testColors) })
+	for _, bad := range []string{testColors["bad"], "#0000ff"} {
+		updateTheme(func() { setThemeColor("bad", colors.Hex(bad)) })
+		seg := recordingOutput("obs").Segments()[0]
+		if text, _ := seg.Content(); !strings.Contains(text, `color="`+bad+`"`) {
+			t.Errorf("got %s, want the dot in %s", text, bad)
+		}
+	}
+}
+
+func TestLoadAvgPerCPU(t *testing.T) {
+	type style struct {
+		urgent bool
+		color  string
+	}
+	check := func(load float64, procs, numCPU int, want style) {
+		t.Helper()
+		s := sysinfo.Info{Loads: [3]float64{load, load, load}, Uptime: time.Hour}
+		var c color.Color
+		if want.color != "" {
+			c = themeColor(want.color)
+		}
+		matchers := []baristatest.OutputMatcher{baristatest.Color(0, c)}
+		if want.urgent {
+			matchers = []baristatest.OutputMatcher{baristatest.IsUrgent(0)}
+		}
+		baristatest.AssertOutput(t, func(s sysinfo.Info) bar.Output {
+			return loadAvgOutput(s, loadavgInfo{RunningProcesses: procs}, numCPU)
+		}, s, matchers...)
+	}
+	// The same load per CPU is styled the same on any number of CPUs.
+	for _, numCPU := range []int{1, 4, 16, 64} {
+		n := float64(numCPU)
+		check(0.25*n, 1, numCPU, style{color: "good"})
+		check(0.5*n, 1, numCPU, style{color: "good"})
+		check(0.75*n, 1, numCPU, style{})
+		check(1.0*n, 1, numCPU, style{})
+		check(1.25*n, 1, numCPU, style{color: "degraded"})
+		check(1.5*n, 1, numCPU, style{color: "degraded"})
+		check(1.75*n, 1, numCPU, style{color: "bad"})
+		check(2.0*n, 1, numCPU, style{color: "bad"})
+		check(2.5*n, 1, numCPU, style{urgent: true})
+		// Many runnable processes per CPU are urgent even at a low load.
+		check(0.25*n, 4*numCPU+1, numCPU, style{urgent: true})
+	}
+	// A load that's urgent on 4 CPUs is fine on 32.
+	check(9, 1, 4, style{urgent: true})
+	check(9, 1, 32, style{color: "good"})
+
+	// Not styled at all shortly after boot.
+	s := sysinfo.Info{Loads: [3]float64{100, 100, 100}, Uptime: 5 * time.Minute}
+	baristatest.AssertOutput(t, func(s sysinfo.Info) bar.Output {
+		return loadAvgOutput(s, loadavgInfo{}, 4)
+	}, s, baristatest.Color(0, nil))
+}
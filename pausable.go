@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"barista.run/bar"
+)
+
+// modeCheckInterval is how often the active mode is checked, to pause and
+// resume the detail modules of modes as they're collapsed and expanded.
+// modal has no way to subscribe to mode changes, but this only reads a
+// value in memory.
+var modeCheckInterval = 100 * time.Millisecond
+
+// pausable is implemented by modules that can stop updating while they're
+// hidden, e.g. to avoid running commands every second for a collapsed mode.
+type pausable interface {
+	Pause()
+	// Resume restarts updates, refreshing straight away.
+	Resume()
+}
+
+var pausedModesMu sync.Mutex
+var pausedModes = map[string][]pausable{}
+
+// pauseWhenCollapsed pauses the modules that are pausable while the given
+// mode isn't active, and returns all of them for use with Detail.
+func pauseWhenCollapsed(mode string, mods ...bar.Module) []bar.Module {
+	pausedModesMu.Lock()
+	defer pausedModesMu.Unlock()
+	for _, m := range mods {
+		if p, ok := m.(pausable); ok {
+			p.Pause()
+			pausedModes[mode] = append(pausedModes[mode], p)
+		}
+	}
+	return mods
+}
+
+// watchModes pauses and resumes the modules registered with
+// pauseWhenCollapsed as their modes are collapsed and expanded, until done
+// is closed.
+func watchModes(done <-chan struct{}) {
+	t := time.NewTicker(modeCheckInterval)
+	defer t.Stop()
+	current := ""
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		mode := mainModalController.Current()
+		if mode == current {
+			continue
+		}
+		pausedModesMu.Lock()
+		for _, p := range pausedModes[current] {
+			p.Pause()
+		}
+		for _, p := range pausedModes[mode] {
+			p.Resume()
+		}
+		pausedModesMu.Unlock()
+		current = mode
+	}
+}
+
+// resumePaused resumes every module registered with pauseWhenCollapsed,
+// for when there's no modal to expand, e.g. with -once.
+func resumePaused() {
+	pausedModesMu.Lock()
+	defer pausedModesMu.Unlock()
+	for _, mods := range pausedModes {
+		for _, p := range mods {
+			p.Resume()
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+)
+
+// fakePausable records when it was paused and resumed.
+type fakePausable struct {
+	mu     sync.Mutex
+	events []string
+	at     []time.Time
+}
+
+func (f *fakePausable) record(event string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	f.at = append(f.at, time.Now())
+}
+
+func (f *fakePausable) Pause()          { f.record("pause") }
+func (f *fakePausable) Resume()         { f.record("resume") }
+func (f *fakePausable) Stream(bar.Sink) {}
+
+// waitFor waits up to d for the nth event, returning it and when it
+// happened.
+func (f *fakePausable) waitFor(n int, d time.Duration) (string, time.Time, bool) {
+	deadline := time.Now().Add(d)
+	for {
+		f.mu.Lock()
+		if len(f.events) > n {
+			defer f.mu.Unlock()
+			return f.events[n], f.at[n], true
+		}
+		f.mu.Unlock()
+		if time.Now().After(deadline) {
+			return "", time.Time{}, false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPauseWhenCollapsed(t *testing.T) {
+	defer func(d time.Duration) { modeCheckInterval = d }(modeCheckInterval)
+	modeCheckInterval = 10 * time.Millisecond
+	modes := mainModalController.(*testModes)
+	defer modes.Reset()
+	defer func() {
+		pausedModesMu.Lock()
+		delete(pausedModes, "test")
+		pausedModesMu.Unlock()
+	}()
+
+	p := &fakePausable{}
+	other := &fakePausable{}
+	pauseWhenCollapsed("test", p, other)
+	if ev, _, _ := p.waitFor(0, 0); ev != "pause" {
+		t.Fatalf("not paused when registered, got %q", ev)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go watchModes(done)
+
+	// A mode change is noticed within one check, so allow a little over
+	// two for scheduling.
+	limit := 2*modeCheckInterval + 5*time.Millisecond
+	expanded := time.Now()
+	modes.Activate("test")
+	ev, at, ok := p.waitFor(1, time.Second)
+	if !ok || ev != "resume" {
+		t.Fatalf("got %q after expanding, want resume", ev)
+	}
+	if d := at.Sub(expanded); d > limit {
+		t.Errorf("resumed %v after expanding, want within %v", d, limit)
+	}
+	if ev, _, _ := other.waitFor(1, time.Second); ev != "resume" {
+		t.Errorf("second module: got %q after expanding, want resume", ev)
+	}
+
+	collapsed := time.Now()
+	modes.Reset()
+	ev, at, ok = p.waitFor(2, time.Second)
+	if !ok || ev != "pause" {
+		t.Fatalf("got %q after collapsing, want pause", ev)
+	}
+	if d := at.Sub(collapsed); d > limit {
+		t.Errorf("paused %v after collapsing, want within %v", d, limit)
+	}
+
+	// Nothing else happens while the mode stays collapsed.
+	time.Sleep(5 * modeCheckInterval)
+	if ev, _, ok := p.waitFor(3, 0); ok {
+		t.Errorf("unexpected %q while collapsed", ev)
+	}
+}
+
+func TestShellStderrPause(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "runs")
+	runs := func() int {
+		data, _ := ioutil.ReadFile(log)
+		return strings.Count(string(data), "\n")
+	}
+	interval := 200 * time.Millisecond
+	s := newShellWithStderr("sh", "-c", "echo run >> "+log).Every(interval)
+	s.Pause()
+	go s.Stream(func(bar.Output) {})
+
+	time.Sleep(interval + 50*time.Millisecond)
+	if n := runs(); n != 0 {
+		t.Fatalf("ran %d times while paused", n)
+	}
+
+	// Resume runs straight away rather than waiting for the next tick.
+	s.Resume()
+	deadline := time.Now().Add(interval / 2)
+	for runs() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := runs(); n != 1 {
+		t.Fatalf("ran %d times within %v of resuming, want 1", n, interval/2)
+	}
+
+	s.Pause()
+	time.Sleep(2 * interval)
+	if n := runs(); n > 2 {
+		t.Errorf("ran %d times after pausing again", n)
+	}
+}
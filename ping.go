@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// pingHost is pinged to measure the quality of the connection.
+var pingHost = "1.1.1.1"
+
+// pingInterval is how often pingHost is pinged, and pingTimeout is how long
+// to wait for each reply.
+var pingInterval = 5 * time.Second
+var pingTimeout = 2 * time.Second
+
+// pingWindow is how many recent pings the packet loss is measured over.
+const pingWindow = 20
+
+type pingInfo struct {
+	Host string
+	// RTT is the round trip time of the last reply.
+	RTT time.Duration
+	// Reachable is whether the last ping was answered.
+	Reachable bool
+	// Loss is the fraction of recent pings that went unanswered.
+	Loss float64
+}
+
+// pingStats keeps the results of the last pingWindow pings.
+type pingStats struct {
+	mu      sync.Mutex
+	results []bool
+	seq     uint16
+}
+
+func (p *pingStats) ping() pingInfo {
+	p.mu.Lock()
+	p.seq++
+	seq := p.seq
+	p.mu.Unlock()
+	rtt, err := icmpPing(pingHost, seq, pingTimeout)
+	if err != nil {
+		logDebugf("Ping %s: %v", pingHost, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.results = append(p.results, err == nil)
+	if len(p.results) > pingWindow {
+		p.results = p.results[1:]
+	}
+	lost := 0
+	for _, ok := range p.results {
+		if !ok {
+			lost++
+		}
+	}
+	return pingInfo{
+		Host:      pingHost,
+		RTT:       rtt,
+		Reachable: err == nil,
+		Loss:      float64(lost) / float64(len(p.results)),
+	}
+}
+
+// icmpPing sends an ICMP echo request to host and waits for the reply. It
+// uses an unprivileged ping socket if the kernel allows it (see
+// net.ipv4.ping_group_range), and a raw socket otherwise.
+func icmpPing(host string, seq uint16, timeout time.Duration) (time.Duration, error) {
+	addr, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return 0, err
+	}
+	raw := false
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, unix.IPPROTO_ICMP)
+	if err != nil {
+		raw = true
+		fd, err = unix.Socket(unix.AF_INET, unix.SOCK_RAW, unix.IPPROTO_ICMP)
+	}
+	if err != nil {
+		return 0, err
+	}
+	f := os.NewFile(uintptr(fd), "icmp")
+	conn, err := net.FilePacketConn(f)
+	f.Close()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	// Ping sockets replace the identifier with their own.
+	id := uint16(os.Getpid())
+	req := []byte{8, 0, 0, 0, 0, 0, 0, 0, 'b', 'a', 'r', 'i', 's', 't', 'a'}
+	binary.BigEndian.PutUint16(req[4:], id)
+	binary.BigEndian.PutUint16(req[6:], seq)
+	binary.BigEndian.PutUint16(req[2:], icmpChecksum(req))
+
+	var dst net.Addr = &net.UDPAddr{IP: addr.IP}
+	if raw {
+		dst = addr
+	}
+	start := time.Now()
+	conn.SetDeadline(start.Add(timeout))
+	if _, err := conn.WriteTo(req, dst); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		reply := buf[:n]
+		// Raw sockets include the IP header.
+		if raw && n > 0 && reply[0]>>4 == 4 {
+			reply = reply[int(reply[0]&0x0f)*4:]
+		}
+		if len(reply) < 8 || reply[0] != 0 {
+			continue
+		}
+		if binary.BigEndian.Uint16(reply[6:]) != seq {
+			continue
+		}
+		if raw && binary.BigEndian.Uint16(reply[4:]) != id {
+			continue
+		}
+		return time.Since(start), nil
+	}
+}
+
+// icmpChecksum is the internet checksum of b (RFC 1071).
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"barista.run/modules/weather"
+	"github.com/martinlindhe/unit"
+)
+
+// pirateWeatherURL is formatted with the API key, latitude and longitude.
+var pirateWeatherURL = "https://api.pirateweather.net/forecast/%s/%f,%f?units=si&exclude=minutely,hourly,alerts"
+
+// pirateWeatherResponse is the subset of the Dark Sky compatible forecast
+// that's used. With units=si, speeds are in m/s and pressure in hPa.
+type pirateWeatherResponse struct {
+	Currently struct {
+		Time              int64   `json:"time"`
+		Summary           string  `json:"summary"`
+		Icon              string  `json:"icon"`
+		PrecipProbability float64 `json:"precipProbability"`
+		Temperature       float64 `json:"temperature"`
+		Humidity          float64 `json:"humidity"`
+		Pressure          float64 `json:"pressure"`
+		WindSpeed         float64 `json:"windSpeed"`
+		WindBearing       float64 `json:"windBearing"`
+		CloudCover        float64 `json:"cloudCover"`
+	} `json:"currently"`
+	Daily struct {
+		Data []struct {
+			SunriseTime int64 `json:"sunriseTime"`
+			SunsetTime  int64 `json:"sunsetTime"`
+		} `json:"data"`
+	} `json:"daily"`
+}
+
+// pirateWeatherConditions maps Dark Sky icon names to conditions.
+var pirateWeatherConditions = map[string]weather.Condition{
+	"clear-day":           weather.Clear,
+	"clear-night":         weather.Clear,
+	"rain":                weather.Rain,
+	"snow":                weather.Snow,
+	"sleet":               weather.Sleet,
+	"wind":                weather.Windy,
+	"fog":                 weather.Fog,
+	"cloudy":              weather.Cloudy,
+	"partly-cloudy-day":   weather.PartlyCloudy,
+	"partly-cloudy-night": weather.PartlyCloudy,
+	"hail":                weather.Hail,
+	"thunderstorm":        weather.Thunderstorm,
+	"tornado":             weather.Tornado,
+}
+
+// pirateWeatherGet fetches the current conditions, and the chance of
+// precipitation, which weather.Weather has no field for.
+func pirateWeatherGet(ctx context.Context, apiKey string, lat, lng float64) (w weather.Weather, pop float64, err error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(pirateWeatherURL, apiKey, lat, lng))
+	if err != nil {
+		return w, 0, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus("pirate weather", resp); err != nil {
+		return w, 0, err
+	}
+	var res pirateWeatherResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return w, 0, err
+	}
+	w, pop = pirateWeatherConvert(res)
+	return w, pop, nil
+}
+
+func pirateWeatherConvert(res pirateWeatherResponse) (weather.Weather, float64) {
+	c := res.Currently
+	w := weather.Weather{
+		Condition:   pirateWeatherConditions[c.Icon],
+		Description: c.Summary,
+		Temperature: unit.FromCelsius(c.Temperature),
+		Humidity:    c.Humidity,
+		Pressure:    unit.Pressure(c.Pressure) * unit.Hectopascal,
+		Wind: weather.Wind{
+			Speed:     unit.Speed(c.WindSpeed) * unit.MetersPerSecond,
+			Direction: weather.Direction(c.WindBearing),
+		},
+		CloudCover:  c.CloudCover,
+		Updated:     time.Unix(c.Time, 0),
+		Attribution: "Pirate Weather",
+	}
+	if len(res.Daily.Data) > 0 {
+		today := res.Daily.Data[0]
+		w.Sunrise = time.Unix(today.SunriseTime, 0)
+		w.Sunset = time.Unix(today.SunsetTime, 0)
+	}
+	return w, c.PrecipProbability
+}
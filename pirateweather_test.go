@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"barista.run/modules/weather"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+func TestPirateWeatherFixture(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "pirateweather.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res pirateWeatherResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+	w, pop := pirateWeatherConvert(res)
+	if w.Condition != weather.Rain || pop != 0.67 {
+		t.Errorf("got condition %v, chance of rain %v", w.Condition, pop)
+	}
+	if got := w.Updated.UTC().Format(time.RFC3339); got != "2026-06-01T13:00:00Z" {
+		t.Errorf("updated %s", got)
+	}
+	now := time.Unix(res.Currently.Time, 0)
+	assertGolden(t, "pirateweather", baristatest.Dump(weatherOutput(w, pop, true, now)))
+}
+
+func TestAutoWeatherFallsBackToPirateWeather(t *testing.T) {
+	fastRetries(t)
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "pirateweather.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	owm := owmServer(t, http.StatusUnauthorized, http.StatusUnauthorized)
+	var pirateHits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pirateHits, 1)
+		if r.URL.Path != "/forecast/pirate-key/51.507400,-0.127800" {
+			t.Errorf("requested %s", r.URL.Path)
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+	defer func(u string) { pirateWeatherURL = u }(pirateWeatherURL)
+	pirateWeatherURL = srv.URL + "/forecast/%s/%f,%f"
+	defer func(o, p string) { owmAPIKey, pirateWeatherAPIKey = o, p }(owmAPIKey, pirateWeatherAPIKey)
+	owmAPIKey, pirateWeatherAPIKey = "owm-key", "pirate-key"
+	defer os.Unsetenv("BARISTA_CITY")
+	os.Setenv("BARISTA_CITY", "London, United Kingdom")
+
+	a := &autoWeatherProvider{}
+	w, err := a.GetWeather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(owm); got != 2 {
+		t.Errorf("%d OpenWeatherMap requests, want one each for the forecast and weather", got)
+	}
+	if got := atomic.LoadInt32(&pirateHits); got != 1 {
+		t.Errorf("%d Pirate Weather requests, want 1", got)
+	}
+	if w.Condition != weather.Rain {
+		t.Errorf("got condition %v", w.Condition)
+	}
+	if pop, ok := a.precipitation(); !ok || pop != 0.67 {
+		t.Errorf("chance of rain %v, %v, want Pirate Weather's", pop, ok)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/static"
+)
+
+// pomodoroLength is how long the focus timer runs.
+var pomodoroLength = 25 * time.Minute
+
+// pomodoroStopwatchFile holds the state of the timer's stopwatch mode.
+var pomodoroStopwatchFile = home(".cache/barista/pomodoro-stopwatch.json")
+
+// pomodoroStateFile holds the end time of a running timer, so that it
+// survives restarts of the bar.
+var pomodoroStateFile = home(".cache/barista/pomodoro")
+
+// pomodoro is a focus timer, started on left click and reset on right
+// click, with a notification when time is up. Middle click switches to a
+// stopwatch, which is paused and resumed by left click instead.
+type pomodoro struct {
+	out *static.Module
+	mu  sync.Mutex
+	end time.Time
+	// stop is closed to end the tick loop of the current run.
+	stop chan struct{}
+	// counting is set in stopwatch mode.
+	counting bool
+	sw       *stopwatch
+}
+
+func newPomodoro() *pomodoro {
+	p := &pomodoro{out: static.New(nil)}
+	p.sw = newStopwatchOn(p.out, pomodoroStopwatchFile,
+		func(i stopwatchInfo, _ stopwatchController) bar.Output {
+			return pomodoroStopwatchOutput(i, p.Click)
+		})
+	if i := p.sw.Info(); i.Running || i.Elapsed > 0 {
+		p.counting = true
+		return p
+	}
+	if data, err := ioutil.ReadFile(pomodoroStateFile); err == nil {
+		if end, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data))); err == nil {
+			p.run(end)
+			return p
+		}
+	}
+	p.show()
+	return p
+}
+
+// Stream shows the timer.
+func (p *pomodoro) Stream(s bar.Sink) {
+	p.out.Stream(s)
+}
+
+// Click starts the timer on left click, and resets it on right click.
+// Middle click switches between the timer and the stopwatch.
+func (p *pomodoro) Click(e bar.Event) {
+	p.mu.Lock()
+	counting := p.counting
+	p.mu.Unlock()
+	if e.Button == bar.ButtonMiddle {
+		p.switchMode(!counting)
+		return
+	}
+	if counting {
+		switch e.Button {
+		case bar.ButtonLeft:
+			p.sw.Toggle()
+		case bar.ButtonRight:
+			p.sw.Reset()
+		}
+		return
+	}
+	switch e.Button {
+	case bar.ButtonLeft:
+		p.mu.Lock()
+		running := !p.end.IsZero()
+		p.mu.Unlock()
+		if !running {
+			p.run(time.Now().Add(pomodoroLength))
+		}
+	case bar.ButtonRight:
+		p.reset()
+	}
+}
+
+// switchMode resets whichever of the timer and the stopwatch was in use,
+// and starts the stopwatch when switching to it.
+func (p *pomodoro) switchMode(counting bool) {
+	p.mu.Lock()
+	p.counting = counting
+	p.mu.Unlock()
+	if counting {
+		p.reset()
+		p.sw.Start()
+	} else {
+		p.sw.Reset()
+		p.show()
+	}
+}
+
+// run starts the tick loop for a timer ending at end. A timer that ended
+// while the bar wasn't running still notifies, so it isn't missed.
+func (p *pomodoro) run(end time.Time) {
+	p.mu.Lock()
+	p.end = end
+	p.stop = make(chan struct{})
+	stop := p.stop
+	p.mu.Unlock()
+	p.save(end)
+	p.show()
+	go func() {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for {
+			if !time.Now().Before(end) {
+				notify("Pomodoro", "Time for a break", true)
+				p.reset()
+				return
+			}
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				p.show()
+			}
+		}
+	}()
+}
+
+func (p *pomodoro) reset() {
+	p.mu.Lock()
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+	p.end = time.Time{}
+	p.mu.Unlock()
+	os.Remove(pomodoroStateFile)
+	p.show()
+}
+
+func (p *pomodoro) save(end time.Time) {
+	if os.MkdirAll(filepath.Dir(pomodoroStateFile), 0755) == nil {
+		ioutil.WriteFile(pomodoroStateFile, []byte(end.Format(time.RFC3339)+"\n"), 0644)
+	}
+}
+
+// show displays the timer. The stopwatch shows itself.
+func (p *pomodoro) show() {
+	p.mu.Lock()
+	end, counting := p.end, p.counting
+	p.mu.Unlock()
+	if counting {
+		return
+	}
+	var remaining time.Duration
+	if !end.IsZero() {
+		remaining = time.Until(end).Round(time.Second)
+		if remaining < 0 {
+			remaining = 0
+		}
+	}
+	p.out.Set(pomodoroOutput(!end.IsZero(), remaining, p.Click))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/static"
+	"github.com/fsnotify/fsnotify"
+)
+
+// powerSupplyDir is where the kernel exposes AC adapters and batteries.
+var powerSupplyDir = "/sys/class/power_supply"
+
+// powerPollInterval is how often the power draw is read. Most drivers
+// don't notify changes to sysfs attributes, so the AC state is polled too
+// in case the watch never fires.
+var powerPollInterval = 5 * time.Second
+
+// powerFlashDuration is how long the segment is shown as urgent after the
+// AC adapter is disconnected.
+var powerFlashDuration = 3 * time.Second
+
+type powerInfo struct {
+	OnAC bool
+	// PowerWatts is the total draw of the batteries, whether charging or
+	// discharging, or 0 if they don't report it.
+	PowerWatts float64
+}
+
+// readPowerInfo reads the AC state and battery power draw from sysfs.
+func readPowerInfo() powerInfo {
+	var i powerInfo
+	acs, _ := filepath.Glob(filepath.Join(powerSupplyDir, "AC*", "online"))
+	for _, path := range acs {
+		if v, ok := readSysfsInt(path); ok && v == 1 {
+			i.OnAC = true
+		}
+	}
+	bats, _ := filepath.Glob(filepath.Join(powerSupplyDir, "BAT*"))
+	for _, dir := range bats {
+		// In µW, or µA and µV for batteries that only report current.
+		if p, ok := readSysfsInt(filepath.Join(dir, "power_now")); ok {
+			i.PowerWatts += float64(p) / 1e6
+		} else if c, ok := readSysfsInt(filepath.Join(dir, "current_now")); ok {
+			if v, ok := readSysfsInt(filepath.Join(dir, "voltage_now")); ok {
+				i.PowerWatts += float64(c) * float64(v) / 1e12
+			}
+		}
+	}
+	return i
+}
+
+// powerModule shows whether the laptop is on AC power, and flashes when
+// the adapter is disconnected, ahead of the battery module noticing.
+type powerModule struct {
+	out   *static.Module
+	mu    sync.Mutex
+	last  powerInfo
+	known bool
+	// flashUntil is when the segment stops flashing after the adapter
+	// was disconnected.
+	flashUntil time.Time
+}
+
+func newPowerModule() *powerModule {
+	return &powerModule{out: static.New(nil)}
+}
+
+// Stream shows the AC state.
+func (p *powerModule) Stream(s bar.Sink) {
+	go p.watch()
+	p.out.Stream(s)
+}
+
+func (p *powerModule) watch() {
+	changed := make(chan struct{}, 1)
+	if w, err := fsnotify.NewWatcher(); err == nil {
+		defer w.Close()
+		acs, _ := filepath.Glob(filepath.Join(powerSupplyDir, "AC*", "online"))
+		for _, path := range acs {
+			w.Add(path)
+		}
+		go func() {
+			for range w.Events {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	t := time.NewTicker(powerPollInterval)
+	defer t.Stop()
+	for {
+		p.update()
+		select {
+		case <-changed:
+		case <-t.C:
+		}
+	}
+}
+
+func (p *powerModule) update() {
+	i := readPowerInfo()
+	p.mu.Lock()
+	if p.known && p.last.OnAC && !i.OnAC {
+		p.flashUntil = time.Now().Add(powerFlashDuration)
+		time.AfterFunc(powerFlashDuration, p.update)
+	}
+	p.last, p.known = i, true
+	flash := time.Now().Before(p.flashUntil)
+	p.mu.Unlock()
+	p.out.Set(powerOutput(i, flash))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"barista.run/format"
+	"github.com/martinlindhe/unit"
+)
+
+// rateUnit selects how a data rate is rendered.
+type rateUnit int
+
+const (
+	// rateSI uses 1000-based byte prefixes (kB/s, MB/s), matching how most
+	// ISPs and speed tests report throughput.
+	rateSI rateUnit = iota
+	// rateIEC uses 1024-based byte prefixes (KiB/s, MiB/s).
+	rateIEC
+	// rateBits uses 1000-based bit prefixes (Kbps, Mbps).
+	rateBits
+)
+
+var (
+	siRateUnits  = []string{"B/s", "kB/s", "MB/s", "GB/s", "TB/s"}
+	bitRateUnits = []string{"bps", "Kbps", "Mbps", "Gbps", "Tbps"}
+)
+
+func formatRate(r unit.Datarate, u rateUnit) string {
+	switch u {
+	case rateIEC:
+		return byterateIEC(r)
+	case rateBits:
+		return byterateBits(r)
+	default:
+		return byterateSI(r)
+	}
+}
+
+func byterateSI(r unit.Datarate) string {
+	return scaleRate(r.BytesPerSecond(), siRateUnits)
+}
+
+func byterateIEC(r unit.Datarate) string {
+	return format.IByterate(r)
+}
+
+func byterateBits(r unit.Datarate) string {
+	return scaleRate(r.BitsPerSecond(), bitRateUnits)
+}
+
+// scaleRate divides v by 1000 until it fits in the current prefix. The tier
+// is chosen after rounding, so 999.6 kB/s is shown as 1.0 MB/s rather than
+// 1000 kB/s.
+func scaleRate(v float64, units []string) string {
+	i := 0
+	for i < len(units)-1 && math.Round(v) >= 1000 {
+		v /= 1000
+		i++
+	}
+	if i > 0 && v < 9.95 {
+		return fmt.Sprintf("%.1f %s", v, units[i])
+	}
+	return fmt.Sprintf("%.0f %s", v, units[i])
+}
+
+// peakRate remembers the highest rate seen, so it can be compared against
+// advertised speeds. If resetInterval is non-zero, the peak is forgotten
+// after that long, giving a sliding window instead of a session maximum.
+// It is safe for concurrent use.
+type peakRate struct {
+	resetInterval time.Duration
+	peak          uint64 // math.Float64bits of the peak rate.
+	resetAt       int64  // Unix nanoseconds at which to forget the peak.
+}
+
+// Update records r and returns the current peak.
+func (p *peakRate) Update(r unit.Datarate) unit.Datarate {
+	if p.resetInterval > 0 {
+		now := time.Now()
+		resetAt := atomic.LoadInt64(&p.resetAt)
+		if now.UnixNano() >= resetAt &&
+			atomic.CompareAndSwapInt64(&p.resetAt, resetAt, now.Add(p.resetInterval).UnixNano()) {
+			atomic.StoreUint64(&p.peak, math.Float64bits(float64(r)))
+			return r
+		}
+	}
+	for {
+		old := atomic.LoadUint64(&p.peak)
+		if float64(r) <= math.Float64frombits(old) {
+			return unit.Datarate(math.Float64frombits(old))
+		}
+		if atomic.CompareAndSwapUint64(&p.peak, old, math.Float64bits(float64(r))) {
+			return r
+		}
+	}
+}
+
+// Get returns the current peak.
+func (p *peakRate) Get() unit.Datarate {
+	return unit.Datarate(math.Float64frombits(atomic.LoadUint64(&p.peak)))
+}
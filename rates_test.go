@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/martinlindhe/unit"
+)
+
+func TestByterateSI(t *testing.T) {
+	for _, tc := range []struct {
+		bytes float64
+		want  string
+	}{
+		{0, "0 B/s"},
+		{999, "999 B/s"},
+		{999.4, "999 B/s"},
+		// Tiers are picked after rounding.
+		{999.6, "1.0 kB/s"},
+		{1000, "1.0 kB/s"},
+		{9940, "9.9 kB/s"},
+		{9950, "10 kB/s"},
+		{999e3, "999 kB/s"},
+		{999.4e3, "999 kB/s"},
+		{999.6e3, "1.0 MB/s"},
+		{1000e3, "1.0 MB/s"},
+		{1050e3, "1.1 MB/s"},
+		{12.4e6, "12 MB/s"},
+		{12.6e6, "13 MB/s"},
+		{999e6, "999 MB/s"},
+		{1e9, "1.0 GB/s"},
+		{1e12, "1.0 TB/s"},
+		// There's no tier above TB/s.
+		{5e15, "5000 TB/s"},
+	} {
+		r := unit.Datarate(tc.bytes) * unit.BytePerSecond
+		if got := byterateSI(r); got != tc.want {
+			t.Errorf("byterateSI(%v B/s) = %q, want %q", tc.bytes, got, tc.want)
+		}
+	}
+}
+
+func TestByterateBits(t *testing.T) {
+	for _, tc := range []struct {
+		bits float64
+		want string
+	}{
+		{999, "999 bps"},
+		{1000, "1.0 Kbps"},
+		{999.6e3, "1.0 Mbps"},
+		{100e6, "100 Mbps"},
+		{1e9, "1.0 Gbps"},
+	} {
+		if got := byterateBits(unit.Datarate(tc.bits) * unit.BitPerSecond); got != tc.want {
+			t.Errorf("byterateBits(%v bps) = %q, want %q", tc.bits, got, tc.want)
+		}
+	}
+	// 125 kB/s is a megabit.
+	if got := formatRate(125e3*unit.BytePerSecond, rateBits); got != "1.0 Mbps" {
+		t.Errorf("formatRate in bits = %q", got)
+	}
+	if got := formatRate(125e3*unit.BytePerSecond, rateSI); got != "125 kB/s" {
+		t.Errorf("formatRate in SI = %q", got)
+	}
+}
+
+func TestPeakRate(t *testing.T) {
+	var p peakRate
+	for _, tc := range []struct{ r, want unit.Datarate }{
+		{10, 10}, {5, 10}, {20, 20}, {0, 20},
+	} {
+		if got := p.Update(tc.r); got != tc.want {
+			t.Errorf("Update(%v) = %v, want %v", tc.r, got, tc.want)
+		}
+	}
+	if p.Get() != 20 {
+		t.Errorf("Get() = %v", p.Get())
+	}
+
+	// With a reset interval, the peak is forgotten after it.
+	p = peakRate{resetInterval: 20 * time.Millisecond}
+	p.Update(100)
+	if got := p.Update(10); got != 100 {
+		t.Errorf("within the interval: got %v, want 100", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := p.Update(10); got != 10 {
+		t.Errorf("after the interval: got %v, want 10", got)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/funcs"
+)
+
+// recordingProcesses are the names of screen recorders. A recorder that's
+// running is assumed to be recording.
+var recordingProcesses = []string{
+	"obs", "wf-recorder", "simplescreenrecorder", "kazam", "peek",
+	"gpu-screen-recorder", "vokoscreenNG",
+}
+
+// recordingGrabbers are the ffmpeg inputs that capture the screen, since
+// ffmpeg on its own is just as likely to be converting a file.
+var recordingGrabbers = []string{"x11grab", "kmsgrab"}
+
+// recordingPollInterval is how often processes are checked for recorders.
+var recordingPollInterval = 3 * time.Second
+
+// screenRecorder returns the name of a running screen recorder, if any.
+func screenRecorder() (string, bool) {
+	comms, _ := filepath.Glob("/proc/[0-9]*/comm")
+	for _, path := range comms {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSpace(string(data))
+		for _, r := range recordingProcesses {
+			// comm is truncated to 15 characters.
+			if name == r || len(name) == 15 && strings.HasPrefix(r, name) {
+				return r, true
+			}
+		}
+		if name != "ffmpeg" {
+			continue
+		}
+		cmdline, _ := ioutil.ReadFile(filepath.Join(filepath.Dir(path), "cmdline"))
+		for _, arg := range strings.Split(string(cmdline), "\x00") {
+			for _, g := range recordingGrabbers {
+				if arg == g {
+					return name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// newRecordingModule blinks while the screen is being recorded.
+func newRecordingModule() *funcs.RepeatingModule {
+	return pollEvery(recordingPollInterval, func(s bar.Sink) {
+		name, ok := screenRecorder()
+		if !ok {
+			s.Output(nil)
+			return
+		}
+		s.Output(recordingOutput(name))
+	})
+}
@@ -0,0 +1,25 @@
+package main
+
+import "sync"
+
+var refreshMu sync.Mutex
+var refreshers []func()
+
+// onRefresh calls f whenever every module should update straight away,
+// rather than at its next interval: after a resume from suspend, or when
+// the colours or display profile change.
+func onRefresh(f func()) {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+	refreshers = append(refreshers, f)
+}
+
+// refreshModules updates every module registered with onRefresh.
+func refreshModules() {
+	refreshMu.Lock()
+	fs := append([]func(){}, refreshers...)
+	refreshMu.Unlock()
+	for _, f := range fs {
+		f()
+	}
+}
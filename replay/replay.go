@@ -0,0 +1,217 @@
+// Package replay records the outputs of a module over time, so that they
+// can be saved and replayed later, e.g. to reproduce timing issues or to
+// replay hours of battery drain in a test in under a second.
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+// Segment is the serialisable part of a bar.Segment. Click handlers can't
+// be recorded, so replayed segments aren't clickable.
+type Segment struct {
+	Text   string `json:"text"`
+	Pango  bool   `json:"pango,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Urgent bool   `json:"urgent,omitempty"`
+}
+
+// Entry is one output, at an offset from the start of recording.
+type Entry struct {
+	Offset   time.Duration `json:"offset"`
+	Segments []Segment     `json:"segments"`
+}
+
+// Capture returns the serialisable parts of out's segments.
+func Capture(out bar.Output) []Segment {
+	if out == nil {
+		return nil
+	}
+	var res []Segment
+	for _, s := range out.Segments() {
+		text, isPango := s.Content()
+		seg := Segment{Text: text, Pango: isPango}
+		if c, ok := s.GetColor(); ok && c != nil {
+			seg.Color = hexColor(c)
+		}
+		seg.Urgent, _ = s.IsUrgent()
+		res = append(res, seg)
+	}
+	return res
+}
+
+func fromSegments(segments []Segment) bar.Output {
+	if len(segments) == 0 {
+		return nil
+	}
+	var out bar.Segments
+	for _, s := range segments {
+		seg := bar.TextSegment(s.Text)
+		if s.Pango {
+			seg = bar.PangoSegment(s.Text)
+		}
+		if c, ok := parseHexColor(s.Color); ok {
+			seg.Color(c)
+		}
+		if s.Urgent {
+			seg.Urgent(true)
+		}
+		out = append(out, seg)
+	}
+	return out
+}
+
+func hexColor(c color.Color) string {
+	r, g, b, a := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x%02x", r>>8, g>>8, b>>8, a>>8)
+}
+
+func parseHexColor(s string) (color.Color, bool) {
+	var c color.RGBA
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A); err != nil {
+		return nil, false
+	}
+	return c, true
+}
+
+// Recorder wraps a module, passing its outputs through while keeping a
+// timestamped log of them.
+type Recorder struct {
+	module bar.Module
+	mu     sync.Mutex
+	start  time.Time
+	log    []Entry
+	raw    []bar.Output
+}
+
+// Record wraps module in a Recorder, which starts recording when it's
+// streamed.
+func Record(module bar.Module) *Recorder {
+	return &Recorder{module: module}
+}
+
+// Stream streams the wrapped module, recording each output.
+func (r *Recorder) Stream(sink bar.Sink) {
+	r.mu.Lock()
+	r.start = time.Now()
+	r.mu.Unlock()
+	r.module.Stream(func(out bar.Output) {
+		r.mu.Lock()
+		r.log = append(r.log, Entry{
+			Offset:   time.Since(r.start),
+			Segments: Capture(out),
+		})
+		r.raw = append(r.raw, out)
+		r.mu.Unlock()
+		sink.Output(out)
+	})
+}
+
+// Entries returns a copy of the log so far.
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Entry(nil), r.log...)
+}
+
+// SaveTo writes the log so far to path as JSON.
+func (r *Recorder) SaveTo(path string) error {
+	data, err := json.MarshalIndent(r.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// OutputExpectation is the set of matchers that one recorded output must
+// satisfy.
+type OutputExpectation []baristatest.OutputMatcher
+
+// Expect builds an expectation for one output.
+func Expect(matchers ...baristatest.OutputMatcher) OutputExpectation {
+	return matchers
+}
+
+// Assert checks that the recorded outputs match the expectations, one
+// expectation per output, in order.
+func (r *Recorder) Assert(t *testing.T, expectations ...OutputExpectation) {
+	t.Helper()
+	r.mu.Lock()
+	outputs := append([]bar.Output(nil), r.raw...)
+	r.mu.Unlock()
+	if len(outputs) != len(expectations) {
+		t.Errorf("got %d outputs, want %d", len(outputs), len(expectations))
+	}
+	for i := 0; i < len(outputs) && i < len(expectations); i++ {
+		var segments []*bar.Segment
+		if outputs[i] != nil {
+			segments = outputs[i].Segments()
+		}
+		for _, m := range expectations[i] {
+			if msg := m(segments); msg != "" {
+				t.Errorf("output %d: %s", i, msg)
+			}
+		}
+	}
+}
+
+// Player replays a saved log as a module.
+type Player struct {
+	path    string
+	speedup float64
+}
+
+// Replay returns a module that emits the outputs saved at path, at their
+// original intervals.
+func Replay(path string) *Player {
+	return &Player{path: path, speedup: 1}
+}
+
+// WithSpeedup replays factor times faster than the outputs were recorded.
+func (p *Player) WithSpeedup(factor float64) *Player {
+	if factor > 0 {
+		p.speedup = factor
+	}
+	return p
+}
+
+// Load reads a saved log.
+func Load(path string) ([]Entry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// delay returns how long after the start of replay an entry at offset
+// should be emitted.
+func (p *Player) delay(offset time.Duration) time.Duration {
+	return time.Duration(float64(offset) / p.speedup)
+}
+
+// Stream emits the saved outputs, then returns.
+func (p *Player) Stream(sink bar.Sink) {
+	entries, err := Load(p.path)
+	if sink.Error(err) {
+		return
+	}
+	start := time.Now()
+	for _, e := range entries {
+		time.Sleep(time.Until(start.Add(p.delay(e.Offset))))
+		sink.Output(fromSegments(e.Segments))
+	}
+}
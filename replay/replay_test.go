@@ -0,0 +1,149 @@
+package replay
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/outputs"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+// scripted emits its outputs in order, then returns.
+type scripted []bar.Output
+
+func (s scripted) Stream(sink bar.Sink) {
+	for _, o := range s {
+		sink.Output(o)
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+var script = scripted{
+	outputs.Text("80%").Color(colors.Hex("#50fa7b")),
+	bar.PangoSegment("<b>20%</b>").Urgent(true),
+	nil,
+	outputs.Group(outputs.Text("5%"), outputs.Text("12m").Color(colors.Hex("#ff5555"))),
+}
+
+func record(t *testing.T) (*Recorder, string) {
+	t.Helper()
+	r := Record(script)
+	var passed []bar.Output
+	r.Stream(func(o bar.Output) { passed = append(passed, o) })
+	if len(passed) != len(script) {
+		t.Fatalf("passed on %d outputs, want %d", len(passed), len(script))
+	}
+	path := filepath.Join(t.TempDir(), "log.json")
+	if err := r.SaveTo(path); err != nil {
+		t.Fatal(err)
+	}
+	return r, path
+}
+
+func TestRoundTrip(t *testing.T) {
+	r, path := record(t)
+	entries, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, r.Entries()) {
+		t.Errorf("loaded %+v, saved %+v", entries, r.Entries())
+	}
+	want := []Segment{{Text: "<b>20%</b>", Pango: true, Urgent: true}}
+	if !reflect.DeepEqual(entries[1].Segments, want) {
+		t.Errorf("pango entry: got %+v, want %+v", entries[1].Segments, want)
+	}
+	if entries[2].Segments != nil {
+		t.Errorf("nil output saved as %+v", entries[2].Segments)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Offset <= entries[i-1].Offset {
+			t.Errorf("offsets out of order: %v then %v", entries[i-1].Offset, entries[i].Offset)
+		}
+	}
+
+	// Replayed outputs capture the same as the originals.
+	var replayed [][]Segment
+	Replay(path).WithSpeedup(100).Stream(func(o bar.Output) {
+		replayed = append(replayed, Capture(o))
+	})
+	var recorded [][]Segment
+	for _, e := range entries {
+		recorded = append(recorded, e.Segments)
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed %+v, want %+v", replayed, recorded)
+	}
+
+	r.Assert(t,
+		Expect(baristatest.SegmentText(0, "80%"), baristatest.Color(0, colors.Hex("#50fa7b"))),
+		Expect(baristatest.IsUrgent(0)),
+		Expect(baristatest.Empty()),
+		Expect(baristatest.SegmentCount(2), baristatest.SegmentText(1, "12m")),
+	)
+}
+
+func TestSpeedup(t *testing.T) {
+	for _, tc := range []struct {
+		factors []float64
+		offset  time.Duration
+		want    time.Duration
+	}{
+		{nil, time.Minute, time.Minute},
+		{[]float64{2}, time.Minute, 30 * time.Second},
+		{[]float64{0.5}, time.Minute, 2 * time.Minute},
+		{[]float64{3600}, 3 * time.Hour, 3 * time.Second},
+		// Factors that aren't positive are ignored.
+		{[]float64{4, 0}, time.Minute, 15 * time.Second},
+		{[]float64{-2}, time.Minute, time.Minute},
+	} {
+		p := Replay("unused")
+		for _, f := range tc.factors {
+			p.WithSpeedup(f)
+		}
+		if got := p.delay(tc.offset); got != tc.want {
+			t.Errorf("speedups %v: delay(%v) = %v, want %v", tc.factors, tc.offset, got, tc.want)
+		}
+	}
+}
+
+func TestReplayHoursQuickly(t *testing.T) {
+	var entries []Entry
+	for i := 0; i <= 60; i++ {
+		entries = append(entries, Entry{
+			Offset:   time.Duration(i) * time.Minute,
+			Segments: []Segment{{Text: "battery"}},
+		})
+	}
+	data, _ := json.Marshal(entries)
+	path := filepath.Join(t.TempDir(), "drain.json")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	n := 0
+	Replay(path).WithSpeedup(10000).Stream(func(bar.Output) { n++ })
+	if took := time.Since(start); n != len(entries) || took > time.Second || took < 300*time.Millisecond {
+		t.Errorf("replayed %d outputs in %v, want %d in about 360ms", n, took, len(entries))
+	}
+}
+
+func TestReplayBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.json")
+	ioutil.WriteFile(path, []byte("not json"), 0644)
+	var got []bar.Output
+	Replay(path).Stream(func(o bar.Output) { got = append(got, o) })
+	if len(got) != 1 || got[0] == nil {
+		t.Fatalf("got %v, want an error output", got)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("no error loading a missing file")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/clock"
+	"barista.run/modules/funcs"
+	"github.com/godbus/dbus/v5"
+	"golang.org/x/sys/unix"
+)
+
+// resumeCheckInterval is how often the clocks are compared to detect a
+// resume from suspend when logind isn't available.
+var resumeCheckInterval = 10 * time.Second
+
+// resumeMinSleep is how long the clocks must have drifted apart to count
+// as a suspend.
+const resumeMinSleep = 5 * time.Second
+
+func resumed() {
+	logInfof("Resumed from suspend, refreshing")
+	refreshModules()
+}
+
+// pollEvery is funcs.Every, but also refreshes with refreshModules, e.g.
+// straight after a resume from suspend, since its timer doesn't count time
+// spent asleep and would otherwise leave stale data in the bar for up to a
+// whole interval.
+func pollEvery(interval time.Duration, f funcs.Func) *funcs.RepeatingModule {
+	m := funcs.Every(interval, f)
+	onRefresh(m.Refresh)
+	return m
+}
+
+// clockEvery is c.Output, but also redraws the clock with refreshModules,
+// so that e.g. a clock that ticks every minute doesn't show the time from
+// before a suspend for up to a minute after it.
+func clockEvery(c *clock.Module, granularity time.Duration, f func(time.Time) bar.Output) *clock.Module {
+	c.Output(granularity, f)
+	onRefresh(func() { c.Output(granularity, f) })
+	return c
+}
+
+// watchResume detects resumes from suspend through logind's PrepareForSleep
+// signal, or by watching CLOCK_BOOTTIME, which counts time asleep, move
+// ahead of CLOCK_MONOTONIC, which doesn't.
+func watchResume() {
+	if err := watchPrepareForSleep(); err != nil {
+		logDebugf("No logind sleep signal, comparing clocks instead: %v", err)
+	}
+	watchSleepClock(sleptFor, time.Tick(resumeCheckInterval))
+}
+
+// watchSleepClock calls resumed whenever the time spent asleep, as returned
+// by slept and checked on every tick, has grown by resumeMinSleep or more.
+func watchSleepClock(slept func() (time.Duration, bool), ticks <-chan time.Time) {
+	last, ok := slept()
+	if !ok {
+		logWarnf("Cannot detect resume from suspend")
+		return
+	}
+	for range ticks {
+		cur, _ := slept()
+		if cur-last >= resumeMinSleep {
+			resumed()
+		}
+		last = cur
+	}
+}
+
+// sleptFor returns the total time spent suspended since boot.
+func sleptFor() (time.Duration, bool) {
+	var boot, mono unix.Timespec
+	if unix.ClockGettime(unix.CLOCK_BOOTTIME, &boot) != nil ||
+		unix.ClockGettime(unix.CLOCK_MONOTONIC, &mono) != nil {
+		return 0, false
+	}
+	return time.Duration(boot.Nano() - mono.Nano()), true
+}
+
+// watchPrepareForSleep calls resumed when logind signals the end of a
+// sleep, returning only if the signal can't be subscribed to or the system
+// bus connection is lost.
+func watchPrepareForSleep() error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return err
+	}
+	err = conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.login1.Manager"),
+		dbus.WithMatchMember("PrepareForSleep"),
+	)
+	if err != nil {
+		return err
+	}
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+	for sig := range signals {
+		// The argument is true going to sleep and false on waking.
+		if len(sig.Body) > 0 && sig.Body[0] == false {
+			resumed()
+		}
+	}
+	return errors.New("lost the system bus connection")
+}
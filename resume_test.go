@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+)
+
+func TestResumeRefreshesPolledModules(t *testing.T) {
+	restoreRefreshers(t)
+	var polls int32
+	m := pollEvery(time.Hour, func(bar.Sink) { atomic.AddInt32(&polls, 1) })
+	go m.Stream(func(bar.Output) {})
+	waitForPolls := func(want int32) bool {
+		for end := time.Now().Add(time.Second); time.Now().Before(end); time.Sleep(time.Millisecond) {
+			if atomic.LoadInt32(&polls) >= want {
+				return true
+			}
+		}
+		return false
+	}
+	if !waitForPolls(1) {
+		t.Fatal("not polled on start")
+	}
+
+	// A fake CLOCK_BOOTTIME - CLOCK_MONOTONIC, moved on by the test.
+	var mu sync.Mutex
+	var asleep time.Duration
+	sleep := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		asleep += d
+	}
+	slept := func() (time.Duration, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		return asleep, true
+	}
+	ticks := make(chan time.Time)
+	done := make(chan struct{})
+	go func() {
+		watchSleepClock(slept, ticks)
+		close(done)
+	}()
+
+	// Clock drift is not a suspend.
+	sleep(time.Second)
+	ticks <- time.Now()
+	if waitForPolls(2) {
+		t.Fatal("refreshed without a suspend")
+	}
+	sleep(10 * time.Minute)
+	ticks <- time.Now()
+	if !waitForPolls(2) {
+		t.Fatal("not polled again after resuming, only on the hourly tick")
+	}
+	close(ticks)
+	<-done
+}
+
+func TestWatchSleepClockUnsupported(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		watchSleepClock(func() (time.Duration, bool) { return 0, false }, make(chan time.Time))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("still watching clocks that can't be read")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// retryAttempts is how many times a flaky network call is tried.
+const retryAttempts = 3
+
+// retryBaseDelay is the wait after the first failure, doubled after each
+// further failure and jittered so that modules don't retry in lockstep.
+var retryBaseDelay = time.Second
+
+// retryDeadline bounds the total time spent on all attempts.
+const retryDeadline = 30 * time.Second
+
+// retry calls f until it succeeds, up to retryAttempts times with
+// exponential backoff, returning the last error. f should use ctx for its
+// requests so that the deadline applies to them too. Errors that another
+// attempt won't fix, e.g. a bad API key, are returned straight away.
+func retry(what string, f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), retryDeadline)
+	defer cancel()
+	delay := retryBaseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = f(ctx); err == nil {
+			return nil
+		}
+		if attempt == retryAttempts || !retryable(err) {
+			return err
+		}
+		// Between half and one and a half times the delay.
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay)))
+		logDebugf("%s failed (attempt %d of %d), retrying in %v: %v",
+			what, attempt, retryAttempts, wait.Round(time.Millisecond), err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// retryable returns false for client errors, which will fail the same way
+// again, apart from timeouts and rate limiting.
+func retryable(err error) bool {
+	var status *httpStatusError
+	if !errors.As(err, &status) || status.code < 400 || status.code >= 500 {
+		return true
+	}
+	return status.code == http.StatusRequestTimeout || status.code == http.StatusTooManyRequests
+}
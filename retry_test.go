@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"barista.run/modules/weather"
+)
+
+func fastRetries(t *testing.T) {
+	d := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = d })
+}
+
+func TestRetryFailsTwiceThenSucceeds(t *testing.T) {
+	fastRetries(t)
+	calls := 0
+	err := retry("test", func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("no deadline on the context")
+		}
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("attempt %d failed", calls)
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("got %v after %d calls, want success on the third", err, calls)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	fastRetries(t)
+	calls := 0
+	err := retry("test", func(context.Context) error {
+		calls++
+		return fmt.Errorf("attempt %d failed", calls)
+	})
+	if calls != retryAttempts || err == nil || err.Error() != fmt.Sprintf("attempt %d failed", retryAttempts) {
+		t.Errorf("got %v after %d calls, want the last error after %d", err, calls, retryAttempts)
+	}
+}
+
+// owmServer serves the given statuses in turn, then the current weather.
+func owmServer(t *testing.T, statuses ...int) (hits *int32) {
+	hits = new(int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(hits, 1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		fmt.Fprint(w, `{
+			"weather": [{"id": 500, "main": "Rain", "description": "light rain"}],
+			"main": {"temp": 288.15, "pressure": 1012, "humidity": 82},
+			"wind": {"speed": 4.1, "deg": 240},
+			"clouds": {"all": 75},
+			"dt": 1780318800,
+			"sys": {"sunrise": 1780285740, "sunset": 1780344960}
+		}`)
+	}))
+	t.Cleanup(srv.Close)
+	u := owmURL
+	owmURL = srv.URL
+	t.Cleanup(func() { owmURL = u })
+	return hits
+}
+
+func TestOWMRetries(t *testing.T) {
+	fastRetries(t)
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		hits     int32
+		ok       bool
+	}{
+		{"server errors", []int{http.StatusBadGateway, http.StatusServiceUnavailable}, 3, true},
+		{"rate limited", []int{http.StatusTooManyRequests}, 2, true},
+		{"bad key", []int{http.StatusUnauthorized}, 1, false},
+		{"not found", []int{http.StatusNotFound}, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hits := owmServer(t, tc.statuses...)
+			var w weather.Weather
+			err := retry("OpenWeatherMap", func(ctx context.Context) (err error) {
+				w, err = owmGetWeather(ctx, "key", 51.5, -0.13)
+				return err
+			})
+			if got := atomic.LoadInt32(hits); got != tc.hits {
+				t.Errorf("%d requests, want %d", got, tc.hits)
+			}
+			if (err == nil) != tc.ok {
+				t.Fatalf("got error %v", err)
+			}
+			if !tc.ok {
+				var status *httpStatusError
+				if !errors.As(err, &status) || status.code != tc.statuses[0] {
+					t.Errorf("got %v, want status %d", err, tc.statuses[0])
+				}
+				return
+			}
+			if w.Condition != weather.Rain || w.Description != "light rain" ||
+				fmt.Sprintf("%.1f", w.Temperature.Celsius()) != "15.0" || w.Humidity != 0.82 {
+				t.Errorf("got %+v", w)
+			}
+		})
+	}
+}
+
+func TestOWMHonoursDeadline(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { <-block }))
+	defer srv.Close()
+	defer close(block)
+	defer func(u string) { owmURL = u }(owmURL)
+	owmURL = srv.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := owmGetWeather(ctx, "key", 0, 0); err == nil {
+		t.Fatal("no error from a hung server")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %v, past the context's deadline", elapsed)
+	}
+}
+
+func TestOWMCondition(t *testing.T) {
+	for id, want := range map[int]weather.Condition{
+		211: weather.Thunderstorm,
+		301: weather.Drizzle,
+		511: weather.Sleet,
+		502: weather.Rain,
+		613: weather.Sleet,
+		601: weather.Snow,
+		741: weather.Fog,
+		800: weather.Clear,
+		801: weather.PartlyCloudy,
+		804: weather.Overcast,
+		999: weather.ConditionUnknown,
+	} {
+		if got := owmCondition(id); got != want {
+			t.Errorf("owmCondition(%d) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestAPIKeySet(t *testing.T) {
+	if apiKeySet(owmAPIKey) || apiKeySet("") {
+		t.Error("placeholder counted as a key")
+	}
+	if !apiKeySet("0123456789abcdef") {
+		t.Error("real key not counted")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// checkEnv verifies the environment and exits instead of starting the bar.
+var checkEnv = flag.Bool("check", false,
+	"check that the environment has everything the bar needs, then exit")
+
+type envCheck struct {
+	Name string
+	// Critical checks make the bar unusable if they fail; the others only
+	// hide or degrade some modules.
+	Critical bool
+	Run      func() error
+}
+
+var envChecks = []envCheck{
+	{"icon font", true, func() error {
+		_, err := os.Stat(iconFontDir)
+		return err
+	}},
+	{"df on PATH", true, lookPath("df")},
+	{"realpath on PATH", true, lookPath("realpath")},
+	{"kubectl on PATH", false, lookPath("kubectl")},
+	{"keyring reachable", false, func() error {
+		u, err := user.Current()
+		if err != nil {
+			return err
+		}
+		if _, err := keyring.Get(oauthKeyringService, u.Username); err != keyring.ErrNotFound {
+			return err
+		}
+		return nil
+	}},
+	{"OpenWeatherMap key set", false, func() error {
+		if !apiKeySet(owmAPIKey) {
+			return fmt.Errorf("owmAPIKey is still the placeholder %s", owmAPIKey)
+		}
+		return nil
+	}},
+	{"geolocation reachable", false, func() error {
+		c := http.Client{Timeout: 5 * time.Second}
+		resp, err := c.Get(geoipURL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: %s", geoipURL, resp.Status)
+		}
+		return nil
+	}},
+}
+
+func lookPath(file string) func() error {
+	return func() error {
+		_, err := exec.LookPath(file)
+		return err
+	}
+}
+
+// runEnvChecks prints a report of each check, and returns false if any
+// critical check failed.
+func runEnvChecks() bool {
+	ok := true
+	for _, c := range envChecks {
+		err := c.Run()
+		switch {
+		case err == nil:
+			fmt.Printf("PASS  %s\n", c.Name)
+		case c.Critical:
+			ok = false
+			fmt.Printf("FAIL  %s: %v\n", c.Name, err)
+		default:
+			fmt.Printf("WARN  %s: %v\n", c.Name, err)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// sessionBreakAfter is how long a login session can run before it's shown
+// as degraded, as a reminder to take a break.
+var sessionBreakAfter = 8 * time.Hour
+
+type sessionInfo struct {
+	User            string
+	TTY             string
+	LoginTime       time.Time
+	SessionDuration time.Duration
+}
+
+type whoEntry struct {
+	User      string
+	TTY       string
+	LoginTime time.Time
+	// Host is the parenthesised comment, which for X11 sessions and
+	// terminals inside them is the display, e.g. ":0".
+	Host string
+}
+
+// parseWho parses `who -u` output. Login times are in local time, either
+// ISO ("2024-01-10 09:12") or traditional ("Jan 10 09:12", in which case
+// the year is taken from now).
+func parseWho(out string, now time.Time) []whoEntry {
+	var entries []whoEntry
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		e := whoEntry{User: fields[0], TTY: fields[1]}
+		rest := fields[2:]
+		if t, err := time.ParseInLocation("2006-01-02 15:04", rest[0]+" "+rest[1], now.Location()); err == nil {
+			e.LoginTime = t
+			rest = rest[2:]
+		} else if len(rest) >= 3 {
+			t, err := time.ParseInLocation("Jan 2 15:04", rest[0]+" "+rest[1]+" "+rest[2], now.Location())
+			if err != nil {
+				continue
+			}
+			e.LoginTime = t.AddDate(now.Year(), 0, 0)
+			if e.LoginTime.After(now) {
+				// Logged in last year.
+				e.LoginTime = e.LoginTime.AddDate(-1, 0, 0)
+			}
+			rest = rest[3:]
+		} else {
+			continue
+		}
+		if len(rest) > 0 && strings.HasPrefix(rest[len(rest)-1], "(") {
+			e.Host = strings.Trim(rest[len(rest)-1], "()")
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// currentSession picks the entry for this session from entries: the one on
+// $DISPLAY for X11 sessions, or the controlling TTY otherwise. If neither
+// matches, the user's earliest session is used.
+func currentSession(entries []whoEntry, username, display, tty string) (whoEntry, bool) {
+	var earliest whoEntry
+	found := false
+	for _, e := range entries {
+		if e.User != username {
+			continue
+		}
+		if display != "" && (e.TTY == display || e.Host == display) {
+			return e, true
+		}
+		if tty != "" && e.TTY == tty {
+			return e, true
+		}
+		if !found || e.LoginTime.Before(earliest.LoginTime) {
+			earliest, found = e, true
+		}
+	}
+	return earliest, found
+}
+
+// controllingTTY returns the terminal on stdin without the /dev/ prefix,
+// e.g. "tty1" or "pts/0".
+func controllingTTY() string {
+	dev, err := os.Readlink("/proc/self/fd/0")
+	if err != nil || !strings.HasPrefix(dev, "/dev/") {
+		return ""
+	}
+	return strings.TrimPrefix(dev, "/dev/")
+}
+
+// loginSession returns the current user's login session from `who -u`.
+func loginSession(now time.Time) (sessionInfo, bool) {
+	usr, err := user.Current()
+	if err != nil {
+		return sessionInfo{}, false
+	}
+	out, err := quickOutput("who", "-u")
+	if err != nil {
+		return sessionInfo{}, false
+	}
+	e, ok := currentSession(parseWho(string(out), now),
+		usr.Username, os.Getenv("DISPLAY"), controllingTTY())
+	if !ok {
+		return sessionInfo{}, false
+	}
+	return sessionInfo{
+		User:            e.User,
+		TTY:             e.TTY,
+		LoginTime:       e.LoginTime,
+		SessionDuration: now.Sub(e.LoginTime),
+	}, true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+func TestParseWho(t *testing.T) {
+	now := time.Date(2026, 10, 17, 18, 30, 0, 0, time.UTC)
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(now.Year(), month, day, hour, min, 0, 0, time.UTC)
+	}
+	for _, tc := range []struct {
+		name string
+		out  string
+		want []whoEntry
+	}{{
+		name: "X11",
+		out: "chris    :0           2026-10-17 09:12   ?          1422 (:0)\n" +
+			"chris    pts/1        2026-10-17 10:03 00:05        2210 (:0)\n",
+		want: []whoEntry{
+			{User: "chris", TTY: ":0", LoginTime: at(10, 17, 9, 12), Host: ":0"},
+			{User: "chris", TTY: "pts/1", LoginTime: at(10, 17, 10, 3), Host: ":0"},
+		},
+	}, {
+		name: "virtual terminals",
+		out: "chris    tty1         2026-10-17 08:00   .          1001\n" +
+			"root     tty2         2026-10-16 23:45  old          1090\n",
+		want: []whoEntry{
+			{User: "chris", TTY: "tty1", LoginTime: at(10, 17, 8, 0)},
+			{User: "root", TTY: "tty2", LoginTime: at(10, 16, 23, 45)},
+		},
+	}, {
+		name: "traditional dates",
+		out: "chris    tty7         Oct 17 07:55   .          1300 (:1)\n" +
+			// In the future for this year, so it was last year's.
+			"chris    pts/0        Dec 31 23:10 old          1500 (10.0.0.4)\n",
+		want: []whoEntry{
+			{User: "chris", TTY: "tty7", LoginTime: at(10, 17, 7, 55), Host: ":1"},
+			{User: "chris", TTY: "pts/0", LoginTime: time.Date(2025, 12, 31, 23, 10, 0, 0, time.UTC), Host: "10.0.0.4"},
+		},
+	}, {
+		name: "junk",
+		out:  "\nchris tty1\nchris tty1 yesterday at noon\n",
+	}} {
+		if got := parseWho(tc.out, now); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCurrentSession(t *testing.T) {
+	day := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	entries := []whoEntry{
+		{User: "root", TTY: "tty2", LoginTime: day.Add(1 * time.Hour)},
+		{User: "chris", TTY: "tty1", LoginTime: day.Add(8 * time.Hour)},
+		{User: "chris", TTY: ":0", LoginTime: day.Add(9 * time.Hour), Host: ":0"},
+		{User: "chris", TTY: "pts/1", LoginTime: day.Add(10 * time.Hour), Host: ":1"},
+	}
+	for _, tc := range []struct {
+		user, display, tty string
+		want               string
+	}{
+		{"chris", ":0", "", ":0"},
+		{"chris", ":1", "", "pts/1"},
+		{"chris", "", "tty1", "tty1"},
+		{"chris", ":5", "pts/9", "tty1"},
+		{"root", ":0", "", "tty2"},
+		{"nobody", "", "tty1", ""},
+	} {
+		e, ok := currentSession(entries, tc.user, tc.display, tc.tty)
+		if e.TTY != tc.want || ok != (tc.want != "") {
+			t.Errorf("%s on %q/%q: got %q, %v, want %q", tc.user, tc.display, tc.tty, e.TTY, ok, tc.want)
+		}
+	}
+}
+
+func TestSessionOutput(t *testing.T) {
+	baristatest.AssertOutput(t, sessionOutput, sessionInfo{SessionDuration: 7*time.Hour + 59*time.Minute},
+		baristatest.SegmentContains(0, "7:59"), baristatest.Color(0, nil))
+	baristatest.AssertOutput(t, sessionOutput, sessionInfo{SessionDuration: 8 * time.Hour},
+		baristatest.SegmentContains(0, "8:00"), baristatest.Color(0, themeColor("degraded")))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/funcs"
+	"barista.run/outputs"
+)
+
+// shellStderrModule is like shell.New, but passes the command's stderr to
+// the output function alongside its stdout.
+type shellStderrModule struct {
+	cmd      string
+	args     []string
+	interval time.Duration
+	output   func(stdout, stderr string) bar.Output
+	// timeout is how long each run may take before it's killed and
+	// timeoutOutput is shown instead.
+	timeout       time.Duration
+	timeoutOutput func(elapsed time.Duration) bar.Output
+	// failed is set for the output function's benefit when the command
+	// exits non-zero.
+	failed bool
+	cache  outputCache
+
+	mu     sync.Mutex
+	paused bool
+	poll   *funcs.RepeatingModule
+}
+
+// newShellWithStderr runs cmd once, or periodically if Every is used. By
+// default stdout is shown as is, or stderr as an urgent segment if the
+// command fails.
+func newShellWithStderr(cmd string, args ...string) *shellStderrModule {
+	s := &shellStderrModule{cmd: cmd, args: args, timeout: execTimeout}
+	s.output = s.defaultOutput
+	s.timeoutOutput = defaultTimeoutOutput
+	return s
+}
+
+// WithTimeout kills each run of the command that takes longer than d,
+// instead of the default execTimeout.
+func (s *shellStderrModule) WithTimeout(d time.Duration) *shellStderrModule {
+	s.timeout = d
+	return s
+}
+
+// WithTimeoutOutput sets the function that builds the output when a run
+// is killed for taking too long.
+func (s *shellStderrModule) WithTimeoutOutput(f func(elapsed time.Duration) bar.Output) *shellStderrModule {
+	s.timeoutOutput = f
+	return s
+}
+
+func defaultTimeoutOutput(time.Duration) bar.Output {
+	return outputs.Text("timed out").Urgent(true)
+}
+
+// Every runs the command every interval.
+func (s *shellStderrModule) Every(interval time.Duration) *shellStderrModule {
+	s.interval = interval
+	return s
+}
+
+// Output sets the function that builds the output from the trimmed stdout
+// and stderr of each run.
+func (s *shellStderrModule) Output(f func(stdout, stderr string) bar.Output) *shellStderrModule {
+	s.output = f
+	return s
+}
+
+func (s *shellStderrModule) defaultOutput(stdout, stderr string) bar.Output {
+	if s.failed && stderr != "" {
+		return outputs.Text(truncate(strings.SplitN(stderr, "\n", 2)[0], 50)).Urgent(true)
+	}
+	return outputs.Text(stdout)
+}
+
+// Stream runs the command.
+func (s *shellStderrModule) Stream(sink bar.Sink) {
+	run := func(sink bar.Sink) {
+		s.mu.Lock()
+		paused := s.paused
+		s.mu.Unlock()
+		if paused {
+			return
+		}
+		start := time.Now()
+		stdout, stderr, err := runWithStderr(s.timeout, s.cmd, s.args...)
+		if err == errTimedOut {
+			logWarnf("%s timed out after %v", s.cmd, s.timeout)
+			s.cache.Reset()
+			sink.Output(s.timeoutOutput(time.Since(start)))
+			return
+		}
+		s.failed = err != nil
+		// Most runs print the same thing, so only new output is sent.
+		out, fresh := s.cache.Get([]interface{}{stdout, stderr, s.failed}, func() bar.Output {
+			return s.output(stdout, stderr)
+		})
+		if fresh {
+			sink.Output(out)
+		}
+	}
+	if s.interval > 0 {
+		poll := pollEvery(s.interval, run)
+		s.mu.Lock()
+		s.poll = poll
+		s.mu.Unlock()
+		poll.Stream(sink)
+	} else {
+		funcs.Once(run).Stream(sink)
+	}
+}
+
+// Pause stops running the command until Resume is called, keeping the
+// last output.
+func (s *shellStderrModule) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume runs the command again straight away, and then every interval.
+func (s *shellStderrModule) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+	if s.poll != nil {
+		s.poll.Refresh()
+	}
+}
+
+// runWithStderr runs cmd, killing it after timeout, and returns its
+// trimmed stdout and stderr, or errTimedOut.
+func runWithStderr(timeout time.Duration, cmd string, args ...string) (stdout, stderr string, err error) {
+	var outBuf, errBuf bytes.Buffer
+	c := timeoutCommand(timeout, cmd, args...)
+	c.Stdout = &outBuf
+	c.Stderr = &errBuf
+	err = c.Run()
+	return strings.TrimSpace(outBuf.String()), strings.TrimSpace(errBuf.String()), err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+// runShell streams m, which runs its command once, and returns its
+// output.
+func runShell(t *testing.T, m *shellStderrModule) bar.Output {
+	t.Helper()
+	var got []bar.Output
+	m.Stream(func(o bar.Output) { got = append(got, o) })
+	if len(got) != 1 {
+		t.Fatalf("got %d outputs, want 1", len(got))
+	}
+	return got[0]
+}
+
+func TestShellStderrOutputFunc(t *testing.T) {
+	for _, tc := range []struct {
+		script         string
+		stdout, stderr string
+	}{
+		{"echo out", "out", ""},
+		{"echo err >&2; exit 1", "", "err"},
+		{"echo out; echo err >&2", "out", "err"},
+		{"printf '  out\\n\\n'; printf '\\nerr one\\nerr two\\n' >&2; exit 3", "out", "err one\nerr two"},
+	} {
+		var stdout, stderr string
+		calls := 0
+		runShell(t, newShellWithStderr("sh", "-c", tc.script).
+			Output(func(o, e string) bar.Output {
+				calls++
+				stdout, stderr = o, e
+				return outputs.Text(o)
+			}))
+		if calls != 1 || stdout != tc.stdout || stderr != tc.stderr {
+			t.Errorf("%s: called %d times with %q, %q, want %q, %q",
+				tc.script, calls, stdout, stderr, tc.stdout, tc.stderr)
+		}
+	}
+}
+
+func TestShellStderrDefaultOutput(t *testing.T) {
+	show := func(o bar.Output) bar.Output { return o }
+
+	// A failing command shows the first line of stderr, urgently.
+	out := runShell(t, newShellWithStderr("sh", "-c",
+		"echo 'error: current-context is not set' >&2; echo more >&2; exit 1"))
+	baristatest.AssertOutput(t, show, out,
+		baristatest.SegmentText(0, "error: current-context is not set"), baristatest.IsUrgent(0))
+
+	long := strings.Repeat("x", 80)
+	out = runShell(t, newShellWithStderr("sh", "-c", "echo "+long+" >&2; exit 1"))
+	if text := baristatest.Text(out.Segments()[0]); len([]rune(text)) != 50 {
+		t.Errorf("stderr shown as %q, want it truncated to 50", text)
+	}
+
+	// Warnings on stderr from a command that succeeds aren't shown.
+	out = runShell(t, newShellWithStderr("sh", "-c", "echo prod; echo deprecated >&2"))
+	baristatest.AssertOutput(t, show, out, baristatest.SegmentText(0, "prod"))
+	if urgent, _ := out.Segments()[0].IsUrgent(); urgent {
+		t.Error("urgent although the command succeeded")
+	}
+
+	// A failure without stderr shows stdout.
+	out = runShell(t, newShellWithStderr("sh", "-c", "echo partial; exit 2"))
+	baristatest.AssertOutput(t, show, out, baristatest.SegmentText(0, "partial"))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"barista.run"
+	"barista.run/bar"
+	"barista.run/modules/static"
+	"barista.run/outputs"
+)
+
+// shutdownGrace is how long "Shutting down" is shown before runUntil
+// returns, and how long a signal waits for that before exiting anyway,
+// e.g. if it arrives before the bar has started.
+var shutdownGrace = 500 * time.Millisecond
+
+// shutdownNotice is empty until the bar is shutting down.
+var shutdownNotice = static.New(nil)
+
+// runBar runs the bar, replaced in tests.
+var runBar = barista.Run
+
+// untilDone streams a module until done is closed, then returns from
+// Stream and drops anything the module sends after that.
+type untilDone struct {
+	bar.Module
+	done <-chan struct{}
+}
+
+func (u untilDone) Stream(s bar.Sink) {
+	var mu sync.Mutex
+	stopped := false
+	go u.Module.Stream(func(o bar.Output) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !stopped {
+			s(o)
+		}
+	})
+	<-u.done
+	mu.Lock()
+	stopped = true
+	mu.Unlock()
+}
+
+// runUntil is barista.Run, but returns once ctx is cancelled, after
+// showing that the bar is shutting down. It first runs the hooks queued
+// by onStart, and returns the first error from them without starting
+// the bar. Every module's Stream returns on cancellation, and nothing
+// it sends afterwards reaches the bar, so "Shutting down" is the last
+// output. barista can't stop the goroutines inside its own modules, so
+// those end when the process exits.
+func runUntil(ctx context.Context, modules ...bar.Module) error {
+	if err := runStartHooks(); err != nil {
+		return fmt.Errorf("startup failed: %w", err)
+	}
+	shutdownNotice.Set(nil)
+	wrapped := make([]bar.Module, 0, len(modules)+1)
+	for _, m := range modules {
+		wrapped = append(wrapped, untilDone{m, ctx.Done()})
+	}
+	wrapped = append(wrapped, shutdownNotice)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- runBar(wrapped...)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownNotice.Set(outputs.Text("Shutting down").Urgent(true))
+	time.Sleep(shutdownGrace)
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+// tickingModule sends an output every millisecond and never returns from
+// Stream, like the built-in barista modules.
+type tickingModule string
+
+func (m tickingModule) Stream(s bar.Sink) {
+	for i := 0; ; i++ {
+		s.Output(outputs.Textf("%s %d", m, i))
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// fakeBar records the outputs of each module, and when each one's Stream
+// returns.
+type fakeBar struct {
+	mu       sync.Mutex
+	last     map[int]bar.Output
+	received map[int]int
+	streams  sync.WaitGroup
+}
+
+func (f *fakeBar) run(modules ...bar.Module) error {
+	for i, m := range modules {
+		i, m := i, m
+		if m == shutdownNotice {
+			go m.Stream(f.sink(i))
+			continue
+		}
+		f.streams.Add(1)
+		go func() {
+			defer f.streams.Done()
+			m.Stream(f.sink(i))
+		}()
+	}
+	select {}
+}
+
+func (f *fakeBar) sink(i int) bar.Sink {
+	return func(o bar.Output) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.last[i] = o
+		f.received[i]++
+	}
+}
+
+func (f *fakeBar) counts() map[int]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := map[int]int{}
+	for i, n := range f.received {
+		c[i] = n
+	}
+	return c
+}
+
+func TestRunUntil(t *testing.T) {
+	f := &fakeBar{last: map[int]bar.Output{}, received: map[int]int{}}
+	defer func(r func(...bar.Module) error) { runBar = r }(runBar)
+	runBar = f.run
+	defer func(d time.Duration) { shutdownGrace = d }(shutdownGrace)
+	shutdownGrace = 50 * time.Millisecond
+
+	var modules []bar.Module
+	for i := 0; i < 3; i++ {
+		modules = append(modules, tickingModule(fmt.Sprint("module", i)))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	returned := make(chan error, 1)
+	go func() { returned <- runUntil(ctx, modules...) }()
+
+	time.Sleep(20 * time.Millisecond)
+	for i := range modules {
+		if f.counts()[i] == 0 {
+			t.Errorf("module %d never shown", i)
+		}
+	}
+	cancel()
+
+	streamsDone := make(chan struct{})
+	go func() {
+		f.streams.Wait()
+		close(streamsDone)
+	}()
+	select {
+	case <-streamsDone:
+	case <-time.After(time.Second):
+		t.Fatal("module streams still running a second after cancelling")
+	}
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("runUntil still running a second after cancelling")
+	}
+
+	before := f.counts()
+	time.Sleep(20 * time.Millisecond)
+	after := f.counts()
+	for i := range modules {
+		if after[i] != before[i] {
+			t.Errorf("module %d shown %d more times after shutting down", i, after[i]-before[i])
+		}
+	}
+	f.mu.Lock()
+	notice := f.last[len(modules)]
+	f.mu.Unlock()
+	if notice == nil {
+		t.Fatal("shutdown notice not shown")
+	}
+	baristatest.AssertOutput(t, func(o bar.Output) bar.Output { return o }, notice,
+		baristatest.SegmentText(0, "Shutting down"), baristatest.IsUrgent(0))
+}
+
+func TestRunUntilBarError(t *testing.T) {
+	defer func(r func(...bar.Module) error) { runBar = r }(runBar)
+	runBar = func(...bar.Module) error { return fmt.Errorf("no stdout") }
+	if err := runUntil(context.Background()); err == nil || err.Error() != "no stdout" {
+		t.Errorf("got %v, want the bar's error", err)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// handleSignals reloads the theme on SIGHUP, so a theme change doesn't need
+// i3 to restart the bar, and shuts down through stop on SIGINT or SIGTERM.
+func handleSignals(stop context.CancelFunc) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range sigs {
+		switch sig {
+		case syscall.SIGHUP:
+			logInfof("Reloading theme")
+			loadTheme()
+		default:
+			logInfof("Exiting on %v", sig)
+			stop()
+			// In case the bar hasn't started, or is stuck.
+			time.AfterFunc(2*shutdownGrace, func() { os.Exit(0) })
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import "sync"
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// ringBuffer keeps the most recent samples of a value, discarding the oldest
+// once full. It is safe for concurrent use.
+type ringBuffer struct {
+	mu      sync.Mutex
+	samples []float64
+	next    int
+	full    bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{samples: make([]float64, size)}
+}
+
+// Add records a sample, overwriting the oldest one if the buffer is full.
+func (r *ringBuffer) Add(v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.samples) == 0 {
+		return
+	}
+	r.samples[r.next] = v
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Values returns a copy of the samples, oldest first.
+func (r *ringBuffer) Values() []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]float64(nil), r.samples[:r.next]...)
+	}
+	return append(append([]float64(nil), r.samples[r.next:]...), r.samples[:r.next]...)
+}
+
+// sparkline renders values as a row of block characters, scaled so that lo
+// is the lowest block and hi is the highest. Values outside [lo, hi] are
+// clamped.
+func sparkline(values []float64, lo, hi float64) string {
+	out := make([]rune, len(values))
+	for i, v := range values {
+		idx := 0
+		if hi > lo {
+			idx = int((v - lo) / (hi - lo) * float64(len(sparkBlocks)-1))
+		}
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(sparkBlocks) {
+			idx = len(sparkBlocks) - 1
+		}
+		out[i] = sparkBlocks[idx]
+	}
+	return string(out)
+}
+
+// minMax returns the smallest and largest of values.
+func minMax(values []float64) (lo, hi float64) {
+	for i, v := range values {
+		if i == 0 || v < lo {
+			lo = v
+		}
+		if i == 0 || v > hi {
+			hi = v
+		}
+	}
+	return lo, hi
+}
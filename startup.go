@@ -0,0 +1,30 @@
+package main
+
+import "sync"
+
+var startHooksMu sync.Mutex
+var startHooks []func() error
+
+// onStart queues f to run once all modules have been created, just before
+// the bar starts, e.g. for setup that modules' constructors may add to or
+// that should only happen when the bar is actually going to run.
+func onStart(f func() error) {
+	startHooksMu.Lock()
+	defer startHooksMu.Unlock()
+	startHooks = append(startHooks, f)
+}
+
+// runStartHooks runs the hooks queued by onStart in order, stopping at the
+// first error.
+func runStartHooks() error {
+	startHooksMu.Lock()
+	hooks := startHooks
+	startHooks = nil
+	startHooksMu.Unlock()
+	for _, f := range hooks {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
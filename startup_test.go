@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"barista.run/bar"
+)
+
+func TestRunStartHooks(t *testing.T) {
+	var ran []string
+	hook := func(name string, err error) func() error {
+		return func() error {
+			ran = append(ran, name)
+			return err
+		}
+	}
+	onStart(hook("gpu", nil))
+	onStart(hook("battery", errors.New("no battery")))
+	onStart(hook("oauth", nil))
+	if err := runStartHooks(); err == nil || err.Error() != "no battery" {
+		t.Errorf("got %v, want the failing hook's error", err)
+	}
+	if want := []string{"gpu", "battery"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, want %v and no more", ran, want)
+	}
+
+	// Hooks run once, and later ones are queued afresh.
+	ran = nil
+	onStart(hook("late", nil))
+	if err := runStartHooks(); err != nil || !reflect.DeepEqual(ran, []string{"late"}) {
+		t.Errorf("ran %v, %v", ran, err)
+	}
+	if err := runStartHooks(); err != nil || len(ran) != 1 {
+		t.Errorf("ran %v again, %v", ran, err)
+	}
+}
+
+func TestRunUntilStartHookFails(t *testing.T) {
+	defer func(r func(...bar.Module) error) { runBar = r }(runBar)
+	started, streamed := false, false
+	runBar = func(...bar.Module) error {
+		started = true
+		return nil
+	}
+	m := moduleFunc(func(bar.Sink) { streamed = true })
+
+	onStart(func() error { return errors.New("no GPU") })
+	err := runUntil(context.Background(), m)
+	if err == nil || err.Error() != "startup failed: no GPU" {
+		t.Errorf("got %v, want the hook's error", err)
+	}
+	if started || streamed {
+		t.Error("bar started although a start hook failed")
+	}
+
+	var order []string
+	runBar = func(...bar.Module) error {
+		order = append(order, "bar")
+		return errors.New("stopped")
+	}
+	onStart(func() error {
+		order = append(order, "hook")
+		return nil
+	})
+	runUntil(context.Background(), m)
+	if want := []string{"hook", "bar"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("ran %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/static"
+)
+
+// stopwatchStateFile keeps the stopwatch going across restarts.
+var stopwatchStateFile = home(".cache/barista/stopwatch.json")
+
+type stopwatchInfo struct {
+	Elapsed time.Duration
+	Running bool
+}
+
+// stopwatchController controls a stopwatch, e.g. from click handlers.
+type stopwatchController interface {
+	Start()
+	Stop()
+	Reset()
+	Toggle()
+}
+
+// stopwatchState is what's saved: the time accumulated over previous runs,
+// and the start of the current run if it's running.
+type stopwatchState struct {
+	Started time.Time     `json:"started,omitempty"`
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// stopwatch counts up, updating every second while running.
+type stopwatch struct {
+	out       *static.Module
+	output    func(stopwatchInfo, stopwatchController) bar.Output
+	stateFile string
+	mu        sync.Mutex
+	state     stopwatchState
+	stop      chan struct{}
+}
+
+// newStopwatch restores the stopwatch saved in stateFile, shown with
+// stopwatchOutput unless changed with Output.
+func newStopwatch(stateFile string) *stopwatch {
+	return newStopwatchOn(static.New(nil), stateFile, stopwatchOutput)
+}
+
+// newStopwatchOn is newStopwatch showing its output on out, for modules
+// that use a stopwatch as one of their modes.
+func newStopwatchOn(out *static.Module, stateFile string, output func(stopwatchInfo, stopwatchController) bar.Output) *stopwatch {
+	s := &stopwatch{out: out, output: output, stateFile: stateFile}
+	if data, err := ioutil.ReadFile(stateFile); err == nil {
+		json.Unmarshal(data, &s.state)
+	}
+	if !s.state.Started.IsZero() {
+		s.stop = make(chan struct{})
+		go s.tick(s.stop)
+	}
+	s.show()
+	return s
+}
+
+// Output sets the output function.
+func (s *stopwatch) Output(f func(stopwatchInfo, stopwatchController) bar.Output) *stopwatch {
+	s.mu.Lock()
+	s.output = f
+	s.mu.Unlock()
+	s.show()
+	return s
+}
+
+// Stream shows the stopwatch.
+func (s *stopwatch) Stream(sink bar.Sink) {
+	s.out.Stream(sink)
+}
+
+// Info returns the current elapsed time.
+func (s *stopwatch) Info() stopwatchInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info()
+}
+
+// info is Info with mu held.
+func (s *stopwatch) info() stopwatchInfo {
+	i := stopwatchInfo{Elapsed: s.state.Elapsed, Running: !s.state.Started.IsZero()}
+	if i.Running {
+		i.Elapsed += time.Since(s.state.Started)
+	}
+	return i
+}
+
+// Start starts counting, unless already running.
+func (s *stopwatch) Start() {
+	s.mu.Lock()
+	if s.state.Started.IsZero() {
+		s.state.Started = time.Now()
+		s.stop = make(chan struct{})
+		go s.tick(s.stop)
+		s.save()
+	}
+	s.mu.Unlock()
+	s.show()
+}
+
+// Stop pauses counting, keeping the elapsed time.
+func (s *stopwatch) Stop() {
+	s.mu.Lock()
+	if !s.state.Started.IsZero() {
+		s.state.Elapsed = s.info().Elapsed
+		s.state.Started = time.Time{}
+		close(s.stop)
+		s.save()
+	}
+	s.mu.Unlock()
+	s.show()
+}
+
+// Reset stops counting and sets the elapsed time back to zero.
+func (s *stopwatch) Reset() {
+	s.mu.Lock()
+	if !s.state.Started.IsZero() {
+		close(s.stop)
+	}
+	s.state = stopwatchState{}
+	s.save()
+	s.mu.Unlock()
+	s.show()
+}
+
+// Toggle stops the stopwatch if it's running, and starts it otherwise.
+func (s *stopwatch) Toggle() {
+	if s.Info().Running {
+		s.Stop()
+	} else {
+		s.Start()
+	}
+}
+
+func (s *stopwatch) tick(stop <-chan struct{}) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			s.show()
+		}
+	}
+}
+
+// save writes the state to the state file. mu must be held.
+func (s *stopwatch) save() {
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(s.stateFile), 0755) == nil {
+		ioutil.WriteFile(s.stateFile, data, 0644)
+	}
+}
+
+func (s *stopwatch) show() {
+	s.mu.Lock()
+	info, output := s.info(), s.output
+	s.mu.Unlock()
+	s.out.Set(output(info, s))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// loadavgInfo is the contents of /proc/loadavg, e.g.
+// "0.52 0.58 0.59 3/412 12345".
+type loadavgInfo struct {
+	Loads            [3]float64
+	RunningProcesses int
+	TotalProcesses   int
+	LastPID          int
+}
+
+func parseLoadavg(contents string) (loadavgInfo, error) {
+	var info loadavgInfo
+	fields := strings.Fields(contents)
+	if len(fields) < 5 {
+		return info, fmt.Errorf("unexpected /proc/loadavg format: %q", contents)
+	}
+	for i := range info.Loads {
+		load, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return info, err
+		}
+		info.Loads[i] = load
+	}
+	entities := strings.SplitN(fields[3], "/", 2)
+	if len(entities) != 2 {
+		return info, fmt.Errorf("unexpected process counts: %q", fields[3])
+	}
+	var err error
+	if info.RunningProcesses, err = strconv.Atoi(entities[0]); err != nil {
+		return info, err
+	}
+	if info.TotalProcesses, err = strconv.Atoi(entities[1]); err != nil {
+		return info, err
+	}
+	if info.LastPID, err = strconv.Atoi(fields[4]); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+func readLoadavg() (loadavgInfo, bool) {
+	contents, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return loadavgInfo{}, false
+	}
+	info, err := parseLoadavg(string(contents))
+	return info, err == nil
+}
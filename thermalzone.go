@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// thermalZoneType picks the thermal zone to show by its type, overriding
+// the automatic choice, e.g. "acpitz". See /sys/class/thermal/*/type.
+var thermalZoneType = ""
+
+// cpuZoneTypes identify the CPU package sensor, in order of preference.
+var cpuZoneTypes = []string{"x86_pkg_temp", "PKGC", "Package id", "CPU-die"}
+
+// thermalDir holds a directory for each thermal zone.
+var thermalDir = "/sys/class/thermal"
+
+// cpuThermalZone returns the name of the thermal zone (e.g. "thermal_zone2")
+// whose type matches thermalZoneType if set, or otherwise the best of
+// cpuZoneTypes. ok is false if none match, in which case cputemp's default
+// of the first zone is used.
+func cpuThermalZone() (zone string, ok bool) {
+	dirs, _ := filepath.Glob(filepath.Join(thermalDir, "thermal_zone*"))
+	// Glob sorts lexically, so thermal_zone10 comes before thermal_zone2;
+	// the order only matters between zones of the same type, where the
+	// lowest number is the most stable choice.
+	sort.Slice(dirs, func(i, j int) bool {
+		if len(dirs[i]) != len(dirs[j]) {
+			return len(dirs[i]) < len(dirs[j])
+		}
+		return dirs[i] < dirs[j]
+	})
+	types := map[string]string{}
+	for _, dir := range dirs {
+		typ, err := ioutil.ReadFile(filepath.Join(dir, "type"))
+		if err == nil {
+			types[filepath.Base(dir)] = strings.TrimSpace(string(typ))
+		}
+	}
+	wanted := cpuZoneTypes
+	if thermalZoneType != "" {
+		wanted = []string{thermalZoneType}
+	}
+	for _, want := range wanted {
+		for _, dir := range dirs {
+			name := filepath.Base(dir)
+			if strings.Contains(types[name], want) {
+				logDebugf("Using thermal zone %s (%s) for CPU temperature", name, types[name])
+				return name, true
+			}
+		}
+	}
+	if thermalZoneType != "" {
+		logWarnf("No thermal zone of type %q, using the first zone", thermalZoneType)
+	} else {
+		logDebugf("No CPU package thermal zone, using the first zone")
+	}
+	return "", false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// colorThresholds are the boundaries at which modules change colour. They
+// can be tuned in thresholdsFile, e.g.
+//
+//	{"temp": {"urgent": 95, "bad": 85, "degraded": 75}}
+//
+// with anything not set keeping its default.
+type colorThresholds struct {
+	// Battery is the remaining charge in percent at or below which the
+	// battery is urgent, bad, degraded and good.
+	Battery batteryThresholds `json:"battery"`
+	// Load is the 1-minute load average per CPU above which the load is
+	// urgent, bad and degraded, and below which it's good. Anything above
+	// 1 means processes are waiting for a CPU.
+	Load struct {
+		Urgent   float64 `json:"urgent"`
+		Bad      float64 `json:"bad"`
+		Degraded float64 `json:"degraded"`
+		Good     float64 `json:"good"`
+	} `json:"load"`
+	// Temp is the CPU temperature in °C above which it's urgent, bad and
+	// degraded.
+	Temp struct {
+		Urgent   float64 `json:"urgent"`
+		Bad      float64 `json:"bad"`
+		Degraded float64 `json:"degraded"`
+	} `json:"temp"`
+	// Memory is the available memory in GB below which it's urgent, bad
+	// and degraded, and above which it's good.
+	Memory struct {
+		Urgent   float64 `json:"urgent"`
+		Bad      float64 `json:"bad"`
+		Degraded float64 `json:"degraded"`
+		Good     float64 `json:"good"`
+	} `json:"memory"`
+	// Disk is the free space in GB, or fraction of inodes, below which a
+	// disk is urgent, and the free fraction of space or inodes below which
+	// it's bad and degraded.
+	Disk struct {
+		UrgentGB     float64 `json:"urgent_gb"`
+		UrgentInodes float64 `json:"urgent_inodes"`
+		Bad          float64 `json:"bad"`
+		Degraded     float64 `json:"degraded"`
+	} `json:"disk"`
+	// Pressure is the percentage of the last 10s that some tasks were
+	// stalled on memory above which it's urgent, bad and degraded.
+	Pressure struct {
+		Urgent   float64 `json:"urgent"`
+		Bad      float64 `json:"bad"`
+		Degraded float64 `json:"degraded"`
+	} `json:"pressure"`
+}
+
+// batteryThresholds are the remaining percentages at or below which the
+// battery is shown as urgent, bad, degraded and good respectively.
+type batteryThresholds struct {
+	Urgent   int `json:"urgent"`
+	Bad      int `json:"bad"`
+	Degraded int `json:"degraded"`
+	Good     int `json:"good"`
+}
+
+// thresholdsFile overrides defaultThresholds.
+var thresholdsFile = configDir("thresholds.json")
+
+var defaultThresholds = func() colorThresholds {
+	var t colorThresholds
+	t.Battery = batteryThresholds{Urgent: 5, Bad: 25, Degraded: 50, Good: 100}
+	t.Load.Urgent, t.Load.Bad, t.Load.Degraded, t.Load.Good = 2.0, 1.5, 1.0, 0.5
+	t.Temp.Urgent, t.Temp.Bad, t.Temp.Degraded = 90, 70, 60
+	t.Memory.Urgent, t.Memory.Bad, t.Memory.Degraded, t.Memory.Good = 0.5, 1, 2, 12
+	t.Disk.UrgentGB, t.Disk.UrgentInodes, t.Disk.Bad, t.Disk.Degraded = 1, 0.01, 0.05, 0.1
+	t.Pressure.Urgent, t.Pressure.Bad, t.Pressure.Degraded = 50, 25, 10
+	return t
+}()
+
+// thresholds are the thresholds in use.
+var thresholds = defaultThresholds
+
+// loadThresholdsConfig reads thresholdsFile, keeping the defaults for any
+// group of thresholds that isn't in order.
+func loadThresholdsConfig() {
+	data, err := ioutil.ReadFile(thresholdsFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	t := defaultThresholds
+	if err == nil {
+		err = json.Unmarshal(data, &t)
+	}
+	if err != nil {
+		logWarnf("Ignoring %s: %v", thresholdsFile, err)
+		return
+	}
+	check := func(name string, ok bool, reset func()) {
+		if !ok {
+			logWarnf("Ignoring %s thresholds in %s: they're out of order", name, thresholdsFile)
+			reset()
+		}
+	}
+	d := defaultThresholds
+	b := t.Battery
+	check("battery", descending(float64(b.Good), float64(b.Degraded), float64(b.Bad), float64(b.Urgent)),
+		func() { t.Battery = d.Battery })
+	check("load", descending(t.Load.Urgent, t.Load.Bad, t.Load.Degraded, t.Load.Good),
+		func() { t.Load = d.Load })
+	check("temp", descending(t.Temp.Urgent, t.Temp.Bad, t.Temp.Degraded),
+		func() { t.Temp = d.Temp })
+	check("memory", descending(t.Memory.Good, t.Memory.Degraded, t.Memory.Bad, t.Memory.Urgent),
+		func() { t.Memory = d.Memory })
+	check("disk", descending(t.Disk.Degraded, t.Disk.Bad, t.Disk.UrgentInodes) && t.Disk.UrgentGB >= 0,
+		func() { t.Disk = d.Disk })
+	check("pressure", descending(t.Pressure.Urgent, t.Pressure.Bad, t.Pressure.Degraded),
+		func() { t.Pressure = d.Pressure })
+	thresholds = t
+	logDebugf("Thresholds: %+v", t)
+}
+
+// descending reports whether vs are strictly decreasing.
+func descending(vs ...float64) bool {
+	for i := 1; i < len(vs); i++ {
+		if vs[i] >= vs[i-1] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// throttleCountGlob matches the per-core and per-package counts of thermal
+// throttling events, which only Intel CPUs expose.
+var throttleCountGlob = "/sys/devices/system/cpu/cpu*/thermal_throttle/*_throttle_count"
+
+// throttleDetector notices thermal throttling by the throttle counts going
+// up between calls.
+type throttleDetector struct {
+	mu     sync.Mutex
+	last   uint64
+	primed bool
+}
+
+// Throttling returns whether the CPU has been throttled since the last
+// call. ok is false if the kernel doesn't expose throttle counts.
+func (t *throttleDetector) Throttling() (active, ok bool) {
+	files, _ := filepath.Glob(throttleCountGlob)
+	if len(files) == 0 {
+		return false, false
+	}
+	var total uint64
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err == nil {
+			total += n
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active = t.primed && total > t.last
+	t.last, t.primed = total, true
+	return active, true
+}
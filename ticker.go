@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/funcs"
+)
+
+// tickerSymbol is the currency pair to show, as a Coinbase product, e.g.
+// "BTC-USD" or "ETH-EUR".
+var tickerSymbol = "BTC-USD"
+
+// tickerTTL is the minimum time between price requests, well inside the
+// public API's rate limit.
+var tickerTTL = 5 * time.Minute
+
+const coinbaseSpotURL = "https://api.coinbase.com/v2/prices/%s/spot"
+
+type coinbaseSpotResponse struct {
+	Data struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	} `json:"data"`
+}
+
+type tickerInfo struct {
+	Symbol   string
+	Price    float64
+	Currency string
+	// Change is the difference from the previous price fetched, zero on
+	// the first fetch.
+	Change float64
+}
+
+func coinbaseSpot(ctx context.Context, symbol string) (price float64, currency string, err error) {
+	resp, err := httpGet(ctx, fmt.Sprintf(coinbaseSpotURL, symbol))
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("coinbase: %s", resp.Status)
+	}
+	var res coinbaseSpotResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return 0, "", err
+	}
+	price, err = strconv.ParseFloat(res.Data.Amount, 64)
+	return price, res.Data.Currency, err
+}
+
+// priceTicker fetches the price at most once per tickerTTL, remembering
+// the previous price to show which way it moved.
+type priceTicker struct {
+	symbol    string
+	mu        sync.Mutex
+	info      tickerInfo
+	fetchedAt time.Time
+}
+
+func (t *priceTicker) Get() (tickerInfo, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.fetchedAt.IsZero() && time.Since(t.fetchedAt) < tickerTTL {
+		return t.info, nil
+	}
+	price, currency, err := coinbaseSpot(context.Background(), t.symbol)
+	if err != nil {
+		return tickerInfo{}, err
+	}
+	info := tickerInfo{Symbol: t.symbol, Price: price, Currency: currency}
+	if !t.fetchedAt.IsZero() {
+		info.Change = price - t.info.Price
+	}
+	t.info, t.fetchedAt = info, time.Now()
+	return info, nil
+}
+
+// newTickerModule shows the price of tickerSymbol.
+func newTickerModule() *funcs.RepeatingModule {
+	t := &priceTicker{symbol: tickerSymbol}
+	return pollEvery(tickerTTL, func(s bar.Sink) {
+		info, err := t.Get()
+		if err != nil {
+			logDebugf("Price of %s unavailable: %v", t.symbol, err)
+			s.Output(nil)
+			return
+		}
+		s.Output(tickerOutput(info))
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Clock formats, as Go reference time layouts. They can be overridden with
+// BARISTA_DATE_FORMAT, BARISTA_TIME_FORMAT and BARISTA_TZ_FORMAT, and
+// BARISTA_CLOCK_12H=1 switches the default time formats to a 12-hour clock.
+var (
+	dateFormat    = "Mon Jan 2"
+	timeFormat    = "15:04:05"
+	tzClockFormat = "15:04"
+)
+
+// loadTimeFormats applies the environment overrides for the clock formats,
+// keeping the defaults for any that are unset or not valid layouts.
+func loadTimeFormats() {
+	if v := os.Getenv("BARISTA_CLOCK_12H"); v == "1" || v == "true" {
+		timeFormat = "3:04:05 PM"
+		tzClockFormat = "3:04 PM"
+	}
+	for env, format := range map[string]*string{
+		"BARISTA_DATE_FORMAT": &dateFormat,
+		"BARISTA_TIME_FORMAT": &timeFormat,
+		"BARISTA_TZ_FORMAT":   &tzClockFormat,
+	} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		if !validTimeLayout(v) {
+			logWarnf("%s=%q has no reference time fields, using %q", env, v, *format)
+			continue
+		}
+		*format = v
+	}
+}
+
+// validTimeLayout reports whether layout contains at least one element of
+// the reference time, since time.Format accepts any string and would
+// otherwise show it verbatim.
+func validTimeLayout(layout string) bool {
+	ref := time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)
+	return ref.Format(layout) != layout
+}
+
+// unixTimeDuration is how long the time shows the Unix timestamp after a
+// middle click.
+var unixTimeDuration = 5 * time.Second
+
+// unixTimeUntil is when the time goes back to the normal clock, in Unix
+// nanoseconds.
+var unixTimeUntil int64
+
+func showUnixTime() {
+	atomic.StoreInt64(&unixTimeUntil, time.Now().Add(unixTimeDuration).UnixNano())
+}
+
+func showingUnixTime(now time.Time) bool {
+	return now.UnixNano() < atomic.LoadInt64(&unixTimeUntil)
+}
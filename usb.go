@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/static"
+	"barista.run/outputs"
+	"barista.run/pango"
+)
+
+// usbDisplayTime is how long a plug or unplug event stays in the bar.
+var usbDisplayTime = 5 * time.Second
+
+type usbEvent struct {
+	// Action is "add" or "remove".
+	Action     string
+	Subsystem  string
+	DeviceName string
+	Vendor     string
+	Product    string
+	Serial     string
+	devPath    string
+}
+
+// Name returns a human readable name for the device.
+func (e usbEvent) Name() string {
+	name := strings.TrimSpace(e.Vendor + " " + e.Product)
+	if name == "" {
+		name = e.DeviceName
+	}
+	return name
+}
+
+// parseUevent parses a kernel uevent message, which is a header such as
+// "add@/devices/..." followed by NUL separated KEY=VALUE pairs.
+func parseUevent(msg []byte) (usbEvent, bool) {
+	parts := bytes.Split(msg, []byte{0})
+	if len(parts) < 2 || !bytes.Contains(parts[0], []byte("@")) {
+		// Messages from udev start with "libudev", and are ignored.
+		return usbEvent{}, false
+	}
+	env := map[string]string{}
+	for _, p := range parts[1:] {
+		if kv := strings.SplitN(string(p), "=", 2); len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+	e := usbEvent{
+		Action:     env["ACTION"],
+		Subsystem:  env["SUBSYSTEM"],
+		DeviceName: env["DEVNAME"],
+		devPath:    env["DEVPATH"],
+	}
+	if e.Action != "add" && e.Action != "remove" {
+		return usbEvent{}, false
+	}
+	if e.Subsystem == "usb" && env["DEVTYPE"] != "usb_device" {
+		// Each interface of a device gets its own event too.
+		return usbEvent{}, false
+	}
+	if e.Subsystem == "block" && env["DEVTYPE"] != "disk" && env["DEVTYPE"] != "partition" {
+		return usbEvent{}, false
+	}
+	if e.Subsystem != "usb" && !strings.Contains(e.devPath, "/usb") {
+		return usbEvent{}, false
+	}
+	if e.Subsystem == "input" {
+		e.Product = strings.Trim(env["NAME"], `"`)
+	}
+	return e, true
+}
+
+// withSysfsInfo fills in the vendor, product and serial from the closest
+// USB device in sysfs, which only works while the device is plugged in.
+func (e usbEvent) withSysfsInfo() usbEvent {
+	for dir := filepath.Join("/sys", e.devPath); strings.Contains(dir, "/usb"); dir = filepath.Dir(dir) {
+		product := readSysfsString(filepath.Join(dir, "product"))
+		if product == "" {
+			continue
+		}
+		if e.Product == "" {
+			e.Product = product
+		}
+		e.Vendor = readSysfsString(filepath.Join(dir, "manufacturer"))
+		e.Serial = readSysfsString(filepath.Join(dir, "serial"))
+		break
+	}
+	return e
+}
+
+// usbSysBlock is where sysfs lists block devices, with a directory for
+// each partition inside the disk's.
+var usbSysBlock = "/sys/class/block"
+
+// usbMountTarget returns the device to mount for the block device dev.
+// Partitioned drives can't be mounted as a whole, so for those the first
+// partition is mounted instead.
+func usbMountTarget(dev string) string {
+	parts, _ := filepath.Glob(filepath.Join(usbSysBlock, dev, dev+"*", "partition"))
+	if len(parts) > 0 {
+		return "/dev/" + filepath.Base(filepath.Dir(parts[0]))
+	}
+	return "/dev/" + dev
+}
+
+// usbWatcher shows USB devices being plugged in or removed, as reported by
+// kernel uevents.
+type usbWatcher struct {
+	subsystem string
+	out       *static.Module
+	mu        sync.Mutex
+	clearAt   *time.Timer
+}
+
+func newUsbWatcher() *usbWatcher {
+	return &usbWatcher{subsystem: "usb", out: static.New(nil)}
+}
+
+// WithFilter restricts the events shown to a subsystem, e.g. "block" for
+// USB drives or "input" for keyboards and mice.
+func (u *usbWatcher) WithFilter(subsystem string) *usbWatcher {
+	u.subsystem = subsystem
+	return u
+}
+
+// Stream listens for uevents, showing an error if the netlink socket can't
+// be opened.
+func (u *usbWatcher) Stream(s bar.Sink) {
+	go u.listen()
+	u.out.Stream(s)
+}
+
+func (u *usbWatcher) listen() {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		u.out.Set(outputs.Errorf("usb: %v", err))
+		return
+	}
+	defer syscall.Close(fd)
+	// Group 1 is kernel events; udev rebroadcasts them on group 2.
+	addr := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}
+	if err := syscall.Bind(fd, addr); err != nil {
+		u.out.Set(outputs.Errorf("usb: %v", err))
+		return
+	}
+	u.receive(func(buf []byte) (int, error) {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		return n, err
+	})
+}
+
+// receive shows the events read by recv until it fails. Interrupted reads
+// and overruns, where the kernel dropped events because the bar didn't
+// keep up, don't stop it, since the next event is still complete.
+func (u *usbWatcher) receive(recv func([]byte) (int, error)) {
+	buf := make([]byte, 8192)
+	for {
+		n, err := recv(buf)
+		switch {
+		case err == syscall.EINTR:
+			continue
+		case err == syscall.ENOBUFS:
+			logDebugf("usb: missed uevents: %v", err)
+			continue
+		case err != nil:
+			logErrorf("Stopped watching for USB devices: %v", err)
+			u.out.Set(outputs.Errorf("usb: %v", err))
+			return
+		}
+		e, ok := parseUevent(buf[:n])
+		if !ok || e.Subsystem != u.subsystem {
+			continue
+		}
+		if e.Action == "add" {
+			e = e.withSysfsInfo()
+		}
+		u.show(e)
+	}
+}
+
+// show displays e until usbDisplayTime passes without another event.
+func (u *usbWatcher) show(e usbEvent) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.clearAt != nil {
+		u.clearAt.Stop()
+	}
+	u.out.Set(usbOutput(e))
+	u.clearAt = time.AfterFunc(usbDisplayTime, func() { u.out.Set(nil) })
+}
+
+func usbOutput(e usbEvent) bar.Output {
+	icon := "mdi-usb"
+	if e.Action == "remove" {
+		icon = "mdi-eject"
+	}
+	out := outputs.Pango(pango.Icon(icon), spacer, pango.Text(truncate(e.Name(), 30)))
+	if e.Action == "add" && e.Subsystem == "block" && e.DeviceName != "" {
+		out.OnClick(func(ev bar.Event) {
+			if ev.Button != bar.ButtonLeft {
+				return
+			}
+			cmd := exec.Command("udisksctl", "mount", "-b", usbMountTarget(e.DeviceName))
+			if cmd.Start() == nil {
+				go cmd.Wait()
+			}
+		})
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+// uevent builds a kernel uevent message.
+func uevent(header string, env ...string) []byte {
+	return []byte(header + "\x00" + strings.Join(env, "\x00") + "\x00")
+}
+
+func TestParseUevent(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		msg  []byte
+		ok   bool
+		want usbEvent
+	}{
+		{
+			name: "usb device",
+			msg: uevent("add@/devices/pci0000:00/0000:00:14.0/usb1/1-2",
+				"ACTION=add", "SUBSYSTEM=usb", "DEVTYPE=usb_device", "DEVNAME=bus/usb/001/004",
+				"DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2"),
+			ok: true,
+			want: usbEvent{Action: "add", Subsystem: "usb", DeviceName: "bus/usb/001/004",
+				devPath: "/devices/pci0000:00/0000:00:14.0/usb1/1-2"},
+		},
+		{
+			name: "usb interface",
+			msg: uevent("add@/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0",
+				"ACTION=add", "SUBSYSTEM=usb", "DEVTYPE=usb_interface"),
+		},
+		{
+			name: "usb keyboard",
+			msg: uevent("remove@/devices/pci0000:00/0000:00:14.0/usb1/1-3/input/input12",
+				"ACTION=remove", "SUBSYSTEM=input", `NAME="Keychron K2"`,
+				"DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-3/input/input12"),
+			ok: true,
+			want: usbEvent{Action: "remove", Subsystem: "input", Product: "Keychron K2",
+				devPath: "/devices/pci0000:00/0000:00:14.0/usb1/1-3/input/input12"},
+		},
+		{
+			name: "internal disk",
+			msg: uevent("add@/devices/pci0000:00/0000:00:17.0/ata1/block/sda",
+				"ACTION=add", "SUBSYSTEM=block", "DEVTYPE=disk",
+				"DEVPATH=/devices/pci0000:00/0000:00:17.0/ata1/block/sda"),
+		},
+		{
+			name: "usb drive partition",
+			msg: uevent("add@/devices/pci0000:00/0000:00:14.0/usb2/2-1/2-1:1.0/host0/target0:0:0/0:0:0:0/block/sdb/sdb1",
+				"ACTION=add", "SUBSYSTEM=block", "DEVTYPE=partition", "DEVNAME=sdb1",
+				"DEVPATH=/devices/pci0000:00/0000:00:14.0/usb2/2-1/2-1:1.0/host0/target0:0:0/0:0:0:0/block/sdb/sdb1"),
+			ok: true,
+			want: usbEvent{Action: "add", Subsystem: "block", DeviceName: "sdb1",
+				devPath: "/devices/pci0000:00/0000:00:14.0/usb2/2-1/2-1:1.0/host0/target0:0:0/0:0:0:0/block/sdb/sdb1"},
+		},
+		{
+			name: "internal partition",
+			msg: uevent("add@/devices/pci0000:00/0000:00:17.0/ata1/block/sda/sda2",
+				"ACTION=add", "SUBSYSTEM=block", "DEVTYPE=partition", "DEVNAME=sda2",
+				"DEVPATH=/devices/pci0000:00/0000:00:17.0/ata1/block/sda/sda2"),
+		},
+		{
+			name: "bind",
+			msg:  uevent("bind@/devices/usb1/1-2", "ACTION=bind", "SUBSYSTEM=usb", "DEVTYPE=usb_device"),
+		},
+		{
+			name: "udev",
+			msg:  []byte("libudev\x00\xfe\xed\xca\xfe"),
+		},
+	} {
+		got, ok := parseUevent(tc.msg)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("%s: got %+v, %v, want %+v, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestUsbReceiveErrors(t *testing.T) {
+	u := newUsbWatcher().WithFilter("input")
+	outs := make(chan bar.Output, 10)
+	go u.out.Stream(func(o bar.Output) { outs <- o })
+	next := func() bar.Output {
+		t.Helper()
+		for {
+			select {
+			case o := <-outs:
+				if o != nil {
+					return o
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no output")
+			}
+		}
+	}
+
+	removed := uevent("remove@/devices/usb1/1-3/input/input12",
+		"ACTION=remove", "SUBSYSTEM=input", `NAME="Keychron K2"`,
+		"DEVPATH=/devices/usb1/1-3/input/input12")
+	steps := []func(buf []byte) (int, error){
+		func([]byte) (int, error) { return 0, syscall.EINTR },
+		func([]byte) (int, error) { return 0, syscall.ENOBUFS },
+		func(buf []byte) (int, error) { return copy(buf, removed), nil },
+		func([]byte) (int, error) {
+			if got := baristatest.Text(next().Segments()[0]); !strings.Contains(got, "Keychron K2") {
+				t.Errorf("after the event: %q", got)
+			}
+			return 0, syscall.EBADF
+		},
+	}
+	calls := 0
+	u.receive(func(buf []byte) (int, error) {
+		if calls == len(steps) {
+			t.Fatal("still receiving after EBADF")
+		}
+		calls++
+		return steps[calls-1](buf)
+	})
+	if calls != len(steps) {
+		t.Errorf("stopped after %d reads, want %d", calls, len(steps))
+	}
+	if got := baristatest.Text(next().Segments()[0]); !strings.Contains(got, "bad file descriptor") {
+		t.Errorf("after the error: %q", got)
+	}
+}
+
+func TestUsbMountTarget(t *testing.T) {
+	dir := t.TempDir()
+	defer func(d string) { usbSysBlock = d }(usbSysBlock)
+	usbSysBlock = dir
+	for _, p := range []string{"sdb/sdb2/partition", "sdb/sdb1/partition", "sdb1/partition", "sdc/size"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(p)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeTemp(t, dir, p, "1\n")
+	}
+	for dev, want := range map[string]string{
+		"sdb":  "/dev/sdb1",
+		"sdb1": "/dev/sdb1",
+		"sdc":  "/dev/sdc",
+		"sdd":  "/dev/sdd",
+	} {
+		if got := usbMountTarget(dev); got != want {
+			t.Errorf("usbMountTarget(%q) = %q, want %q", dev, got, want)
+		}
+	}
+}
+
+func TestUsbClearsAfterDisplayTime(t *testing.T) {
+	defer func(d time.Duration) { usbDisplayTime = d }(usbDisplayTime)
+	usbDisplayTime = 50 * time.Millisecond
+
+	u := newUsbWatcher()
+	outs := make(chan bar.Output, 10)
+	go u.out.Stream(func(o bar.Output) { outs <- o })
+	if o := <-outs; o != nil {
+		t.Fatalf("initial output %v", o)
+	}
+
+	added := uevent("add@/devices/usb1/1-2",
+		"ACTION=add", "SUBSYSTEM=usb", "DEVTYPE=usb_device", "DEVNAME=bus/usb/001/004",
+		"DEVPATH=/devices/usb1/1-2")
+	done := make(chan struct{})
+	defer close(done)
+	sent := false
+	go u.receive(func(buf []byte) (int, error) {
+		if !sent {
+			sent = true
+			return copy(buf, added), nil
+		}
+		<-done
+		return 0, syscall.EBADF
+	})
+
+	start := time.Now()
+	baristatest.AssertOutput(t, func(o bar.Output) bar.Output { return o }, <-outs,
+		baristatest.SegmentContains(0, "bus/usb/001/004"))
+	select {
+	case o := <-outs:
+		if o != nil {
+			t.Errorf("got %v, want the segment cleared", o)
+		}
+		if elapsed := time.Since(start); elapsed < usbDisplayTime {
+			t.Errorf("cleared after %v, before the display time", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Error("segment not cleared")
+	}
+}
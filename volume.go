@@ -0,0 +1,62 @@
+package main
+
+import (
+	"barista.run/bar"
+	"barista.run/modules/volume"
+)
+
+// volumeScrollStep is the percentage the volume changes by per scroll tick.
+var volumeScrollStep = 5
+
+// volumeMuteOnScrollToZero mutes instead of leaving the volume at 0% unmuted
+// when scrolling all the way down.
+var volumeMuteOnScrollToZero = true
+
+// volumeController is anything whose volume and mute state can be set,
+// e.g. a mixer or a single application's stream.
+type volumeController interface {
+	SetVolume(vol int64)
+	SetMute(muted bool)
+}
+
+// volumeClickHandler toggles mute on left click, and changes the volume by
+// step percent per scroll tick, clamped to the mixer's range.
+func volumeClickHandler(v volume.Volume, step int, muteOnZero bool) func(bar.Event) {
+	return volumeControlClickHandler(v, v.Vol, v.Min, v.Max, v.Mute, step, muteOnZero)
+}
+
+// volumeControlClickHandler is volumeClickHandler for any controller, given
+// its current volume, range and mute state.
+func volumeControlClickHandler(c volumeController, vol, min, max int64, mute bool, step int, muteOnZero bool) func(bar.Event) {
+	return func(e bar.Event) {
+		delta := (max - min) * int64(step) / 100
+		if delta < 1 {
+			delta = 1
+		}
+		switch e.Button {
+		case bar.ButtonLeft:
+			c.SetMute(!mute)
+		case bar.ScrollUp:
+			c.SetVolume(clampVolume(vol+delta, min, max))
+			if mute {
+				c.SetMute(false)
+			}
+		case bar.ScrollDown:
+			newVol := clampVolume(vol-delta, min, max)
+			c.SetVolume(newVol)
+			if muteOnZero && newVol == min && !mute {
+				c.SetMute(true)
+			}
+		}
+	}
+}
+
+func clampVolume(vol, min, max int64) int64 {
+	if vol < min {
+		return min
+	}
+	if vol > max {
+		return max
+	}
+	return vol
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"barista.run/bar"
+	"barista.run/modules/volume"
+	"barista.run/modules/volume/alsa"
+	"barista.run/modules/volume/pulseaudio"
+	"github.com/fsnotify/fsnotify"
+)
+
+// asoundrcFile is where the ALSA default device is set when PulseAudio
+// isn't running.
+var asoundrcFile = home(".asoundrc")
+
+var asoundrcCard = regexp.MustCompile(`defaults\.(?:pcm|ctl)\.card\s+(\S+)`)
+
+// defaultAudioDevice returns the PulseAudio default sink, or the ALSA
+// default card, and whether PulseAudio is in use.
+func defaultAudioDevice() (device string, pulse bool) {
+	cmd, done := quickCommand("pactl", "info")
+	// Field names are translated otherwise.
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	if out, err := cmd.Output(); done(err) == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if strings.HasPrefix(line, "Default Sink:") {
+				return strings.TrimSpace(strings.TrimPrefix(line, "Default Sink:")), true
+			}
+		}
+	}
+	return alsaDefaultCard(asoundrcFile), false
+}
+
+// alsaDefaultCard returns the default card set in the asoundrc file at
+// path.
+func alsaDefaultCard(path string) string {
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if m := asoundrcCard.FindStringSubmatch(string(data)); m != nil {
+			return m[1]
+		}
+	}
+	return "default"
+}
+
+// alsaMixer returns the mixer for an ALSA card as set in ~/.asoundrc,
+// either its index or its name.
+func alsaMixer(card string) volume.Provider {
+	if card == "default" {
+		return alsa.DefaultMixer()
+	}
+	return alsa.Mixer("hw:"+card, "Master")
+}
+
+// defaultVolume is a volume module that follows the default audio device,
+// e.g. switching to headphones when they're plugged in. A volume module is
+// started for each device the first time it's the default, and keeps
+// running in the background so that switching back to it is instant.
+type defaultVolume struct {
+	output   func(v volume.Volume, device string) bar.Output
+	onChange func(device string)
+	// asoundrc is watched for changes to the ALSA default.
+	asoundrc string
+	// lookup returns the default device, and newModule builds the module
+	// for a device, with pulse set for a PulseAudio sink rather than an
+	// ALSA card.
+	lookup    func() (device string, pulse bool)
+	newModule func(device string, pulse bool) bar.Module
+	mu        sync.Mutex
+	sink      bar.Sink
+	current   string
+	started   map[string]bool
+	last      map[string]bar.Output
+}
+
+func newDefaultVolume(output func(v volume.Volume, device string) bar.Output) *defaultVolume {
+	d := &defaultVolume{
+		output:   output,
+		asoundrc: asoundrcFile,
+		started:  map[string]bool{},
+		last:     map[string]bar.Output{},
+	}
+	d.lookup = defaultAudioDevice
+	d.newModule = d.volumeModule
+	return d
+}
+
+func (d *defaultVolume) volumeModule(device string, pulse bool) bar.Module {
+	provider := alsaMixer(device)
+	if pulse {
+		provider = pulseaudio.Sink(device)
+	}
+	return volume.New(provider).
+		Output(func(v volume.Volume) bar.Output { return d.output(v, device) })
+}
+
+// OnDeviceChange calls f with the new device whenever the default changes.
+func (d *defaultVolume) OnDeviceChange(f func(device string)) *defaultVolume {
+	d.onChange = f
+	return d
+}
+
+// Stream shows the volume of the default device, watching for changes to
+// the default through PulseAudio events or ~/.asoundrc.
+func (d *defaultVolume) Stream(s bar.Sink) {
+	d.mu.Lock()
+	d.sink = s
+	d.mu.Unlock()
+	if d.follow(d.lookup()) {
+		d.watchPulse()
+	}
+	d.watchAsoundrc()
+}
+
+// follow switches the output to device, starting a module for it if this
+// is the first time it's the default, and returns pulse.
+func (d *defaultVolume) follow(device string, pulse bool) bool {
+	// A PulseAudio sink and an ALSA card could share a name.
+	key := "alsa:" + device
+	if pulse {
+		key = "pulse:" + device
+	}
+	d.mu.Lock()
+	if key == d.current {
+		d.mu.Unlock()
+		return pulse
+	}
+	changed := d.current != ""
+	d.current = key
+	if !d.started[key] {
+		d.started[key] = true
+		go d.newModule(device, pulse).Stream(d.forward(key))
+	}
+	if d.sink != nil {
+		d.sink.Output(d.last[key])
+	}
+	d.mu.Unlock()
+	if changed && d.onChange != nil {
+		d.onChange(device)
+	}
+	return pulse
+}
+
+// forward returns a sink that passes on the outputs of the module for key
+// while it's the default device.
+func (d *defaultVolume) forward(key string) bar.Sink {
+	return func(o bar.Output) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.last[key] = o
+		if d.current == key && d.sink != nil {
+			d.sink.Output(o)
+		}
+	}
+}
+
+// watchPulse follows server change events, which include changes of the
+// default sink, until `pactl subscribe` exits.
+func (d *defaultVolume) watchPulse() {
+	cmd := exec.Command("pactl", "subscribe")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil || cmd.Start() != nil {
+		return
+	}
+	s := bufio.NewScanner(stdout)
+	for s.Scan() {
+		// e.g. "Event 'change' on server #4294967295"
+		if strings.Contains(s.Text(), "on server") {
+			d.follow(d.lookup())
+		}
+	}
+	cmd.Wait()
+	logWarnf("PulseAudio event stream ended, watching %s instead", d.asoundrc)
+}
+
+// watchAsoundrc follows changes to the ALSA default card.
+func (d *defaultVolume) watchAsoundrc() {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return
+	}
+	defer w.Close()
+	// Editors replace the file, so watch its directory.
+	if err := w.Add(filepath.Dir(d.asoundrc)); err != nil {
+		return
+	}
+	for e := range w.Events {
+		if e.Name == d.asoundrc {
+			d.follow(d.lookup())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/volume"
+	"barista.run/outputs"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+func TestAlsaDefaultCard(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct{ asoundrc, want string }{
+		{"defaults.pcm.card 1\ndefaults.ctl.card 1\n", "1"},
+		{"defaults.ctl.card   PCH\n", "PCH"},
+		{"pcm.!default { type hw card 0 }\n", "default"},
+	} {
+		path := writeTemp(t, dir, ".asoundrc", tc.asoundrc)
+		if got := alsaDefaultCard(path); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.asoundrc, got, tc.want)
+		}
+	}
+	if got := alsaDefaultCard(filepath.Join(dir, "missing")); got != "default" {
+		t.Errorf("without .asoundrc: got %q", got)
+	}
+}
+
+func TestDefaultVolumeFollowsAsoundrc(t *testing.T) {
+	asoundrc := filepath.Join(t.TempDir(), ".asoundrc")
+	// Replaced like editors do, so the watcher never sees it half written.
+	setCard := func(card string) {
+		tmp := asoundrc + ".tmp"
+		err := ioutil.WriteFile(tmp, []byte("defaults.pcm.card "+card+"\n"), 0644)
+		if err == nil {
+			err = os.Rename(tmp, asoundrc)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	setCard("0")
+
+	var mu sync.Mutex
+	sinks := map[string]bar.Sink{}
+	var built []string
+	changes := make(chan string, 10)
+	d := newDefaultVolume(func(v volume.Volume, device string) bar.Output {
+		return outputs.Textf("%s %d", device, v.Vol)
+	}).OnDeviceChange(func(device string) { changes <- device })
+	d.asoundrc = asoundrc
+	d.lookup = func() (string, bool) { return alsaDefaultCard(asoundrc), false }
+	d.newModule = func(device string, pulse bool) bar.Module {
+		mu.Lock()
+		built = append(built, device)
+		mu.Unlock()
+		return moduleFunc(func(s bar.Sink) {
+			mu.Lock()
+			sinks[device] = s
+			mu.Unlock()
+			// Stands in for the mixer being queried.
+			s.Output(d.output(volume.Volume{Vol: int64(len(device) * 10)}, device))
+		})
+	}
+	outs := make(chan string, 10)
+	go d.Stream(func(o bar.Output) {
+		if o != nil {
+			outs <- baristatest.Text(o.Segments()[0])
+		}
+	})
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-outs:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no output, want %q", want)
+		}
+	}
+	expect("0 10")
+
+	// Give the watcher time to start, then switch to headphones.
+	time.Sleep(50 * time.Millisecond)
+	setCard("1")
+	select {
+	case dev := <-changes:
+		if dev != "1" {
+			t.Errorf("OnDeviceChange got %q", dev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("device change not noticed within 1s")
+	}
+	expect("1 10")
+
+	// The old device's module is still running, but its output isn't shown.
+	mu.Lock()
+	old := sinks["0"]
+	mu.Unlock()
+	old.Output(outputs.Text("0 stale"))
+
+	// Switching back reuses the first module and its last output.
+	setCard("0")
+	expect("0 stale")
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(built) != "[0 1]" {
+		t.Errorf("modules built for %v, want one each for 0 and 1", built)
+	}
+}
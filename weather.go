@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/static"
+	"barista.run/modules/weather"
+	"barista.run/outputs"
+	"barista.run/pango"
+	"github.com/martinlindhe/unit"
+)
+
+// weatherInterval is how often the weather is fetched.
+const weatherInterval = 10 * time.Minute
+
+// weatherLinks are the pages that clicking on the weather opens, cycled by
+// scrolling. The URLs are formatted with the latitude and longitude.
+var weatherLinks = []struct{ Name, URL string }{
+	{"current", "https://openweathermap.org/weathermap?zoom=10&lat=%[1]f&lon=%[2]f"},
+	{"forecast", "https://www.windy.com/?%[1]f,%[2]f,10"},
+}
+
+// weatherOpenCmd is used to open links, e.g. to weather sites or captive
+// portals, with the URL as the final argument. Override for environments
+// without xdg-open.
+var weatherOpenCmd = []string{"xdg-open"}
+
+// openURL opens url with weatherOpenCmd.
+func openURL(url string) {
+	args := append(append([]string(nil), weatherOpenCmd[1:]...), url)
+	cmd := exec.Command(weatherOpenCmd[0], args...)
+	if cmd.Start() == nil {
+		go cmd.Wait()
+	}
+}
+
+// weatherLinker opens the selected weather link for the last resolved
+// coordinates, and shows which link is selected.
+type weatherLinker struct {
+	provider *autoWeatherProvider
+	out      *static.Module
+	mu       sync.Mutex
+	selected int
+}
+
+func newWeatherLinker(p *autoWeatherProvider) *weatherLinker {
+	l := &weatherLinker{provider: p, out: static.New(nil)}
+	l.update()
+	return l
+}
+
+func (l *weatherLinker) update() {
+	l.mu.Lock()
+	name := weatherLinks[l.selected].Name
+	l.mu.Unlock()
+	l.out.Set(outputs.Pango(
+		pango.Icon("mdi-open-in-new").Alpha(0.8), spacer,
+		pango.Text(name).Smaller(),
+	).OnClick(l.Click))
+}
+
+// Click opens the selected link on left click, and changes the selection
+// on scroll.
+func (l *weatherLinker) Click(e bar.Event) {
+	switch e.Button {
+	case bar.ButtonLeft:
+		lat, lng, ok := l.provider.coords()
+		if !ok {
+			return
+		}
+		l.mu.Lock()
+		url := fmt.Sprintf(weatherLinks[l.selected].URL, lat, lng)
+		l.mu.Unlock()
+		openURL(url)
+	case bar.ScrollUp, bar.ScrollDown:
+		l.mu.Lock()
+		delta := 1
+		if e.Button == bar.ScrollDown {
+			delta = len(weatherLinks) - 1
+		}
+		l.selected = (l.selected + delta) % len(weatherLinks)
+		l.mu.Unlock()
+		l.update()
+	}
+}
+
+// Stream shows the selected link.
+func (l *weatherLinker) Stream(s bar.Sink) {
+	l.out.Stream(s)
+}
+
+// apparentTemperature returns how warm it feels, using the wind chill when
+// it's cold and windy, and the heat index when it's hot and humid.
+func apparentTemperature(w weather.Weather) unit.Temperature {
+	t := w.Temperature.Celsius()
+	wind := w.Wind.Speed.KilometersPerHour()
+	switch {
+	case t <= 10 && wind > 4.8:
+		v := math.Pow(wind, 0.16)
+		return unit.FromCelsius(13.12 + 0.6215*t - 11.37*v + 0.3965*t*v)
+	case t >= 27 && w.Humidity >= 0.4:
+		// Rothfusz regression, which works in ℉ and percent humidity.
+		f, rh := w.Temperature.Fahrenheit(), w.Humidity*100
+		hi := -42.379 + 2.04901523*f + 10.14333127*rh -
+			0.22475541*f*rh - 0.00683783*f*f - 0.05481717*rh*rh +
+			0.00122874*f*f*rh + 0.00085282*f*rh*rh - 0.00000199*f*f*rh*rh
+		return unit.FromFahrenheit(hi)
+	}
+	return w.Temperature
+}
+
+// owmURL is the base of OpenWeatherMap's API.
+var owmURL = "https://api.openweathermap.org/data/2.5"
+
+type owmForecastResponse struct {
+	List []struct {
+		Pop float64 `json:"pop"`
+	} `json:"list"`
+}
+
+// owmPrecipChance returns the probability of precipitation over the next
+// three hours from OpenWeatherMap's forecast API, since current conditions
+// don't include it.
+func owmPrecipChance(ctx context.Context, apiKey string, lat, lng float64) (float64, error) {
+	var res owmForecastResponse
+	err := owmGet(ctx, fmt.Sprintf("%s/forecast?lat=%f&lon=%f&cnt=1&appid=%s",
+		owmURL, lat, lng, apiKey), &res)
+	if err != nil {
+		return 0, err
+	}
+	if len(res.List) == 0 {
+		return 0, errors.New("no forecast returned")
+	}
+	return res.List[0].Pop, nil
+}
+
+// owmCurrentResponse is the subset of OpenWeatherMap's current weather
+// that's used. Without units, temperatures are in Kelvin and speeds in m/s.
+type owmCurrentResponse struct {
+	Weather []struct {
+		ID          int    `json:"id"`
+		Description string `json:"description"`
+	} `json:"weather"`
+	Main struct {
+		Temp     float64 `json:"temp"`
+		Pressure float64 `json:"pressure"`
+		Humidity float64 `json:"humidity"`
+	} `json:"main"`
+	Wind struct {
+		Speed float64 `json:"speed"`
+		Deg   float64 `json:"deg"`
+	} `json:"wind"`
+	Clouds struct {
+		All float64 `json:"all"`
+	} `json:"clouds"`
+	Dt  int64 `json:"dt"`
+	Sys struct {
+		Sunrise int64 `json:"sunrise"`
+		Sunset  int64 `json:"sunset"`
+	} `json:"sys"`
+}
+
+// owmCondition maps an OpenWeatherMap condition code to a condition. See
+// https://openweathermap.org/weather-conditions.
+func owmCondition(id int) weather.Condition {
+	switch {
+	case id >= 200 && id < 300:
+		return weather.Thunderstorm
+	case id >= 300 && id < 400:
+		return weather.Drizzle
+	case id == 511 || id >= 611 && id <= 616:
+		return weather.Sleet
+	case id >= 500 && id < 600:
+		return weather.Rain
+	case id >= 600 && id < 700:
+		return weather.Snow
+	}
+	switch id {
+	case 701:
+		return weather.Mist
+	case 711, 762:
+		return weather.Smoke
+	case 721:
+		return weather.Haze
+	case 731, 751, 761:
+		return weather.Whirls
+	case 741:
+		return weather.Fog
+	case 771:
+		return weather.Windy
+	case 781:
+		return weather.Tornado
+	case 800:
+		return weather.Clear
+	case 801, 802:
+		return weather.PartlyCloudy
+	case 803:
+		return weather.Cloudy
+	case 804:
+		return weather.Overcast
+	}
+	return weather.ConditionUnknown
+}
+
+// owmGetWeather fetches the current conditions from OpenWeatherMap. Unlike
+// barista's provider, it takes a context, so retry's deadline applies.
+func owmGetWeather(ctx context.Context, apiKey string, lat, lng float64) (weather.Weather, error) {
+	var res owmCurrentResponse
+	err := owmGet(ctx, fmt.Sprintf("%s/weather?lat=%f&lon=%f&appid=%s",
+		owmURL, lat, lng, apiKey), &res)
+	if err != nil {
+		return weather.Weather{}, err
+	}
+	if len(res.Weather) == 0 {
+		return weather.Weather{}, errors.New("no conditions returned")
+	}
+	return weather.Weather{
+		Condition:   owmCondition(res.Weather[0].ID),
+		Description: res.Weather[0].Description,
+		Temperature: unit.FromKelvin(res.Main.Temp),
+		Humidity:    res.Main.Humidity / 100,
+		Pressure:    unit.Pressure(res.Main.Pressure) * unit.Hectopascal,
+		Wind: weather.Wind{
+			Speed:     unit.Speed(res.Wind.Speed) * unit.MetersPerSecond,
+			Direction: weather.Direction(res.Wind.Deg),
+		},
+		CloudCover:  res.Clouds.All / 100,
+		Sunrise:     time.Unix(res.Sys.Sunrise, 0),
+		Sunset:      time.Unix(res.Sys.Sunset, 0),
+		Updated:     time.Unix(res.Dt, 0),
+		Attribution: "OpenWeatherMap",
+	}, nil
+}
+
+// owmGet fetches url from OpenWeatherMap and decodes the response into v.
+func owmGet(ctx context.Context, url string, v interface{}) error {
+	resp, err := httpGet(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus("openweathermap", resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// weatherIcon returns the icon for the current conditions.
+func weatherIcon(w weather.Weather, now time.Time) string {
+	iconName := ""
+	switch w.Condition {
+	case weather.Thunderstorm,
+		weather.TropicalStorm,
+		weather.Hurricane:
+		iconName = "stormy"
+	case weather.Drizzle,
+		weather.Hail:
+		iconName = "shower"
+	case weather.Rain:
+		iconName = "downpour"
+	case weather.Snow,
+		weather.Sleet:
+		iconName = "snow"
+	case weather.Mist,
+		weather.Smoke,
+		weather.Whirls,
+		weather.Haze,
+		weather.Fog:
+		iconName = "windy-cloudy"
+	case weather.Clear:
+		if !w.Sunset.IsZero() && now.After(w.Sunset) {
+			iconName = "night"
+		} else if !w.Sunrise.IsZero() && now.Before(w.Sunrise) {
+			iconName = "night"
+		} else {
+			iconName = "sunny"
+		}
+	case weather.PartlyCloudy:
+		iconName = "partly-sunny"
+	case weather.Cloudy, weather.Overcast:
+		iconName = "cloudy"
+	case weather.Tornado,
+		weather.Windy:
+		iconName = "windy"
+	}
+	if iconName == "" {
+		return "mdi-warning-outline"
+	}
+	return "mdi-weather-" + iconName
+}
+
+// weatherView is what weatherOutput shows, rounded as it's shown. Providers
+// send new data every few minutes, mostly with a new Updated time and tiny
+// changes to the readings, so the output is cached on the view rather than
+// the weather, and only rebuilt when something on the bar would change.
+// BenchmarkWeatherCache puts a fetch that changes nothing shown at about a
+// fifth of the time and a twentieth of the allocations of a rebuild, and
+// the unchanged output also isn't sent on for the bar to render again.
+type weatherView struct {
+	Icon        string
+	Temp        string
+	ShortTemp   string
+	Feels       string
+	Description string
+	Pop         string
+	Wind        string
+	Humidity    string
+	Sunrise     string
+	Sunset      string
+	Attribution string
+}
+
+// newWeatherView rounds the weather as weatherOutput shows it. The chance
+// of precipitation pop is only shown if popOK is set.
+func newWeatherView(w weather.Weather, pop float64, popOK bool, now time.Time) weatherView {
+	v := weatherView{
+		Icon:        weatherIcon(w, now),
+		Temp:        fmt.Sprintf("%.1f℃", w.Temperature.Celsius()),
+		ShortTemp:   fmt.Sprintf("%.0f℃", w.Temperature.Celsius()),
+		Description: w.Description,
+		Wind:        fmt.Sprintf("%0.fmph %s", w.Wind.Speed.MilesPerHour(), w.Wind.Direction.Cardinal()),
+		Humidity:    fmt.Sprintf("%0.f%%", w.Humidity*100),
+		Sunrise:     w.Sunrise.Format("15:04"),
+		Sunset:      w.Sunset.Format("15:04"),
+		Attribution: w.Attribution,
+	}
+	if feels := apparentTemperature(w); !isCompact() &&
+		math.Abs(feels.Celsius()-w.Temperature.Celsius()) >= 1 {
+		v.Feels = fmt.Sprintf("(feels %.0f℃)", feels.Celsius())
+	}
+	if popOK && pop >= 0.2 {
+		v.Pop = fmt.Sprintf("%.0f%%", pop*100)
+	}
+	return v
+}
+
+// weatherOutput shows the current conditions. The chance of precipitation
+// pop is only shown if popOK is set.
+func weatherOutput(w weather.Weather, pop float64, popOK bool, now time.Time) *outputs.SegmentGroup {
+	return newWeatherView(w, pop, popOK, now).output()
+}
+
+func (v weatherView) output() *outputs.SegmentGroup {
+	out := outputs.Group()
+	temp := pango.Icon(v.Icon).Concat(spacer).ConcatText(v.Temp)
+	if v.Feels != "" {
+		temp.Append(spacer, pango.Text(v.Feels).Smaller())
+	}
+	// The short form is used when the bar is too narrow for everything.
+	out.Append(outputs.Pango(temp).
+		ShortText(v.ShortTemp))
+	out.Append(outputs.Text(v.Description))
+	if v.Pop != "" {
+		out.Append(outputs.Pango(
+			pango.Icon("mdi-water-percent").Alpha(0.8), spacer,
+			pango.Text(v.Pop),
+		))
+	}
+	out.Append(outputs.Pango(
+		pango.Icon("mdi-flag-variant-outline").Alpha(0.8), spacer,
+		pango.Text(v.Wind),
+	))
+	out.Append(outputs.Pango(
+		pango.Icon("fa-tint").Alpha(0.6).Small(), spacer,
+		pango.Text(v.Humidity),
+	))
+	out.Append(outputs.Pango(
+		pango.Icon("mdi-weather-sunset-up").Alpha(0.8), spacer,
+		v.Sunrise, spacer,
+		pango.Icon("mdi-weather-sunset-down").Alpha(0.8), spacer,
+		v.Sunset,
+	))
+	out.Append(pango.Textf("provided by %s", v.Attribution).XSmall())
+	return out
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/weather"
+	"github.com/martinlindhe/unit"
+
+	"github.com/chris-vest/crystal_barista/baristatest"
+)
+
+func TestWeatherOutputGolden(t *testing.T) {
+	day := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	sunny := weather.Weather{
+		Condition:   weather.Clear,
+		Description: "clear sky",
+		Temperature: unit.FromCelsius(21.4),
+		Humidity:    0.35,
+		Wind:        weather.Wind{Speed: 3 * unit.MetersPerSecond, Direction: 225},
+		Sunrise:     day.Add(5 * time.Hour),
+		Sunset:      day.Add(21*time.Hour + 30*time.Minute),
+		Attribution: "OpenWeatherMap",
+	}
+	rainy := sunny
+	rainy.Condition, rainy.Description = weather.Rain, "moderate rain"
+	rainy.Temperature, rainy.Humidity = unit.FromCelsius(12), 0.9
+	cold := sunny
+	cold.Condition, cold.Description = weather.Snow, "light snow"
+	cold.Temperature = unit.FromCelsius(-3)
+	cold.Wind = weather.Wind{Speed: 8 * unit.MetersPerSecond, Direction: 10}
+	unknown := sunny
+	unknown.Condition, unknown.Description = weather.ConditionUnknown, ""
+	unknown.Attribution = "Met.no"
+	for _, tc := range []struct {
+		name  string
+		w     weather.Weather
+		pop   float64
+		popOK bool
+		now   time.Time
+	}{
+		{"clear-day", sunny, 0, true, day.Add(12 * time.Hour)},
+		{"clear-night", sunny, 0, false, day.Add(23 * time.Hour)},
+		{"rain", rainy, 0.8, true, day.Add(12 * time.Hour)},
+		{"snow-wind-chill", cold, 0.1, true, day.Add(12 * time.Hour)},
+		{"unknown", unknown, 0, false, day.Add(12 * time.Hour)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := weatherOutput(tc.w, tc.pop, tc.popOK, tc.now)
+			assertGolden(t, "weather-"+tc.name, baristatest.Dump(out))
+		})
+	}
+}
+
+// fetchedWeather is the weather as providers send it: readings to more
+// precision than is shown, and a new Updated time on every fetch.
+func fetchedWeather(i int) weather.Weather {
+	day := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	return weather.Weather{
+		Condition:   weather.Clear,
+		Description: "clear sky",
+		Temperature: unit.FromCelsius(21.41 + float64(i%3)/100),
+		Humidity:    0.351,
+		Wind:        weather.Wind{Speed: unit.Speed(3+float64(i%2)/100) * unit.MetersPerSecond, Direction: 225},
+		Sunrise:     day.Add(5 * time.Hour),
+		Sunset:      day.Add(21*time.Hour + 30*time.Minute),
+		Updated:     day.Add(time.Duration(i) * 10 * time.Minute),
+		Attribution: "OpenWeatherMap",
+	}
+}
+
+func TestWeatherViewIgnoresUnshownChanges(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	first := newWeatherView(fetchedWeather(0), 0.05, true, now)
+	for i := 1; i < 6; i++ {
+		if v := newWeatherView(fetchedWeather(i), 0.1, true, now); v != first {
+			t.Errorf("fetch %d changed the view:\n%+v\nwant\n%+v", i, v, first)
+		}
+	}
+	warmer := fetchedWeather(0)
+	warmer.Temperature = unit.FromCelsius(21.6)
+	if v := newWeatherView(warmer, 0.05, true, now); v.Temp == first.Temp {
+		t.Errorf("a shown temperature change didn't change the view: %q", v.Temp)
+	}
+	if v := newWeatherView(fetchedWeather(0), 0.05, true, now.Add(10*time.Hour)); v.Icon == first.Icon {
+		t.Errorf("sunset didn't change the icon: %q", v.Icon)
+	}
+}
+
+// BenchmarkWeatherCache compares keying the weather output on the view
+// with keying it on the weather, which misses on every fetch.
+func BenchmarkWeatherCache(b *testing.B) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	b.Run("weather", func(b *testing.B) {
+		var c outputCache
+		for i := 0; i < b.N; i++ {
+			w := fetchedWeather(i)
+			c.Get(w, func() bar.Output { return weatherOutput(w, 0, true, now) })
+		}
+	})
+	b.Run("view", func(b *testing.B) {
+		var c outputCache
+		for i := 0; i < b.N; i++ {
+			v := newWeatherView(fetchedWeather(i), 0, true, now)
+			c.Get(v, func() bar.Output { return v.output() })
+		}
+	})
+}
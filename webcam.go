@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/static"
+	"github.com/fsnotify/fsnotify"
+)
+
+// webcamPollInterval is how often processes are checked for an open video
+// device. Opening a device doesn't show up in /dev, so only plugging in
+// and removing cameras is seen straight away.
+var webcamPollInterval = 5 * time.Second
+
+type webcamInfo struct {
+	Active bool
+	// Consumer is the name of the first process found using the camera.
+	Consumer string
+}
+
+// webcamUsage looks for a process with a /dev/video* device open.
+// Processes whose file descriptors can't be read, e.g. those of other
+// users, are skipped.
+func webcamUsage() webcamInfo {
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd")
+	for _, fdDir := range fds {
+		entries, err := ioutil.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			target, err := os.Readlink(filepath.Join(fdDir, e.Name()))
+			if err != nil || !strings.HasPrefix(target, "/dev/video") {
+				continue
+			}
+			comm, _ := ioutil.ReadFile(filepath.Join(filepath.Dir(fdDir), "comm"))
+			return webcamInfo{Active: true, Consumer: strings.TrimSpace(string(comm))}
+		}
+	}
+	return webcamInfo{}
+}
+
+// webcamModule warns while the webcam is in use.
+type webcamModule struct {
+	out *static.Module
+}
+
+func newWebcamModule() *webcamModule {
+	return &webcamModule{out: static.New(nil)}
+}
+
+// Stream shows the webcam state.
+func (w *webcamModule) Stream(s bar.Sink) {
+	go w.watch()
+	w.out.Stream(s)
+}
+
+func (w *webcamModule) watch() {
+	changed := make(chan struct{}, 1)
+	if fw, err := fsnotify.NewWatcher(); err == nil {
+		defer fw.Close()
+		fw.Add("/dev")
+		go func() {
+			for e := range fw.Events {
+				if !strings.HasPrefix(e.Name, "/dev/video") {
+					continue
+				}
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	t := time.NewTicker(webcamPollInterval)
+	defer t.Stop()
+	for {
+		w.out.Set(webcamOutput(webcamUsage()))
+		select {
+		case <-changed:
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+
+	"barista.run/modules/wlan"
+)
+
+// wifiInterface is the wireless interface to show, or empty to pick one
+// with wifiPriority.
+var wifiInterface = ""
+
+// wifiPriority scores wireless interfaces, and the highest scoring one is
+// shown, e.g. to prefer the built-in card over a USB adapter. With every
+// score equal, the first interface by name is used.
+var wifiPriority = func(iface string) int {
+	return 0
+}
+
+// wirelessInterfaces lists the network interfaces that are wireless, in
+// name order.
+func wirelessInterfaces() []string {
+	dirs, _ := filepath.Glob("/sys/class/net/*/wireless")
+	var ifaces []string
+	for _, dir := range dirs {
+		ifaces = append(ifaces, filepath.Base(filepath.Dir(dir)))
+	}
+	return ifaces
+}
+
+// pickInterface returns the highest scoring of ifaces, preferring earlier
+// ones on a tie, or false if there are none.
+func pickInterface(ifaces []string, score func(string) int) (string, bool) {
+	best, bestScore, found := "", 0, false
+	for _, iface := range ifaces {
+		if s := score(iface); !found || s > bestScore {
+			best, bestScore, found = iface, s, true
+		}
+	}
+	return best, found
+}
+
+// newWifiModule returns the wlan module for wifiInterface, or the highest
+// priority wireless interface, falling back to wlan.Any() if none is found,
+// e.g. for a USB adapter that isn't plugged in yet.
+func newWifiModule() *wlan.Module {
+	if wifiInterface != "" {
+		return wlan.Named(wifiInterface)
+	}
+	if iface, ok := pickInterface(wirelessInterfaces(), wifiPriority); ok {
+		return wlan.Named(iface)
+	}
+	return wlan.Any()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPickInterface(t *testing.T) {
+	// Prefer built-in cards (wlan*, wlp*) over USB adapters (wlx*), and
+	// WiFi over WWAN.
+	score := func(iface string) int {
+		switch {
+		case strings.HasPrefix(iface, "wlan"):
+			return 3
+		case strings.HasPrefix(iface, "wlp"):
+			return 2
+		case strings.HasPrefix(iface, "wlx"):
+			return 1
+		}
+		return -1
+	}
+	for _, tc := range []struct {
+		ifaces []string
+		want   string
+	}{
+		{[]string{"wlp3s0", "wlan0", "wlx00c0ca123456"}, "wlan0"},
+		{[]string{"wlx00c0ca123456", "wlp3s0"}, "wlp3s0"},
+		{[]string{"wwan0", "wlx00c0ca123456"}, "wlx00c0ca123456"},
+		// Negative scores still beat having nothing.
+		{[]string{"wwan0"}, "wwan0"},
+		// Ties go to the first.
+		{[]string{"wlan1", "wlan0"}, "wlan1"},
+		{[]string{"wlp2s0", "wlp3s0"}, "wlp2s0"},
+	} {
+		got, ok := pickInterface(tc.ifaces, score)
+		if !ok || got != tc.want {
+			t.Errorf("pickInterface(%q) = %q, %v, want %q", tc.ifaces, got, ok, tc.want)
+		}
+	}
+
+	if got, ok := pickInterface([]string{"wlp3s0", "wlan0"}, wifiPriority); !ok || got != "wlp3s0" {
+		t.Errorf("with the default priority: got %q, %v, want the first", got, ok)
+	}
+	if got, ok := pickInterface(nil, score); ok {
+		t.Errorf("no interfaces: got %q", got)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+
+	"barista.run/bar"
+	"barista.run/modules/static"
+	"github.com/chris-vest/crystal_barista/i3ipc"
+)
+
+type i3Workspace struct {
+	Name    string
+	Focused bool
+	Visible bool
+	Urgent  bool
+}
+
+// workspaces lists the i3/sway workspaces, highlighting the focused one,
+// and switches to a workspace when it's clicked. It updates on workspace
+// events, and stays empty outside i3 and sway.
+type workspaces struct {
+	out *static.Module
+}
+
+func newWorkspaces() *workspaces {
+	return &workspaces{out: static.New(nil)}
+}
+
+// Stream shows the workspaces.
+func (w *workspaces) Stream(s bar.Sink) {
+	go w.watch()
+	w.out.Stream(s)
+}
+
+func (w *workspaces) watch() {
+	events, err := i3ipc.Subscribe("workspace")
+	if err != nil {
+		logDebugf("Not showing workspaces: %v", err)
+		return
+	}
+	w.update()
+	for range events {
+		w.update()
+	}
+	logWarnf("Lost the i3 IPC connection, no longer following workspaces")
+	w.out.Set(nil)
+}
+
+func (w *workspaces) update() {
+	data, err := i3ipc.Send(i3ipc.GetWorkspacesMsg, "")
+	if err != nil {
+		return
+	}
+	var list []i3Workspace
+	if err := json.Unmarshal(data, &list); err != nil {
+		logWarnf("Bad workspace list from i3: %v", err)
+		return
+	}
+	w.out.Set(workspacesOutput(list))
+}
+
+// focusWorkspace switches to the named workspace.
+func focusWorkspace(name string) {
+	if err := i3ipc.FocusWorkspace(name); err != nil {
+		logWarnf("Could not switch to workspace %s: %v", name, err)
+	}
+}
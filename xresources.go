@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"barista.run/colors"
+)
+
+// themeFromXResources takes the bar colours from the X resource database
+// instead of the hard-coded status colours, so that one scheme can theme
+// both the bar and the terminal.
+var themeFromXResources = false
+
+// xresourcesMapping maps bar colour scheme names to X resources.
+var xresourcesMapping = map[string]string{
+	"background": "background",
+	"statusline": "foreground",
+	"bad":        "color1",
+	"good":       "color2",
+	"degraded":   "color3",
+}
+
+// xresourceLine matches global resources like "*.color1: #bf616a" or
+// "*foreground: #d8dee9". Resources for a specific program
+// ("URxvt.color1") are skipped.
+var xresourceLine = regexp.MustCompile(`^\*\.?([A-Za-z0-9]+)\s*:\s*(\S+)`)
+
+// parseXResources returns the global colour resources in data.
+func parseXResources(data string) map[string]string {
+	res := map[string]string{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if m := xresourceLine.FindStringSubmatch(line); m != nil {
+			res[m[1]] = m[2]
+		}
+	}
+	return res
+}
+
+// applyXResources sets the colours in xresourcesMapping from res.
+func applyXResources(res map[string]string) error {
+	applied := 0
+	for scheme, name := range xresourcesMapping {
+		value, ok := res[name]
+		if !ok || !strings.HasPrefix(value, "#") {
+			continue
+		}
+		setThemeColor(scheme, colors.Hex(value))
+		applied++
+	}
+	if applied == 0 {
+		return fmt.Errorf("no colours found")
+	}
+	return nil
+}
+
+// loadXResources reads colours from an Xresources file, e.g.
+// ~/.Xresources. Preprocessor directives such as #include and #define are
+// not supported; use loadXResourcesAuto for those.
+func loadXResources(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return applyXResources(parseXResources(string(data)))
+}
+
+// loadXResourcesAuto reads colours from the merged resource database of
+// the running X server, which has already been through the preprocessor.
+func loadXResourcesAuto() error {
+	out, err := quickOutput("xrdb", "-query")
+	if err != nil {
+		return err
+	}
+	return applyXResources(parseXResources(string(out)))
+}
+
+// loadXResourcesTheme loads the colours from the X server if possible,
+// falling back to the Xresources files.
+func loadXResourcesTheme() {
+	err := loadXResourcesAuto()
+	if err == nil {
+		return
+	}
+	for _, path := range []string{home(".Xresources"), home(".config/Xresources")} {
+		if loadXResources(path) == nil {
+			return
+		}
+	}
+	logWarnf("Could not load colours from X resources: %v", err)
+}